@@ -0,0 +1,109 @@
+#!/usr/bin/env bash
+#
+# Run a plugin skill's helper script directly, without Claude Code, from CI
+# steps and in-cluster Jobs.
+#
+#   ai-helper list                                 List the helper scripts
+#   ai-helper <plugin>/<skill>/<script> [args...]  Run one, e.g. openshift/fleet-health/fleet_sweep.py
+#
+# <script> is looked up in skills/<skill>/scripts/, then in skills/<skill>/.
+#
+# Credentials come from the environment or mounted files:
+#   - Each file in $AI_HELPER_ENV_DIR (default /var/run/secrets/ai-helpers)
+#     sets the variable named after it to its content, unless already set.
+#     Mount a Secret there with keys such as GOVC_PASSWORD or GITHUB_TOKEN
+#     instead of passing values on the command line.
+#   - Inside a pod without KUBECONFIG, a kubeconfig for the pod's service
+#     account is written to $HOME/.kube/config.
+#
+# Results go to stdout and diagnostics to stderr; the script's exit code is
+# passed through.
+
+set -euo pipefail
+
+PLUGINS_DIR="${AI_HELPERS_DIR:-/opt/ai-helpers}/plugins"
+ENV_DIR="${AI_HELPER_ENV_DIR:-/var/run/secrets/ai-helpers}"
+SA_DIR=/var/run/secrets/kubernetes.io/serviceaccount
+
+# The image runs with a random UID on OpenShift; HOME must be writable for
+# the stores helpers keep under ~/.config
+if [ ! -w "${HOME:-/nonexistent}" ]; then
+  export HOME=/tmp/home
+  mkdir -p "${HOME}"
+fi
+
+if [ -d "${ENV_DIR}" ]; then
+  for file in "${ENV_DIR}"/*; do
+    name="$(basename "${file}")"
+    # Secret volumes also contain ..data and timestamped directories
+    if [[ "${name}" =~ ^[A-Za-z_][A-Za-z0-9_]*$ ]] && [ -f "${file}" ] && [ -z "${!name:-}" ]; then
+      export "${name}=$(cat "${file}")"
+    fi
+  done
+fi
+
+if [ -z "${KUBECONFIG:-}" ] && [ ! -f "${HOME}/.kube/config" ] && [ -r "${SA_DIR}/token" ] && [ -n "${KUBERNETES_SERVICE_HOST:-}" ]; then
+  mkdir -p "${HOME}/.kube"
+  cat > "${HOME}/.kube/config" <<EOF
+apiVersion: v1
+kind: Config
+clusters:
+- name: in-cluster
+  cluster:
+    server: https://${KUBERNETES_SERVICE_HOST}:${KUBERNETES_SERVICE_PORT:-443}
+    certificate-authority: ${SA_DIR}/ca.crt
+users:
+- name: service-account
+  user:
+    tokenFile: ${SA_DIR}/token
+contexts:
+- name: in-cluster
+  context:
+    cluster: in-cluster
+    user: service-account
+    namespace: $(cat "${SA_DIR}/namespace" 2>/dev/null || echo default)
+current-context: in-cluster
+EOF
+  chmod 600 "${HOME}/.kube/config"
+fi
+
+export PYTHONUNBUFFERED=1
+
+usage() {
+  echo "Usage: ai-helper list | <plugin>/<skill>/<script> [args...]" >&2
+}
+
+if [ $# -eq 0 ]; then
+  usage
+  exit 1
+fi
+
+if [ "$1" = "list" ]; then
+  # Helpers live in skills/<skill>/scripts/ or directly in skills/<skill>/
+  cd "${PLUGINS_DIR}"
+  find . \( -path './*/skills/*/scripts/*' -o \( -path './*/skills/*/*' ! -path './*/skills/*/*/*' \) \) \
+    -type f \( -name '*.py' -o -name '*.sh' \) ! -name 'test_*' ! -name '*_test.py' ! -path '*/__pycache__/*' |
+    sed -e 's|^\./||' -e 's|/skills/|/|' -e 's|/scripts/|/|' | sort
+  exit 0
+fi
+
+IFS=/ read -r plugin skill script <<< "$1"
+if [ -z "${plugin}" ] || [ -z "${skill}" ] || [ -z "${script}" ]; then
+  usage
+  exit 1
+fi
+path="${PLUGINS_DIR}/${plugin}/skills/${skill}/scripts/${script}"
+if [ ! -f "${path}" ]; then
+  path="${PLUGINS_DIR}/${plugin}/skills/${skill}/${script}"
+fi
+if [ ! -f "${path}" ]; then
+  echo "Error: no helper script ${1} (run 'ai-helper list')" >&2
+  exit 1
+fi
+shift
+
+case "${path}" in
+  *.py) exec python3 "${path}" "$@" ;;
+  *.sh) exec bash "${path}" "$@" ;;
+  *)    exec "${path}" "$@" ;;
+esac
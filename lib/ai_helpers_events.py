@@ -0,0 +1,54 @@
+"""
+ai_helpers_events.py - Machine-readable events shared by plugin scripts
+
+Scripts import it through a symlink in their directory; see "Reuse lib/
+helpers in scripts" in AGENTS.md:
+
+  ln -s <relative path to>/lib/ai_helpers_events.py plugins/<plugin>/skills/<skill>/scripts/
+  from ai_helpers_events import notify, progress
+
+progress() prints one NDJSON event per call on stderr:
+
+  {"type": "progress", "phase": "...", "done": N, "total": N|null,
+   "percent": N|null, "etaSeconds": N|null, "item": "..."}
+
+notify() POSTs a JSON payload to a --notify-webhook URL when a command finishes.
+
+Requirements:
+  - Python 3.6+, standard library only
+"""
+
+import json
+import os
+import sys
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+from typing import Any, Dict, Optional
+
+
+def progress(phase: str, done: int, total: Optional[int], started: float, item: str) -> None:
+    """Print one NDJSON progress event on stderr; total is None while it is unknown."""
+    elapsed = time.time() - started
+    print(json.dumps({'type': 'progress', 'phase': phase, 'done': done, 'total': total,
+                      'percent': round(100.0 * done / total, 1) if total else None,
+                      'etaSeconds': int(elapsed / done * (total - done)) if total and done else None,
+                      'item': item}), file=sys.stderr, flush=True)
+
+
+def notify(url: str, payload: Dict[str, Any]) -> None:
+    """POST payload as JSON to url, or to the URL in the variable for "env:NAME"; failures only warn."""
+    if url.startswith('env:'):
+        url = os.environ.get(url[4:], '')
+        if not url:
+            print('Warning: --notify-webhook variable is not set, no notification sent', file=sys.stderr)
+            return
+    req = urllib.request.Request(url, data=json.dumps(payload).encode('utf-8'),
+                                 headers={'Content-Type': 'application/json'}, method='POST')
+    try:
+        urllib.request.urlopen(req, timeout=15).close()
+    except (urllib.error.URLError, OSError, ValueError) as e:
+        # webhook URLs embed their token, so only the host is printed
+        print('Warning: webhook POST to {} failed: {}'.format(urllib.parse.urlsplit(url).netloc or '?', e),
+              file=sys.stderr)
@@ -0,0 +1,236 @@
+#!/usr/bin/env python3
+"""
+ai_helpers_lock.py - Advisory locks on shared targets for mutating commands
+
+Two sessions that destroy or clean up the same vCenter folder or cluster
+at once delete objects under each other. A command that changes a shared
+target takes a lock on it first, and a second command on the same target
+waits or stops. The lock is advisory: it only guards commands that take it.
+
+Scripts import it through a symlink in their directory; see "Reuse lib/
+helpers in scripts" in AGENTS.md:
+
+  ln -s <relative path to>/lib/ai_helpers_lock.py plugins/<plugin>/skills/<skill>/scripts/
+  from ai_helpers_lock import LockHeld, acquire, release, target_lock
+
+Markdown commands, whose shell steps run as separate processes, use the
+command line and keep the token between steps:
+
+  ai_helpers_lock.py acquire TARGET [--command NAME] [--ttl SECONDS] [--wait SECONDS] [--steal]
+  ai_helpers_lock.py release TARGET --token TOKEN
+  ai_helpers_lock.py status [TARGET] [--json]
+
+A target is a string naming the system, such as
+vsphere://vcenter.example.com/DC1/vm/ci-ln-x7k2p or cluster://ci-ln-x7k2p.
+Each lock is one JSON file in $AI_HELPERS_LOCK_DIR (default
+~/.cache/ai-helpers/locks), named by a hash of the target, holding the
+target, a random token, the command, host, user, and the acquired and
+expiry times. Creating the file with O_EXCL makes acquiring atomic, so the
+locks hold between sessions that share that directory: the same user on
+the same machine, or a shared directory on a bastion.
+
+A lock expires after --ttl seconds (default 3600), because the process that
+took it may be gone: Markdown command steps exit right away, and a session
+can be interrupted. An expired lock is taken over with a warning. --wait
+polls for up to that many seconds for the holder to release it; --steal
+takes it over at once, for a holder known to be dead. Only the token
+returned by acquire releases the lock.
+
+Exit codes (command line):
+  0 - Acquired (the token is printed on stdout), released, or listed
+  1 - Invalid arguments, or the token does not match the lock's holder
+  2 - The target is locked by someone else (the holder is printed on stderr)
+
+Requirements:
+  - Python 3.6+, standard library only
+"""
+
+import argparse
+import contextlib
+import datetime
+import getpass
+import hashlib
+import json
+import os
+import socket
+import sys
+import time
+import uuid
+from typing import Any, Dict, Iterator, List, Optional
+
+DEFAULT_TTL = 3600
+POLL_SECONDS = 2
+
+
+class LockHeld(Exception):
+    """The target is locked by another holder, described by holder."""
+
+    def __init__(self, holder: Dict[str, Any]):
+        super().__init__('{} is locked by {} ({}@{}) since {}, until {}'.format(
+            holder.get('target'), holder.get('command') or 'another command', holder.get('user'),
+            holder.get('host'), holder.get('acquired'), holder.get('expires')))
+        self.holder = holder
+
+
+def lock_dir() -> str:
+    return os.environ.get('AI_HELPERS_LOCK_DIR') or os.path.expanduser('~/.cache/ai-helpers/locks')
+
+
+def lock_path(target: str) -> str:
+    return os.path.join(lock_dir(), hashlib.sha256(target.encode()).hexdigest()[:24] + '.json')
+
+
+def timestamp(seconds: float) -> str:
+    return datetime.datetime.fromtimestamp(seconds, datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ')
+
+
+def read_lock(path: str) -> Optional[Dict[str, Any]]:
+    """The holder recorded in path, None if there is none; a file that cannot be parsed counts as expired."""
+    try:
+        with open(path) as f:
+            return json.load(f)
+    except FileNotFoundError:
+        return None
+    except (OSError, ValueError):
+        return {'expiresAt': 0}
+
+
+def try_create(path: str, holder: Dict[str, Any]) -> bool:
+    try:
+        fd = os.open(path, os.O_WRONLY | os.O_CREAT | os.O_EXCL, 0o600)
+    except FileExistsError:
+        return False
+    with os.fdopen(fd, 'w') as f:
+        json.dump(holder, f, indent=2)
+    return True
+
+
+def take_over(path: str) -> bool:
+    """Move the current lock file aside; False when another session moved or replaced it first."""
+    aside = '{}.{}.stale'.format(path, uuid.uuid4().hex)
+    try:
+        os.rename(path, aside)
+    except FileNotFoundError:
+        return False
+    os.remove(aside)
+    return True
+
+
+def acquire(target: str, command: str = '', ttl: int = DEFAULT_TTL, wait: float = 0,
+            steal: bool = False) -> str:
+    """Lock target and return the token that releases it; raises LockHeld when it stays locked."""
+    os.makedirs(lock_dir(), mode=0o700, exist_ok=True)
+    path = lock_path(target)
+    deadline = time.time() + wait
+    while True:
+        now = time.time()
+        holder = {'target': target, 'token': uuid.uuid4().hex, 'command': command, 'host': socket.gethostname(),
+                  'user': getpass.getuser(), 'pid': os.getpid(), 'acquired': timestamp(now),
+                  'expires': timestamp(now + ttl), 'expiresAt': now + ttl}
+        if try_create(path, holder):
+            return holder['token']
+        current = read_lock(path)
+        if current is None:
+            continue
+        if steal or current.get('expiresAt', 0) <= now:
+            reason = 'stealing' if steal else 'taking over the expired lock'
+            print('Warning: {}: {}'.format(reason, LockHeld(dict(current, target=target))), file=sys.stderr)
+            steal = False
+            take_over(path)
+            continue
+        if now >= deadline:
+            raise LockHeld(current)
+        time.sleep(min(POLL_SECONDS, max(deadline - now, 0.1)))
+
+
+def release(target: str, token: str) -> None:
+    """Remove the lock on target if token holds it; raises ValueError otherwise."""
+    path = lock_path(target)
+    current = read_lock(path)
+    if current is None:
+        return
+    if current.get('token') != token:
+        raise ValueError('{} is held by another token; not releasing it'.format(target))
+    os.remove(path)
+
+
+@contextlib.contextmanager
+def target_lock(target: str, command: str = '', ttl: int = DEFAULT_TTL, wait: float = 0,
+                steal: bool = False) -> Iterator[str]:
+    """Hold the lock on target for the duration of the with block."""
+    token = acquire(target, command, ttl, wait, steal)
+    try:
+        yield token
+    finally:
+        with contextlib.suppress(ValueError, OSError):
+            release(target, token)
+
+
+def locks(target: Optional[str] = None) -> List[Dict[str, Any]]:
+    """The current locks, or the lock on target, with an expired flag and without tokens."""
+    paths = [lock_path(target)] if target else sorted(
+        os.path.join(lock_dir(), name) for name in (os.listdir(lock_dir()) if os.path.isdir(lock_dir()) else [])
+        if name.endswith('.json'))
+    found = []
+    for path in paths:
+        holder = read_lock(path)
+        if holder is not None:
+            expired = holder.get('expiresAt', 0) <= time.time()
+            holder = {k: v for k, v in holder.items() if k not in ('token', 'expiresAt')}
+            holder['expired'] = expired
+            found.append(holder)
+    return found
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Advisory locks on shared targets')
+    sub = parser.add_subparsers(dest='action')
+    p = sub.add_parser('acquire', help='lock a target and print the token')
+    p.add_argument('target', help='e.g. vsphere://vcenter.example.com/DC1/vm/<infra-id>')
+    p.add_argument('--command', default='', help='the command taking the lock, shown to other sessions')
+    p.add_argument('--ttl', type=int, default=DEFAULT_TTL,
+                   help='seconds until the lock expires (default {})'.format(DEFAULT_TTL))
+    p.add_argument('--wait', type=int, default=0, help='seconds to wait for the holder to release it (default 0)')
+    p.add_argument('--steal', action='store_true', help='take the lock over even if it has not expired')
+    p = sub.add_parser('release', help='release a lock held with the token')
+    p.add_argument('target')
+    p.add_argument('--token', required=True)
+    p = sub.add_parser('status', help='list the locks, or the lock on one target')
+    p.add_argument('target', nargs='?')
+    p.add_argument('--json', action='store_true')
+    args = parser.parse_args()
+
+    if args.action == 'acquire':
+        if args.ttl < 1 or args.wait < 0:
+            print('Error: --ttl must be positive and --wait not negative', file=sys.stderr)
+            return 1
+        try:
+            print(acquire(args.target, args.command, args.ttl, args.wait, args.steal))
+        except LockHeld as e:
+            print('Error: {}'.format(e), file=sys.stderr)
+            return 2
+        return 0
+    if args.action == 'release':
+        try:
+            release(args.target, args.token)
+        except ValueError as e:
+            print('Error: {}'.format(e), file=sys.stderr)
+            return 1
+        return 0
+    if args.action == 'status':
+        found = locks(args.target)
+        if args.json:
+            print(json.dumps(found, indent=2))
+        else:
+            for holder in found:
+                print('{}  {}  {}@{}  until {}{}'.format(holder.get('target'), holder.get('command') or '-',
+                                                        holder.get('user'), holder.get('host'), holder.get('expires'),
+                                                        ' (expired)' if holder['expired'] else ''))
+            print('{} locks'.format(len(found)))
+        return 0
+    parser.print_help(sys.stderr)
+    return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
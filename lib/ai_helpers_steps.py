@@ -0,0 +1,86 @@
+"""
+ai_helpers_steps.py - Shell step runner and config store shared by the
+utils:report and utils:run-workflow scripts
+
+Scripts import it through a symlink in their directory; see "Reuse lib/
+helpers in scripts" in AGENTS.md.
+
+run_shell() runs one shell step with a timeout and returns:
+
+  {"stdout": "...", "stderr": "...", "exitCode": N|null, "ok": bool,
+   "summary": "" | "exit code N" | "timed out after Ns", "durationSeconds": N}
+
+exitCode is null when the step timed out; stdout and stderr then hold the
+output captured until the timeout. Callers map ok to their own statuses.
+
+Requirements:
+  - Python 3.6+, standard library only
+"""
+
+import os
+import re
+import subprocess
+import time
+from typing import Any, Dict, Iterator, Sequence, Tuple
+
+STATUS_ICONS = {'ok': '✅', 'attention': '⚠️', 'error': '❌', 'skipped': '➖'}
+NAME = re.compile(r'[A-Za-z0-9][A-Za-z0-9_.-]*')
+
+
+def status_icon(status: str) -> str:
+    """Icon for a step status; statuses without a result (not run, missing) get a question mark."""
+    return STATUS_ICONS.get(status, '❔')
+
+
+def partial_output(data: Any) -> str:
+    """Output captured before a timeout; TimeoutExpired holds bytes even in text mode."""
+    if isinstance(data, bytes):
+        return data.decode('utf-8', errors='replace')
+    return data or ''
+
+
+def run_shell(command: str, timeout: int, ok_exit_codes: Sequence[int] = (0,),
+              merge_stderr: bool = False) -> Dict[str, Any]:
+    """Run command through the shell; with merge_stderr, stderr is interleaved into stdout."""
+    start = time.time()
+    result = {'stdout': '', 'stderr': '', 'exitCode': None, 'ok': False, 'summary': ''}
+    try:
+        proc = subprocess.run(command, shell=True, stdout=subprocess.PIPE,
+                              stderr=subprocess.STDOUT if merge_stderr else subprocess.PIPE,
+                              universal_newlines=True, timeout=timeout)
+        result.update(stdout=proc.stdout or '', stderr=proc.stderr or '', exitCode=proc.returncode,
+                      ok=proc.returncode in ok_exit_codes)
+        if not result['ok']:
+            result['summary'] = 'exit code {}'.format(proc.returncode)
+    except subprocess.TimeoutExpired as e:
+        result.update(stdout=partial_output(e.output), stderr=partial_output(e.stderr),
+                      summary='timed out after {}s'.format(e.timeout))
+    result['durationSeconds'] = round(time.time() - start, 1)
+    return result
+
+
+def check_name(name: str, kind: str) -> str:
+    if not NAME.fullmatch(name):
+        raise ValueError('invalid {} name: {}'.format(kind, name))
+    return name
+
+
+def write_example(store: str, name: str, ext: str, text: str, force: bool) -> str:
+    """Write text as NAME+ext in store for init, refusing to overwrite without force."""
+    path = os.path.join(store, name + ext)
+    if os.path.exists(path) and not force:
+        raise RuntimeError('{} exists, use --force to overwrite'.format(path))
+    os.makedirs(store, exist_ok=True)
+    with open(path, 'w', encoding='utf-8') as f:
+        f.write(text)
+    return path
+
+
+def store_entries(store: str, exts: Sequence[str]) -> Iterator[Tuple[str, str]]:
+    """(name, path) of each file in store with one of exts, sorted; a missing store is empty."""
+    if not os.path.isdir(store):
+        return
+    for entry in sorted(os.listdir(store)):
+        stem, ext = os.path.splitext(entry)
+        if ext in exts:
+            yield stem, os.path.join(store, entry)
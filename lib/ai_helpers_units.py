@@ -0,0 +1,54 @@
+"""
+ai_helpers_units.py - Human sizes and durations shared by plugin scripts
+
+Scripts import it through a symlink in their directory; see "Reuse lib/
+helpers in scripts" in AGENTS.md:
+
+  ln -s <relative path to>/lib/ai_helpers_units.py plugins/<plugin>/skills/<skill>/scripts/
+  from ai_helpers_units import format_size, parse_duration, parse_size
+
+parse_size() reads a byte count with an optional unit: K, M, G, T, or P,
+optionally followed by i and B, in any case. Every unit is a power of 1024,
+so 50M, 50MB, and 50MiB are all 52428800 bytes, and fractions such as
+1.5TiB are allowed.
+
+parse_duration() reads a Prometheus-style duration into seconds: one or more
+whole numbers with a unit s, m, h, d, or w, such as 30s, 6h, 2w, or 1h30m.
+
+format_size() prints a byte count with the largest binary unit below it,
+such as 512B, 1.5KiB, or 2.0GiB.
+
+Requirements:
+  - Python 3.6+, standard library only
+"""
+
+import re
+
+SIZE = re.compile(r'\s*(\d+(?:\.\d+)?)\s*(?:([KMGTP])(?:i?B)?|B)?\s*', re.IGNORECASE)
+DURATION = re.compile(r'(\d+)([smhdw])')
+SECONDS = {'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+
+
+def parse_size(value: str) -> int:
+    """Parse a size such as 512K, 50MB, 1.5TiB, or a plain byte count into bytes."""
+    m = SIZE.fullmatch(str(value))
+    if not m:
+        raise ValueError('invalid size {!r}, use for example 512K, 50M, or 1.5TiB'.format(value))
+    return int(float(m.group(1)) * 1024 ** ' KMGTP'.index((m.group(2) or ' ').upper()))
+
+
+def parse_duration(value: str) -> int:
+    """Parse a duration such as 30s, 6h, 2w, or 1h30m into seconds."""
+    value = str(value).strip()
+    if not value or DURATION.sub('', value):
+        raise ValueError('invalid duration {!r}, use for example 30m, 6h, 2d, or 1h30m'.format(value))
+    return sum(int(n) * SECONDS[unit] for n, unit in DURATION.findall(value))
+
+
+def format_size(size: float) -> str:
+    """Format a byte count as 512B, 1.5KiB, ..., up to PiB."""
+    for unit in ('B', 'KiB', 'MiB', 'GiB', 'TiB'):
+        if size < 1024:
+            return '{}B'.format(int(size)) if unit == 'B' else '{:.1f}{}'.format(size, unit)
+        size /= 1024
+    return '{:.1f}PiB'.format(size)
@@ -0,0 +1 @@
+../../../../lib/ai_helpers_units.py
\ No newline at end of file
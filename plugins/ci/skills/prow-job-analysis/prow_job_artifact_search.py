@@ -20,6 +20,8 @@ Usage:
     prow_job_artifact_search.py <prow-url> list [subpath]
     prow_job_artifact_search.py <prow-url> search <pattern> [subpath]
     prow_job_artifact_search.py <prow-url> fetch <filepath> [--max-bytes N]
+    prow_job_artifact_search.py <prow-url> download <pattern> [subpath] --dest DIR
+        [--max-size SIZE] [--max-total SIZE] [--dry-run] [--progress]
 
 Examples:
     # List top-level artifacts
@@ -39,6 +41,12 @@ Examples:
 
     # Fetch with size limit (default 512KB)
     prow_job_artifact_search.py <url> fetch artifacts/e2e-test/build-log.txt --max-bytes 1048576
+
+    # Download every matching file to disk, skipping files over 50MB.
+    # Re-running the same command resumes: finished files are kept and
+    # partial downloads continue where they stopped. A local file whose size
+    # differs from the listed object is downloaded again.
+    prow_job_artifact_search.py <url> download "**/gather-extra/**/pods/*.log" --dest .work/artifacts --max-size 50M
 """
 
 import argparse
@@ -47,13 +55,23 @@ import os
 import re
 import subprocess
 import sys
+import time
 import urllib.error
 import urllib.parse
 import urllib.request
 
+from ai_helpers_events import progress
+from ai_helpers_units import parse_size
+
 
 BUCKET = "test-platform-results"
 DEFAULT_MAX_BYTES = 512 * 1024  # 512KB
+DEFAULT_MAX_SIZE = "100M"  # per-file limit for download
+DOWNLOAD_CHUNK = 1024 * 1024
+PARTIAL_SUFFIX = ".part"
+# In --dest: listed and local size of each downloaded file, for objects whose
+# local size differs from the listing (gzip-stored objects are decompressed)
+SIZES_FILE = ".download-sizes.json"
 
 # Public GCS endpoints (no auth — the bucket is world-readable).
 GCS_API_ROOT = "https://storage.googleapis.com/storage/v1/b"
@@ -172,16 +190,8 @@ def _http_get_json(url):
         return json.loads(resp.read().decode("utf-8"))
 
 
-def gcs_api_list(obj_prefix, delimiter=None):
-    """List objects under obj_prefix via the public GCS JSON API.
-
-    Follows pagination. Returns (items, prefixes) where:
-      - items    is a list of full object-name strings under obj_prefix
-      - prefixes is a list of immediate sub-directory prefixes (only populated
-        when delimiter="/" is passed)
-    """
-    items = []
-    prefixes = []
+def _gcs_api_pages(obj_prefix, delimiter=None):
+    """Yield the pages of a public GCS JSON API listing under obj_prefix."""
     page_token = None
     pages = 0
     base = f"{GCS_API_ROOT}/{BUCKET}/o"
@@ -192,18 +202,43 @@ def gcs_api_list(obj_prefix, delimiter=None):
         if page_token:
             params["pageToken"] = page_token
         data = _http_get_json(f"{base}?{urllib.parse.urlencode(params)}")
+        yield data
+        page_token = data.get("nextPageToken")
+        pages += 1
+        if not page_token or pages >= MAX_LIST_PAGES:
+            break
+
+
+def gcs_api_list(obj_prefix, delimiter=None):
+    """List objects under obj_prefix via the public GCS JSON API.
+
+    Follows pagination. Returns (items, prefixes) where:
+      - items    is a list of full object-name strings under obj_prefix
+      - prefixes is a list of immediate sub-directory prefixes (only populated
+        when delimiter="/" is passed)
+    """
+    items = []
+    prefixes = []
+    for data in _gcs_api_pages(obj_prefix, delimiter):
         for item in data.get("items", []):
             name = item.get("name")
             if name is not None:
                 items.append(name)
         prefixes.extend(data.get("prefixes", []))
-        page_token = data.get("nextPageToken")
-        pages += 1
-        if not page_token or pages >= MAX_LIST_PAGES:
-            break
     return items, prefixes
 
 
+def gcs_api_sizes(obj_prefix):
+    """Return {object-name: size-in-bytes} for every object under obj_prefix."""
+    sizes = {}
+    for data in _gcs_api_pages(obj_prefix):
+        for item in data.get("items", []):
+            name = item.get("name")
+            if name is not None:
+                sizes[name] = int(item.get("size", 0))
+    return sizes
+
+
 def glob_to_regex(pattern):
     """Translate a gcloud/gsutil-style glob into an anchored regex.
 
@@ -271,18 +306,22 @@ def _http_search_lines(prefix, pattern, subpath=None):
         search_root += "/"
 
     items, _ = gcs_api_list(search_root, delimiter=None)
-    regex = re.compile(glob_to_regex(pattern))
+    return [f"gs://{BUCKET}/{name}" for name in match_objects(search_root, items, pattern)]
 
-    lines = set()
-    for name in items:
+
+def match_objects(search_root, names, pattern):
+    """Return the sorted object names under search_root whose relative path matches the glob."""
+    regex = re.compile(glob_to_regex(pattern))
+    matched = set()
+    for name in names:
         if not name.startswith(search_root):
             continue
         rel = name[len(search_root):]
         if not rel or rel.endswith("/"):
             continue  # skip the search root itself and directory placeholders
         if regex.match(rel):
-            lines.add(f"gs://{BUCKET}/{name}")
-    return sorted(lines)
+            matched.add(name)
+    return sorted(matched)
 
 
 def _http_fetch(obj_path, max_bytes):
@@ -511,6 +550,201 @@ def cmd_fetch(prefix, filepath, max_bytes=DEFAULT_MAX_BYTES):
         }
 
 
+def _gcloud_search_sizes(search_pattern):
+    """Return {gs-uri: size} for a gcloud wildcard listing, or None on error."""
+    stdout, stderr, rc = run_gcloud(["storage", "ls", "-l", search_pattern], timeout=120)
+    if rc != 0:
+        if "matched no objects" in stderr.lower():
+            return {}
+        return None
+    sizes = {}
+    for line in stdout.splitlines():
+        # "   12345  2024-05-01T12:00:00Z  gs://bucket/path"; the TOTAL line has no URI
+        m = re.match(r"^\s*(\d+)\s+\S+\s+(gs://\S+)\s*$", line)
+        if m and not m.group(2).endswith("/"):
+            sizes[m.group(2)] = int(m.group(1))
+    return sizes
+
+
+def _http_download(obj_path, local_path, on_bytes=None):
+    """Download an object to local_path, resuming a previous partial download.
+
+    Data is written to ``<local_path>.part`` and renamed when complete, so an
+    existing ``local_path`` always holds a finished file. If the server ignores
+    the Range request (gzip-stored objects served with decompressive
+    transcoding do), the download restarts from the beginning. on_bytes, if
+    given, is called with the size of each chunk written, and of the partial
+    file when resuming.
+    """
+    partial = local_path + PARTIAL_SUFFIX
+    offset = os.path.getsize(partial) if os.path.exists(partial) else 0
+    url = f"{GCS_DOWNLOAD_ROOT}/{BUCKET}/{urllib.parse.quote(obj_path)}"
+    headers = dict(HTTP_HEADERS)
+    if offset:
+        headers["Range"] = f"bytes={offset}-"
+    req = urllib.request.Request(url, headers=headers)
+    try:
+        resp = urllib.request.urlopen(req, timeout=HTTP_TIMEOUT)
+    except urllib.error.HTTPError as e:
+        if e.code == 416 and offset:
+            # The partial file already holds the whole object
+            os.replace(partial, local_path)
+            if on_bytes:
+                on_bytes(offset)
+            return offset
+        raise
+    with resp:
+        mode = "ab" if resp.status == 206 else "wb"
+        if on_bytes and mode == "ab":
+            on_bytes(offset)
+        with open(partial, mode) as f:
+            while True:
+                chunk = resp.read(DOWNLOAD_CHUNK)
+                if not chunk:
+                    break
+                f.write(chunk)
+                if on_bytes:
+                    on_bytes(len(chunk))
+    os.replace(partial, local_path)
+    return os.path.getsize(local_path)
+
+
+def cmd_download(prefix, pattern, subpath=None, dest=".", max_size=None, max_total=None, dry_run=False,
+                 show_progress=False):
+    """Download files matching a glob pattern, within per-file and total size limits.
+
+    With show_progress, NDJSON events go to stderr: phase "bytes" for each chunk
+    received and phase "files" as each file finishes or fails.
+    """
+    target = gcs_path(prefix, subpath)
+    if not target.endswith("/"):
+        target += "/"
+    search_pattern = f"{target}{pattern}"
+    full_prefix = f"gs://{BUCKET}/{prefix}/"
+
+    if gcloud_available():
+        sizes = _gcloud_search_sizes(search_pattern)
+        if sizes is None:
+            return {
+                "success": False,
+                "error": "gcloud storage ls failed",
+                "pattern": search_pattern,
+            }
+    else:
+        search_root = object_path(prefix, subpath) + "/"
+        try:
+            all_sizes = gcs_api_sizes(search_root)
+        except (urllib.error.URLError, OSError, ValueError) as e:
+            return {
+                "success": False,
+                "error": f"GCS API list failed: {e}",
+                "pattern": search_pattern,
+            }
+        sizes = {
+            f"gs://{BUCKET}/{name}": all_sizes[name]
+            for name in match_objects(search_root, all_sizes.keys(), pattern)
+        }
+
+    downloaded, cached, skipped, failed, todo = [], [], [], [], []
+    planned = 0
+    over_budget = False
+    dest_root = os.path.realpath(dest)
+    sizes_file = os.path.join(dest, SIZES_FILE)
+    try:
+        with open(sizes_file) as f:
+            known_sizes = json.load(f)
+    except (OSError, ValueError):
+        known_sizes = {}
+    for uri in sorted(sizes):
+        size = sizes[uri]
+        relative = uri[len(full_prefix):] if uri.startswith(full_prefix) else uri.split("/", 3)[-1]
+        local_path = os.path.join(dest, relative)
+        entry = {"path": relative, "size_bytes": size, "local_path": local_path}
+
+        # Object names are untrusted: "../" or a leading "/" must not write outside --dest
+        if not os.path.realpath(local_path).startswith(dest_root.rstrip(os.sep) + os.sep):
+            skipped.append(dict(entry, reason="object name resolves outside --dest"))
+            continue
+        if os.path.exists(local_path):
+            # A file of another size is truncated or from another upload of the object, so fetch it again
+            local_size = os.path.getsize(local_path)
+            if local_size == size or known_sizes.get(relative) == [size, local_size]:
+                cached.append(entry)
+                continue
+            entry["replaces_bytes"] = local_size
+        if max_size is not None and size > max_size:
+            skipped.append(dict(entry, reason=f"larger than --max-size ({max_size} bytes)"))
+            continue
+        # Files are taken in path order up to the first one that does not fit, so that
+        # a rerun with a larger budget continues where this one stopped
+        if max_total is not None and (over_budget or planned + size > max_total):
+            over_budget = True
+            skipped.append(dict(entry, reason=f"--max-total ({max_total} bytes) reached"))
+            continue
+        planned += size
+        todo.append((uri, entry))
+
+    total = 0
+    if dry_run:
+        downloaded = [entry for _uri, entry in todo]
+        total, todo = planned, []
+    received = 0
+    started = time.time()
+
+    def on_bytes(count, relative):
+        nonlocal received
+        received += count
+        if show_progress:
+            progress("bytes", received, planned, started, relative)
+
+    for i, (uri, entry) in enumerate(todo):
+        relative, local_path, size = entry["path"], entry["local_path"], entry["size_bytes"]
+        os.makedirs(os.path.dirname(local_path) or ".", exist_ok=True)
+        try:
+            if gcloud_available():
+                # gcloud resumes interrupted downloads of large objects by itself
+                _stdout, stderr, rc = run_gcloud(
+                    ["storage", "cp", uri, local_path + PARTIAL_SUFFIX, "--no-user-output-enabled"],
+                    timeout=max(600, size // (1024 * 1024)),
+                )
+                if rc != 0:
+                    raise OSError(stderr.strip())
+                os.replace(local_path + PARTIAL_SUFFIX, local_path)
+                on_bytes(size, relative)
+            else:
+                _http_download(object_path(prefix, relative), local_path, lambda n: on_bytes(n, relative))
+            total += size
+            downloaded.append(entry)
+            local_size = os.path.getsize(local_path)
+            if local_size != size:
+                known_sizes[relative] = [size, local_size]
+            else:
+                known_sizes.pop(relative, None)
+        except (urllib.error.URLError, OSError, ValueError) as e:
+            failed.append(dict(entry, error=str(e)))
+        if show_progress:
+            progress("files", i + 1, len(todo), started, relative)
+    if todo:
+        try:
+            with open(sizes_file, "w") as f:
+                json.dump(known_sizes, f, indent=1, sort_keys=True)
+        except OSError as e:
+            print(f"Warning: cannot write {sizes_file}: {e}", file=sys.stderr)
+
+    return {
+        "success": not failed,
+        "pattern": search_pattern,
+        "dest": dest,
+        "dry_run": dry_run,
+        "matched": len(sizes),
+        "downloaded_bytes": total,
+        "downloaded": downloaded,
+        "cached": cached,
+        "skipped": skipped,
+        "failed": failed,
+    }
+
+
 def main():
     parser = argparse.ArgumentParser(
         description=(
@@ -561,6 +795,50 @@ def main():
         help=f"Maximum bytes to read (default: {DEFAULT_MAX_BYTES})",
     )
 
+    # download
+    download_parser = subparsers.add_parser(
+        "download",
+        help="Download files matching a glob pattern to disk (resumable)",
+    )
+    download_parser.add_argument(
+        "pattern",
+        help='Glob pattern to match (e.g., "**/gather-extra/**/*.log")',
+    )
+    download_parser.add_argument(
+        "subpath",
+        nargs="?",
+        default=None,
+        help="Subdirectory to search within (optional, searches from job root by default)",
+    )
+    download_parser.add_argument(
+        "--dest",
+        required=True,
+        help="Local directory; files keep their path relative to the job root",
+    )
+    download_parser.add_argument(
+        "--max-size",
+        default=DEFAULT_MAX_SIZE,
+        help=f"Skip files larger than this, e.g. 512K, 50M, 2G; 0 for no limit (default: {DEFAULT_MAX_SIZE})",
+    )
+    download_parser.add_argument(
+        "--max-total",
+        default=None,
+        help=(
+            "Download files in path order until the next one would exceed this total; "
+            "it and all later files are skipped (default: no limit)"
+        ),
+    )
+    download_parser.add_argument(
+        "--dry-run",
+        action="store_true",
+        help="Only report what would be downloaded",
+    )
+    download_parser.add_argument(
+        "--progress",
+        action="store_true",
+        help="Print NDJSON progress events on stderr, per chunk and per file",
+    )
+
     args = parser.parse_args()
 
     try:
@@ -575,6 +853,16 @@ def main():
         result = cmd_search(prefix, args.pattern, args.subpath)
     elif args.command == "fetch":
         result = cmd_fetch(prefix, args.filepath, args.max_bytes)
+    elif args.command == "download":
+        try:
+            max_size = parse_size(args.max_size) or None
+            max_total = parse_size(args.max_total) if args.max_total else None
+        except ValueError as e:
+            print(json.dumps({"success": False, "error": str(e)}))
+            sys.exit(1)
+        result = cmd_download(
+            prefix, args.pattern, args.subpath, args.dest, max_size, max_total, args.dry_run, args.progress
+        )
     else:
         print(json.dumps({"success": False, "error": f"Unknown command: {args.command}"}))
         sys.exit(1)
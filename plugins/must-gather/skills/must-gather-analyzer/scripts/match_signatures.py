@@ -0,0 +1,510 @@
+#!/usr/bin/env python3
+"""
+Match logs against the known-issue signature database.
+Signatures are YAML rule files that map regexes to known issues, Jira
+links, and remediations. Used by the must-gather, node log (sosreport),
+and install log analyzers, and with --watch against the events and
+ClusterOperator conditions of a live cluster.
+"""
+
+import sys
+import os
+import re
+import gzip
+import collections
+import json
+import argparse
+import yaml
+import fnmatch
+import queue
+import subprocess
+import tempfile
+import threading
+import time
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Dict, List, Optional, Any, Tuple
+
+from ai_helpers_events import notify
+
+DEFAULT_SIGNATURES_DIR = Path(__file__).resolve().parent.parent / 'signatures'
+
+SOURCES = ['must-gather', 'node-log', 'install-log', 'cluster-events']
+# Command named in webhook payloads when the caller does not pass --notify-command
+NOTIFY_COMMANDS = {'must-gather': 'must-gather:analyze', 'node-log': 'sosreport:analyze',
+                   'install-log': 'openshift:install-failure', 'cluster-events': 'openshift:watch-cluster'}
+SEVERITIES = ['critical', 'warning', 'info']
+REQUIRED_KEYS = ['id', 'title', 'sources', 'severity', 'match', 'remediation']
+
+# Files larger than this (uncompressed, for .gz files) are only scanned in
+# their last MAX_SCAN_BYTES.
+MAX_SCAN_BYTES = 64 * 1024 * 1024
+MAX_SAMPLES = 3
+
+
+def validate_signature(sig: Any, origin: str) -> List[str]:
+    """Return a list of problems with a signature definition."""
+    if not isinstance(sig, dict):
+        return [f"{origin}: signature entries must be mappings, got {type(sig).__name__}: {sig!r:.60}"]
+    errors = []
+    sid = sig.get('id', '<missing id>')
+    for key in REQUIRED_KEYS:
+        if key not in sig:
+            errors.append(f"{origin}: {sid}: missing required key '{key}'")
+    for source in sig.get('sources') or []:
+        if source not in SOURCES:
+            errors.append(f"{origin}: {sid}: unknown source '{source}' (expected one of {', '.join(SOURCES)})")
+    if sig.get('severity') and sig['severity'] not in SEVERITIES:
+        errors.append(f"{origin}: {sid}: unknown severity '{sig['severity']}'")
+
+    match = sig.get('match') or {}
+    if not isinstance(match, dict) or not (match.get('any') or match.get('all')):
+        errors.append(f"{origin}: {sid}: 'match' needs an 'any' or 'all' list of regexes")
+    else:
+        for pattern in (match.get('any') or []) + (match.get('all') or []) + (match.get('none') or []):
+            try:
+                re.compile(pattern)
+            except re.error as e:
+                errors.append(f"{origin}: {sid}: invalid regex {pattern!r}: {e}")
+    return errors
+
+
+def load_signatures(dirs: List[Path]) -> Tuple[List[Dict[str, Any]], List[str]]:
+    """Load and validate all *.yaml signature files from the given directories."""
+    signatures = []
+    errors = []
+    seen_ids = {}
+
+    for directory in dirs:
+        if not directory.is_dir():
+            errors.append(f"{directory}: signatures directory not found")
+            continue
+        for file_path in sorted(directory.glob('*.yaml')):
+            try:
+                with open(file_path, 'r') as f:
+                    data = yaml.safe_load(f) or {}
+            except yaml.YAMLError as e:
+                errors.append(f"{file_path}: invalid YAML: {e}")
+                continue
+
+            if not isinstance(data, dict) or not isinstance(data.get('signatures') or [], list):
+                errors.append(f"{file_path.name}: expected a mapping with a 'signatures' list at the top level")
+                continue
+            for sig in data.get('signatures') or []:
+                problems = validate_signature(sig, file_path.name)
+                if problems:
+                    errors.extend(problems)
+                    continue
+                if sig['id'] in seen_ids:
+                    errors.append(f"{file_path.name}: {sig['id']}: duplicate id (also in {seen_ids[sig['id']]})")
+                    continue
+                seen_ids[sig['id']] = file_path.name
+                sig['_file'] = file_path.name
+                sig['_any'] = [re.compile(p) for p in sig['match'].get('any') or []]
+                sig['_all'] = [re.compile(p) for p in sig['match'].get('all') or []]
+                sig['_none'] = [re.compile(p) for p in sig['match'].get('none') or []]
+                signatures.append(sig)
+
+    return signatures, errors
+
+
+def iter_files(target: Path):
+    """Yield every regular file under target (or target itself)."""
+    if target.is_file():
+        yield target
+        return
+    for file_path in sorted(target.rglob('*')):
+        if file_path.is_file() and not file_path.is_symlink():
+            yield file_path
+
+
+def read_text(file_path: Path) -> Optional[str]:
+    """Read a text or gzip log file, skipping binary data."""
+    try:
+        if file_path.suffix == '.gz':
+            # The uncompressed size is unknown up front; keep a rolling tail
+            chunks, kept = collections.deque(), 0
+            with gzip.open(file_path, 'rb') as f:
+                for chunk in iter(lambda: f.read(1024 * 1024), b''):
+                    chunks.append(chunk)
+                    kept += len(chunk)
+                    while kept - len(chunks[0]) >= MAX_SCAN_BYTES:
+                        kept -= len(chunks.popleft())
+            data = b''.join(chunks)[-MAX_SCAN_BYTES:]
+        else:
+            size = file_path.stat().st_size
+            with open(file_path, 'rb') as f:
+                if size > MAX_SCAN_BYTES:
+                    f.seek(size - MAX_SCAN_BYTES)
+                data = f.read()
+    except (OSError, EOFError):
+        return None
+    if b'\x00' in data[:8192]:
+        return None
+    return data.decode('utf-8', errors='replace')
+
+
+def file_applies(sig: Dict[str, Any], rel_path: str) -> bool:
+    """Check the signature's optional 'files' globs against a relative path."""
+    globs = sig.get('files')
+    if not globs:
+        return True
+    return any(fnmatch.fnmatch(rel_path, g) for g in globs)
+
+
+def match_text(sig: Dict[str, Any], text: str) -> List[str]:
+    """Return matching lines if the signature matches this text, else []."""
+    if any(p.search(text) for p in sig['_none']):
+        return []
+    if not all(p.search(text) for p in sig['_all']):
+        return []
+
+    patterns = sig['_any'] or sig['_all']
+    hits = []
+    for line in text.splitlines():
+        if any(p.search(line) for p in patterns):
+            hits.append(line.strip())
+    if len(hits) < sig['match'].get('min_count', 1):
+        return []
+    return hits
+
+
+def new_result(sig: Dict[str, Any]) -> Dict[str, Any]:
+    return {
+        'id': sig['id'],
+        'title': sig['title'],
+        'severity': sig['severity'],
+        'remediation': ' '.join(sig['remediation'].split()),
+        'jira': sig.get('jira') or [],
+        'references': sig.get('references') or [],
+        'signature_file': sig['_file'],
+        'count': 0,
+        'files': [],
+        'samples': [],
+    }
+
+
+def scan(target: Path, signatures: List[Dict[str, Any]], source: str) -> List[Dict[str, Any]]:
+    """Scan target for all signatures that apply to the given source type."""
+    applicable = [s for s in signatures if source in s['sources']]
+    results: Dict[str, Dict[str, Any]] = {}
+
+    for file_path in iter_files(target):
+        rel_path = str(file_path.relative_to(target)) if target.is_dir() else file_path.name
+        candidates = [s for s in applicable if file_applies(s, rel_path)]
+        if not candidates:
+            continue
+        text = read_text(file_path)
+        if text is None:
+            continue
+
+        for sig in candidates:
+            hits = match_text(sig, text)
+            if not hits:
+                continue
+            result = results.setdefault(sig['id'], new_result(sig))
+            result['count'] += len(hits)
+            result['files'].append(rel_path)
+            for hit in hits:
+                if len(result['samples']) >= MAX_SAMPLES:
+                    break
+                if hit not in result['samples']:
+                    result['samples'].append(hit[:300])
+
+    order = {s: i for i, s in enumerate(SEVERITIES)}
+    return sorted(results.values(), key=lambda r: (order[r['severity']], -r['count']))
+
+
+class StreamMatcher:
+    """Match signatures line by line against a stream, such as live cluster events.
+
+    In a stream there is no file to hold 'all' and 'none' patterns, so they
+    apply per line: a line is a hit when it matches every 'all' pattern, an
+    'any' pattern if there are any, and no 'none' pattern. A signature alerts
+    once, on the hit that reaches its min_count; later hits only add to the
+    count.
+    """
+
+    def __init__(self, signatures: List[Dict[str, Any]], source: str):
+        self.signatures = [s for s in signatures if source in s['sources']]
+        self.results: Dict[str, Dict[str, Any]] = {}
+
+    def feed(self, line: str, origin: str = '') -> List[Dict[str, Any]]:
+        """Match one line and return the results of signatures that alert on it."""
+        alerts = []
+        for sig in self.signatures:
+            if any(p.search(line) for p in sig['_none']):
+                continue
+            if not all(p.search(line) for p in sig['_all']):
+                continue
+            if sig['_any'] and not any(p.search(line) for p in sig['_any']):
+                continue
+            result = self.results.setdefault(sig['id'], new_result(sig))
+            result['count'] += 1
+            if origin and origin not in result['files']:
+                result['files'].append(origin)
+            if len(result['samples']) < MAX_SAMPLES and line.strip() not in result['samples']:
+                result['samples'].append(line.strip()[:300])
+            if result['count'] == sig['match'].get('min_count', 1):
+                alerts.append(result)
+        return alerts
+
+    def matched(self) -> List[Dict[str, Any]]:
+        """Return the signatures that reached their min_count, most severe first."""
+        by_id = {s['id']: s for s in self.signatures}
+        done = [r for r in self.results.values() if r['count'] >= by_id[r['id']]['match'].get('min_count', 1)]
+        order = {s: i for i, s in enumerate(SEVERITIES)}
+        return sorted(done, key=lambda r: (order[r['severity']], -r['count']))
+
+
+def event_line(event: Dict[str, Any]) -> Tuple[str, str]:
+    """Format a Kubernetes Event as one matchable line and its origin."""
+    obj = event.get('involvedObject') or {}
+    origin = f"{obj.get('namespace') or event.get('metadata', {}).get('namespace', '')}/" \
+             f"{obj.get('kind', '')}/{obj.get('name', '')}"
+    message = ' '.join((event.get('message') or '').split())
+    return f"event {origin} {event.get('type', '')} {event.get('reason', '')}: {message}", origin
+
+
+def clusteroperator_lines(co: Dict[str, Any], previous: Dict[str, Tuple[str, str]]) -> List[Tuple[str, str]]:
+    """Format the changed conditions of a ClusterOperator as matchable lines.
+
+    previous maps "operator/Type" to the last seen (status, reason) and is updated.
+    """
+    name = co.get('metadata', {}).get('name', '')
+    lines = []
+    for cond in co.get('status', {}).get('conditions') or []:
+        key = f"{name}/{cond.get('type')}"
+        state = (cond.get('status', ''), cond.get('reason', ''))
+        if previous.get(key) == state:
+            continue
+        healthy = (cond.get('type') in ('Available', 'Upgradeable') and state[0] == 'True') or \
+                  (cond.get('type') in ('Degraded', 'Progressing') and state[0] == 'False')
+        first = key not in previous
+        previous[key] = state
+        if first and healthy:
+            continue
+        message = ' '.join((cond.get('message') or '').split())
+        lines.append((f"clusteroperator {name} {cond.get('type')}={state[0]} {state[1]}: {message}",
+                      f"clusteroperator/{name}"))
+    return lines
+
+
+def read_objects(argv: List[str], kind: str, out: 'queue.Queue[Tuple[str, Any]]'):
+    """Run an 'oc get --watch -o json' command and queue each object it prints.
+
+    The API server closes watches after a while; the command is restarted then,
+    with --watch-only so events are not read twice.
+    """
+    decoder = json.JSONDecoder()
+    while True:
+        try:
+            # stderr goes to a file: a pipe nobody reads would block a chatty oc
+            errors = tempfile.TemporaryFile(mode='w+')
+            proc = subprocess.Popen(argv, stdout=subprocess.PIPE, stderr=errors, universal_newlines=True)
+        except FileNotFoundError:
+            errors.close()
+            out.put(('error', f"{argv[0]} not found in PATH"))
+            return
+        buffer = ''
+        for chunk in iter(lambda: proc.stdout.readline(), ''):
+            buffer += chunk
+            while buffer.strip():
+                try:
+                    obj, end = decoder.raw_decode(buffer.lstrip())
+                except ValueError:
+                    break
+                buffer = buffer.lstrip()[end:]
+                for item in obj.get('items', []) if obj.get('kind', '').endswith('List') else [obj]:
+                    out.put((kind, item))
+        proc.wait()
+        errors.seek(0)
+        message = errors.read().strip()[-300:]
+        errors.close()
+        if proc.returncode != 0:
+            out.put(('error', f"{' '.join(argv[:3])} exited with {proc.returncode}: {message}"))
+            return
+        if kind == 'event' and '--watch-only' not in argv:
+            argv = argv[:-2] + ['--watch-only'] + argv[-2:]
+        time.sleep(1)
+
+
+def print_alert(result: Dict[str, Any], as_json: bool):
+    """Print one alert as soon as a signature reaches its min_count."""
+    now = datetime.now().strftime('%H:%M:%S')
+    if as_json:
+        print(json.dumps(dict(result, time=datetime.now().isoformat(timespec='seconds'),
+                              sample=result['samples'][-1])), flush=True)
+        return
+    icons = {'critical': '❌', 'warning': '⚠️ ', 'info': 'ℹ️ '}
+    print(f"[{now}] {icons[result['severity']]} [{result['severity'].upper()}] {result['title']} ({result['id']})")
+    print(f"   > {result['samples'][-1]}")
+    for jira in result['jira']:
+        print(f"   Jira: https://issues.redhat.com/browse/{jira}")
+    print(f"   → {result['remediation']}", flush=True)
+
+
+def watch(matcher: StreamMatcher, context: Optional[str], duration: Optional[int],
+          history: bool, as_json: bool, verbose: bool):
+    """Match live cluster events and ClusterOperator transitions until interrupted or duration."""
+    oc = ['oc'] + ([f"--context={context}"] if context else [])
+    events = oc + ['get', 'events', '--all-namespaces', '--watch', '-o', 'json']
+    if not history:
+        events.insert(-2, '--watch-only')
+    objects: 'queue.Queue[Tuple[str, Any]]' = queue.Queue()
+    for argv, kind in ((events, 'event'), (oc + ['get', 'clusteroperators', '--watch', '-o', 'json'], 'co')):
+        threading.Thread(target=read_objects, args=(argv, kind, objects), daemon=True).start()
+
+    conditions: Dict[str, Tuple[str, str]] = {}
+    deadline = time.monotonic() + duration if duration else None
+    running = 2
+    while running:
+        timeout = max(0.0, deadline - time.monotonic()) if deadline else None
+        try:
+            kind, obj = objects.get(timeout=timeout)
+        except queue.Empty:
+            break
+        if kind == 'error':
+            print(f"Error: {obj}", file=sys.stderr)
+            running -= 1
+            continue
+        lines = [event_line(obj)] if kind == 'event' else clusteroperator_lines(obj, conditions)
+        for line, origin in lines:
+            if verbose and not as_json:
+                print(f"  {line[:200]}", flush=True)
+            for alert in matcher.feed(line, origin):
+                print_alert(alert, as_json)
+        if deadline and time.monotonic() >= deadline:
+            break
+
+
+def print_results(results: List[Dict[str, Any]], source: str, total: int):
+    """Print matched signatures in human-readable form."""
+    print(f"{'=' * 80}")
+    print(f"KNOWN ISSUE SIGNATURES ({source})")
+    print(f"{'=' * 80}\n")
+    print(f"Signatures checked: {total}")
+    print(f"Signatures matched: {len(results)}\n")
+
+    icons = {'critical': '❌', 'warning': '⚠️ ', 'info': 'ℹ️ '}
+    for r in results:
+        print(f"{icons[r['severity']]} [{r['severity'].upper()}] {r['title']} ({r['id']})")
+        print(f"   Matches: {r['count']} in {len(r['files'])} file(s)")
+        for f in r['files'][:MAX_SAMPLES]:
+            print(f"     {f}")
+        if len(r['files']) > MAX_SAMPLES:
+            print(f"     ... and {len(r['files']) - MAX_SAMPLES} more")
+        for sample in r['samples']:
+            print(f"   > {sample}")
+        for jira in r['jira']:
+            print(f"   Jira: https://issues.redhat.com/browse/{jira}")
+        for ref in r['references']:
+            print(f"   See: {ref}")
+        print(f"   → {r['remediation']}\n")
+
+    if not results:
+        print("No known issue signatures matched.")
+
+
+def notify_results(url: str, fmt: str, results: List[Dict[str, Any]], source: str, total: int, command: str):
+    """POST the matched signatures when a scan or watch finishes, on behalf of command."""
+    if fmt == 'slack':
+        lines = [f"*Known issue signatures* ({source}): {len(results)} of {total} matched"]
+        lines.extend(f"• {r['severity']}: {r['title']} (`{r['id']}`, {r['count']} matches)" for r in results)
+        payload = {'text': '\n'.join(lines)}
+    else:
+        payload = {
+            'command': command,
+            'status': 'attention' if any(r['severity'] != 'info' for r in results) else 'ok',
+            'exitCode': 0,
+            'finished': datetime.now(timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ'),
+            'result': {'source': source, 'checked': total, 'matches': results},
+        }
+    notify(url, payload)
+
+
+def main():
+    parser = argparse.ArgumentParser(
+        description='Match logs against the known-issue signature database',
+        formatter_class=argparse.RawDescriptionHelpFormatter,
+        epilog="""
+Examples:
+  %(prog)s ./must-gather.local.123456789
+  %(prog)s ./sosreport-node1 --source node-log
+  %(prog)s ./.openshift_install.log --source install-log
+  %(prog)s ./must-gather.local.123 --signatures-dir ./my-team-signatures
+  %(prog)s --validate --signatures-dir ./my-team-signatures
+  %(prog)s --watch --duration 3600
+  %(prog)s ./must-gather.local.123 --notify-webhook env:SLACK_WEBHOOK_URL --notify-format slack
+        """
+    )
+
+    parser.add_argument('path', nargs='?', help='Must-gather directory, sosreport directory, or log file')
+    parser.add_argument('--source', choices=SOURCES, default='must-gather',
+                        help='Kind of data being scanned (default: must-gather)')
+    parser.add_argument('--signatures-dir', action='append', default=[], type=Path,
+                        help='Additional directory of signature YAML files (repeatable)')
+    parser.add_argument('--json', action='store_true', help='Output results as JSON')
+    parser.add_argument('--validate', action='store_true',
+                        help='Only validate the signature files and exit')
+    parser.add_argument('--watch', action='store_true',
+                        help='Match the events and ClusterOperator conditions of the current oc cluster as they happen')
+    parser.add_argument('--context', help='With --watch: kubeconfig context to watch')
+    parser.add_argument('--duration', type=int, help='With --watch: stop after this many seconds')
+    parser.add_argument('--history', action='store_true',
+                        help='With --watch: also match the events that already exist')
+    parser.add_argument('--verbose', action='store_true', help='With --watch: print every line as it is matched')
+    parser.add_argument('--notify-webhook', metavar='URL',
+                        help='POST the matches here when the scan or watch ends (or env:VARIABLE)')
+    parser.add_argument('--notify-format', choices=['json', 'slack'], default='json')
+    parser.add_argument('--notify-command', metavar='NAME',
+                        help='Command named in the JSON payload (default: the one for --source, '
+                             'e.g. must-gather:analyze)')
+
+    args = parser.parse_args()
+
+    signatures, errors = load_signatures([DEFAULT_SIGNATURES_DIR] + args.signatures_dir)
+    for error in errors:
+        print(f"Error: {error}", file=sys.stderr)
+
+    if args.validate:
+        if not errors:
+            print(f"{len(signatures)} signatures OK")
+        return 1 if errors else 0
+
+    if args.watch:
+        matcher = StreamMatcher(signatures, 'cluster-events')
+        try:
+            watch(matcher, args.context, args.duration, args.history, args.json, args.verbose)
+        except KeyboardInterrupt:
+            pass
+        if not args.json:
+            print()
+            print_results(matcher.matched(), 'cluster-events', len(matcher.signatures))
+        if args.notify_webhook:
+            notify_results(args.notify_webhook, args.notify_format, matcher.matched(), 'cluster-events',
+                           len(matcher.signatures), args.notify_command or NOTIFY_COMMANDS['cluster-events'])
+        return 0
+
+    if not args.path:
+        parser.error('path is required unless --validate or --watch is given')
+    if not os.path.exists(args.path):
+        print(f"Error: Path not found: {args.path}", file=sys.stderr)
+        return 1
+
+    results = scan(Path(args.path), signatures, args.source)
+    total = len([s for s in signatures if args.source in s['sources']])
+
+    if args.json:
+        print(json.dumps({'source': args.source, 'checked': total, 'matches': results}, indent=2))
+    else:
+        print_results(results, args.source, total)
+    if args.notify_webhook:
+        notify_results(args.notify_webhook, args.notify_format, results, args.source, total,
+                       args.notify_command or NOTIFY_COMMANDS[args.source])
+
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
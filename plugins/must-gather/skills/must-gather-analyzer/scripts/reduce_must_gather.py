@@ -0,0 +1,247 @@
+#!/usr/bin/env python3
+"""
+Reduce the size of must-gather data so it can be attached to a Jira issue.
+Strips redundant data (managedFields, duplicate insecure logs, rotated logs),
+tails pod logs, and packs the result into a tar.gz under a size budget.
+"""
+
+import sys
+import os
+import argparse
+import hashlib
+import re
+import shutil
+import tarfile
+import yaml
+from pathlib import Path
+from typing import Dict, List, Optional
+
+from ai_helpers_units import format_size, parse_size
+
+
+# Directories that are only useful for specific investigations. They are
+# dropped unless the caller asks to keep them with --keep.
+OPTIONAL_DIRS = {
+    'audit_logs': 'kube-apiserver/openshift-apiserver/oauth audit logs',
+    'monitoring': 'Prometheus rules, targets, and TSDB status',
+    'network_logs': 'OVN databases and network diagnostics',
+    'windows': 'Windows node logs',
+    'host_service_logs': 'journal logs for kubelet/crio',
+    'etcd_info': 'etcd member and endpoint status',
+}
+
+
+def size_arg(value: str) -> int:
+    try:
+        return parse_size(value)
+    except ValueError as e:
+        raise argparse.ArgumentTypeError(str(e))
+
+
+# Rotations of a log (kubelet.log.1, current.log.20240601-120000.gz). A
+# compressed log without a number, like <node>-audit.log.gz, is the log itself.
+ROTATED = re.compile(r'\.log\.\d')
+
+
+def dir_size(path: Path) -> int:
+    """Total size of all files under a directory."""
+    return sum(f.stat().st_size for f in path.rglob('*') if f.is_file())
+
+
+def strip_managed_fields(doc):
+    """Remove metadata.managedFields from a resource or list of resources."""
+    if isinstance(doc, dict):
+        metadata = doc.get('metadata')
+        if isinstance(metadata, dict):
+            metadata.pop('managedFields', None)
+        for item in doc.get('items') or []:
+            strip_managed_fields(item)
+    return doc
+
+
+def reduce_yaml(file_path: Path) -> int:
+    """Strip managedFields from a YAML file in place. Returns bytes saved."""
+    before = file_path.stat().st_size
+    if b'managedFields' not in file_path.read_bytes():
+        return 0
+    try:
+        with open(file_path, 'r') as f:
+            docs = [strip_managed_fields(d) for d in yaml.safe_load_all(f)]
+    except Exception as e:
+        print(f"Warning: Failed to parse {file_path}: {e}", file=sys.stderr)
+        return 0
+    with open(file_path, 'w') as f:
+        yaml.safe_dump_all(docs, f, default_flow_style=False, sort_keys=False)
+    return before - file_path.stat().st_size
+
+
+def tail_file(file_path: Path, lines: int) -> int:
+    """Keep only the last N lines of a log file. Returns bytes saved."""
+    before = file_path.stat().st_size
+    with open(file_path, 'rb') as f:
+        content = f.read().splitlines(keepends=True)
+    if len(content) <= lines:
+        return 0
+    dropped = len(content) - lines
+    with open(file_path, 'wb') as f:
+        f.write(f"... [{dropped} earlier lines removed by reduce_must_gather.py]\n".encode())
+        f.writelines(content[-lines:])
+    return before - file_path.stat().st_size
+
+
+def in_kept_dir(path: Path, base_path: Path, keep: List[str]) -> bool:
+    """Whether path is under an optional directory the caller asked to keep."""
+    return any(part in keep for part in path.relative_to(base_path).parts[:-1])
+
+
+def remove_duplicates(base_path: Path, keep: List[str], stats: Dict[str, int]):
+    """Remove insecure/rotated logs and logs that duplicate another file's content."""
+    # current.insecure.log is collected when the secure log fetch fails; keep it
+    # only if there is no current.log next to it.
+    for insecure in list(base_path.rglob('*.insecure.log')):
+        secure = insecure.with_name(insecure.name.replace('.insecure.log', '.log'))
+        if secure.exists():
+            stats['duplicates'] += insecure.stat().st_size
+            insecure.unlink()
+
+    # Rotated logs; a kept directory is kept whole
+    for rotated in list(base_path.rglob('*.log.*')):
+        if rotated.is_file() and ROTATED.search(rotated.name) and not in_kept_dir(rotated, base_path, keep):
+            stats['rotated'] += rotated.stat().st_size
+            rotated.unlink()
+
+    # Identical log content collected twice (small files are not worth hashing)
+    seen: Dict[str, Path] = {}
+    for log in sorted(base_path.rglob('*.log')):
+        if not log.is_file() or log.stat().st_size < 4096:
+            continue
+        digest = hashlib.sha256(log.read_bytes()).hexdigest()
+        if digest in seen:
+            stats['duplicates'] += log.stat().st_size
+            log.unlink()
+        else:
+            seen[digest] = log
+
+
+def reduce_tree(base_path: Path, tail_lines: int, drop_previous: bool,
+                keep: List[str], stats: Dict[str, int]):
+    """Apply all reductions to a working copy of the must-gather."""
+    for name in OPTIONAL_DIRS:
+        if name in keep:
+            continue
+        for d in base_path.glob(f'**/{name}'):
+            if d.is_dir():
+                stats['optional_dirs'] += dir_size(d)
+                shutil.rmtree(d)
+
+    remove_duplicates(base_path, keep, stats)
+
+    for yaml_file in base_path.rglob('*.yaml'):
+        stats['managed_fields'] += reduce_yaml(yaml_file)
+
+    for log in base_path.rglob('*.log'):
+        if drop_previous and log.name.startswith('previous'):
+            stats['previous_logs'] += log.stat().st_size
+            log.unlink()
+            continue
+        stats['log_tail'] += tail_file(log, tail_lines)
+
+
+def pack(base_path: Path, output: Path) -> int:
+    """Create a tar.gz of the reduced tree. Returns archive size."""
+    with tarfile.open(output, 'w:gz') as tar:
+        tar.add(base_path, arcname=base_path.name)
+    return output.stat().st_size
+
+
+def reduce_must_gather(must_gather_path: str, output: str, max_size: int,
+                       tail_lines: int = 5000, drop_previous: bool = False,
+                       keep: Optional[List[str]] = None, min_tail_lines: int = 200) -> int:
+    """Reduce a must-gather into an archive no larger than max_size."""
+    source = Path(must_gather_path)
+    keep = keep or []
+    original_size = dir_size(source)
+
+    work_dir = Path(output).parent / (Path(output).name + '.work')
+    if work_dir.exists():
+        shutil.rmtree(work_dir)
+    work_dir.mkdir(parents=True)
+    target = work_dir / source.resolve().name
+
+    lines = tail_lines
+    while True:
+        if target.exists():
+            shutil.rmtree(target)
+        shutil.copytree(source, target, symlinks=True)
+
+        stats = {k: 0 for k in ['optional_dirs', 'duplicates', 'rotated', 'managed_fields',
+                                'previous_logs', 'log_tail']}
+        reduce_tree(target, lines, drop_previous, keep, stats)
+        archive_size = pack(target, Path(output))
+
+        if archive_size <= max_size or lines <= min_tail_lines:
+            break
+        lines = max(min_tail_lines, lines // 2)
+        print(f"Archive is {format_size(archive_size)} (limit {format_size(max_size)}); "
+              f"retrying with {lines} log lines", file=sys.stderr)
+
+    shutil.rmtree(work_dir)
+
+    print(f"{'REDUCTION':<30} {'SAVED':>12}")
+    labels = {
+        'optional_dirs': 'Optional directories',
+        'duplicates': 'Duplicate/insecure logs',
+        'rotated': 'Rotated logs',
+        'managed_fields': 'managedFields',
+        'previous_logs': 'Previous container logs',
+        'log_tail': f'Log tail ({lines} lines)',
+    }
+    for key, label in labels.items():
+        if stats[key]:
+            print(f"{label:<30} {format_size(stats[key]):>12}")
+
+    print(f"\nOriginal size:  {format_size(original_size)}")
+    print(f"Archive size:   {format_size(archive_size)} ({output})")
+    if archive_size > max_size:
+        print(f"  ⚠️  Archive still exceeds the {format_size(max_size)} limit; "
+              f"use a narrower gather profile or --drop-previous")
+        return 2
+    print(f"  ✅ Within the {format_size(max_size)} limit")
+    return 0
+
+
+def main():
+    parser = argparse.ArgumentParser(
+        description='Reduce must-gather data to fit an attachment size limit',
+        formatter_class=argparse.RawDescriptionHelpFormatter,
+        epilog="""
+Examples:
+  %(prog)s ./must-gather/quay-io-...-sha256-abc -o mg-reduced.tar.gz
+  %(prog)s ./must-gather/quay-io-...-sha256-abc -o mg.tar.gz --max-size 10M
+  %(prog)s ./must-gather/quay-io-...-sha256-abc -o mg.tar.gz --keep network_logs
+        """
+    )
+
+    parser.add_argument('must_gather_path', help='Path to must-gather directory')
+    parser.add_argument('-o', '--output', required=True, help='Output archive path (.tar.gz)')
+    parser.add_argument('--max-size', type=size_arg, default=parse_size('50M'),
+                        help='Maximum archive size, e.g. 10M, 50MiB (default: 50M)')
+    parser.add_argument('--tail-lines', type=int, default=5000,
+                        help='Initial number of lines kept per log file (default: 5000)')
+    parser.add_argument('--drop-previous', action='store_true',
+                        help='Drop previous container logs (previous.log)')
+    parser.add_argument('--keep', action='append', default=[], choices=sorted(OPTIONAL_DIRS),
+                        help='Keep an optional directory (repeatable)')
+
+    args = parser.parse_args()
+
+    if not os.path.isdir(args.must_gather_path):
+        print(f"Error: Directory not found: {args.must_gather_path}", file=sys.stderr)
+        return 1
+
+    return reduce_must_gather(args.must_gather_path, args.output, args.max_size,
+                              args.tail_lines, args.drop_previous, args.keep)
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,165 @@
+#!/usr/bin/env python3
+"""Tests for the known-issue signature matcher."""
+
+import gzip
+import os
+import sys
+import tempfile
+from pathlib import Path
+
+sys.path.insert(0, os.path.dirname(__file__))
+import match_signatures
+from match_signatures import (DEFAULT_SIGNATURES_DIR, StreamMatcher, clusteroperator_lines, event_line,
+                              load_signatures, read_text, scan)
+
+
+def write(base, rel, content):
+    path = Path(base) / rel
+    path.parent.mkdir(parents=True, exist_ok=True)
+    path.write_text(content)
+    return path
+
+
+def matched_ids(target, signatures, source):
+    return {r['id'] for r in scan(Path(target), signatures, source)}
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+if __name__ == "__main__":
+    results = []
+
+    signatures, errors = load_signatures([DEFAULT_SIGNATURES_DIR])
+    results.append(test("bundled signatures load without errors", not errors and len(signatures) > 0))
+    for error in errors:
+        print(f"    {error}")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        mg = Path(tmp) / "mg"
+        etcd_log = "namespaces/openshift-etcd/pods/etcd-master-0/etcd/etcd/logs/current.log"
+        write(mg, etcd_log, "level=warn msg=\"slow fdatasync\" took=1.2s\n" * 12)
+        write(mg, "namespaces/app/pods/web/web/web/logs/current.log", "slow fdatasync\n" * 12)
+        ids = matched_ids(mg, signatures, "must-gather")
+        results.append(test("min_count reached in etcd logs matches", "etcd-slow-disk" in ids))
+
+        only_app = Path(tmp) / "mg-app"
+        write(only_app, "namespaces/app/pods/web/web/web/logs/current.log", "slow fdatasync\n" * 12)
+        results.append(test("files glob excludes non-etcd logs",
+                            "etcd-slow-disk" not in matched_ids(only_app, signatures, "must-gather")))
+
+        few = Path(tmp) / "mg-few"
+        write(few, etcd_log, "slow fdatasync\n" * 3)
+        results.append(test("below min_count does not match",
+                            "etcd-slow-disk" not in matched_ids(few, signatures, "must-gather")))
+
+        plain = write(tmp, "big.log", "".join(f"line {i:06d}\n" for i in range(2000)))
+        with gzip.open(Path(tmp) / "big.log.gz", "wt") as f:
+            f.write(plain.read_text())
+        limit, match_signatures.MAX_SCAN_BYTES = match_signatures.MAX_SCAN_BYTES, 1000
+        tail = read_text(Path(tmp) / "big.log.gz")
+        results.append(test("gzip files are scanned in their tail like plain files",
+                            tail == read_text(plain) and tail.endswith("line 001999\n")))
+        match_signatures.MAX_SCAN_BYTES = limit
+
+        install_log = write(tmp, ".openshift_install.log",
+                            'level=error msg="Bootstrap failed to complete: timed out"\n')
+        results.append(test("install-log source matches a single file",
+                            "install-bootstrap-failed" in matched_ids(install_log, signatures, "install-log")))
+        results.append(test("source filter skips install rules for must-gather",
+                            "install-bootstrap-failed" not in matched_ids(install_log, signatures, "must-gather")))
+
+        team = Path(tmp) / "team"
+        write(team, "team.yaml", """
+signatures:
+  - id: team-widget-crash
+    title: Widget operator panics
+    sources: [must-gather]
+    severity: critical
+    match:
+      all: ['panic:']
+      any: ['widget']
+      none: ['recovered']
+    remediation: Upgrade the widget operator.
+""")
+        extra, errors = load_signatures([DEFAULT_SIGNATURES_DIR, team])
+        write(mg, "namespaces/widget/pods/w/w/w/logs/current.log", "panic: widget nil pointer\n")
+        results.append(test("extra signatures directory is loaded",
+                            not errors and "team-widget-crash" in matched_ids(mg, extra, "must-gather")))
+        write(mg, "namespaces/widget/pods/w/w/w/logs/current.log", "panic: widget nil pointer\nrecovered\n")
+        results.append(test("none pattern suppresses the match",
+                            "team-widget-crash" not in matched_ids(mg, extra, "must-gather")))
+
+        bad = Path(tmp) / "bad"
+        write(bad, "bad.yaml", """
+signatures:
+  - id: etcd-slow-disk
+    title: duplicate
+    sources: [must-gather]
+    severity: warning
+    match: {any: ['x']}
+    remediation: none
+  - id: broken-regex
+    title: broken
+    sources: [cluster]
+    severity: urgent
+    match: {any: ['(unclosed']}
+    remediation: none
+""")
+        _, errors = load_signatures([DEFAULT_SIGNATURES_DIR, bad])
+        joined = "\n".join(errors)
+        results.append(test("duplicate id is rejected", "duplicate id" in joined))
+        results.append(test("invalid regex is rejected", "invalid regex" in joined))
+        results.append(test("unknown source and severity are rejected",
+                            "unknown source" in joined and "unknown severity" in joined))
+
+        shapes = Path(tmp) / "shapes"
+        write(shapes, "list.yaml", "- id: top-level-list\n")
+        write(shapes, "entries.yaml", "signatures:\n  - just a string\n")
+        _, errors = load_signatures([shapes])
+        joined = "\n".join(errors)
+        results.append(test("a top-level list is a validation error",
+                            "list.yaml: expected a mapping with a 'signatures' list" in joined))
+        results.append(test("a non-mapping entry is a validation error",
+                            "entries.yaml: signature entries must be mappings" in joined))
+
+    stream = StreamMatcher(signatures, "cluster-events")
+    line, origin = event_line({
+        "involvedObject": {"namespace": "openshift-machine-api", "kind": "Machine", "name": "dev-worker-a-x7"},
+        "type": "Warning", "reason": "FailedCreate",
+        "message": "VcpuLimitExceeded: You have requested more vCPU capacity than your current vCPU limit",
+    })
+    alerts = stream.feed(line, origin)
+    results.append(test("machine FailedCreate event alerts",
+                        {"events-machine-create-failed", "install-cloud-quota"} <= {a["id"] for a in alerts}))
+    results.append(test("a signature alerts only once", not stream.feed(line, origin)))
+
+    previous = {}
+    healthy = {"metadata": {"name": "ingress"}, "status": {"conditions": [
+        {"type": "Available", "status": "True"}, {"type": "Degraded", "status": "False"}]}}
+    results.append(test("healthy initial conditions produce no lines", not clusteroperator_lines(healthy, previous)))
+    degraded = {"metadata": {"name": "ingress"}, "status": {"conditions": [
+        {"type": "Available", "status": "True"},
+        {"type": "Degraded", "status": "True", "reason": "IngressDegraded", "message": "router pods\n not ready"}]}}
+    lines = clusteroperator_lines(degraded, previous)
+    results.append(test("condition change produces one line",
+                        [l for l, _ in lines] == ["clusteroperator ingress Degraded=True IngressDegraded: router pods not ready"]))
+    results.append(test("unchanged conditions produce no lines", not clusteroperator_lines(degraded, previous)))
+    ids = {a["id"] for l, o in lines for a in stream.feed(l, o)}
+    results.append(test("degraded operator alerts", "events-operator-degraded" in ids))
+    etcd = stream.feed("clusteroperator etcd Degraded=True EtcdMembersDegraded: 2 of 3 members are available")
+    results.append(test("none pattern applies per line in streams",
+                        {a["id"] for a in etcd} == {"events-etcd-degraded"}))
+
+    few = StreamMatcher(signatures, "cluster-events")
+    for _ in range(2):
+        few.feed("event app/Pod/web-1 Warning FailedScheduling: 0/6 nodes are available: 3 Insufficient cpu")
+    results.append(test("stream below min_count does not alert",
+                        "events-insufficient-resources" not in {r["id"] for r in few.matched()}))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
@@ -0,0 +1,68 @@
+#!/usr/bin/env python3
+"""Tests for the must-gather reduction script."""
+
+import contextlib
+import gzip
+import io
+import os
+import sys
+import tarfile
+import tempfile
+from pathlib import Path
+
+sys.path.insert(0, os.path.dirname(__file__))
+from reduce_must_gather import reduce_must_gather
+
+AUDIT_LOG = "audit_logs/kube-apiserver/master-0-audit.log.gz"
+ROTATED_LOGS = [
+    "host_service_logs/masters/kubelet.log.1",
+    "namespaces/app/pods/web/web/web/logs/current.log.20240601-120000.gz",
+]
+
+
+def write(base, rel, content):
+    path = Path(base) / rel
+    path.parent.mkdir(parents=True, exist_ok=True)
+    path.write_bytes(content)
+    return path
+
+
+def reduced_files(mg, output, keep):
+    with contextlib.redirect_stdout(io.StringIO()):
+        reduce_must_gather(str(mg), str(output), 50 * 1024 ** 2, keep=keep)
+    with tarfile.open(output) as tar:
+        return {m.name.split("/", 1)[1] for m in tar.getmembers() if m.isfile()}
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+if __name__ == "__main__":
+    results = []
+
+    with tempfile.TemporaryDirectory() as tmp:
+        mg = Path(tmp) / "mg"
+        write(mg, AUDIT_LOG, gzip.compress(b'{"verb":"get"}\n' * 10))
+        write(mg, "audit_logs/kube-apiserver/master-0-audit.log.1", b'{"verb":"list"}\n')
+        for rel in ROTATED_LOGS:
+            write(mg, rel, b"old line\n")
+        write(mg, "namespaces/app/pods/web/web/web/logs/current.log", b"new line\n")
+
+        kept = reduced_files(mg, Path(tmp) / "kept.tar.gz", ["audit_logs"])
+        results.append(test("--keep audit_logs keeps the compressed audit log", AUDIT_LOG in kept))
+        results.append(test("--keep audit_logs keeps rotations inside it",
+                            "audit_logs/kube-apiserver/master-0-audit.log.1" in kept))
+        results.append(test("rotated logs outside kept directories are removed",
+                            not [rel for rel in ROTATED_LOGS if rel in kept]))
+        results.append(test("current logs are kept", "namespaces/app/pods/web/web/web/logs/current.log" in kept))
+
+        dropped = reduced_files(mg, Path(tmp) / "dropped.tar.gz", [])
+        results.append(test("audit_logs is dropped without --keep",
+                            not [name for name in dropped if name.startswith("audit_logs/")]))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
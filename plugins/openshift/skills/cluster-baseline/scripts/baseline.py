@@ -0,0 +1,275 @@
+#!/usr/bin/env python3
+"""
+baseline.py - Export cluster configuration as a baseline and check clusters against it
+
+Usage:
+  baseline.py export -o BASELINE.json [--name NAME] [--context CTX]
+                     [--include RESOURCE/NAME]... [--exclude RESOURCE/NAME]...
+  baseline.py check BASELINE.json [--context CTX | --snapshot SNAPSHOT.json] [--json]
+
+export reads the cluster-scoped configuration listed in RESOURCES with `oc`,
+keeps only the spec fields that describe intended configuration, and writes
+them as canonical JSON (sorted keys) together with their SHA-256 digest, so
+the file can be signed and verified byte for byte.
+
+check collects the same resources from another cluster (or reads a snapshot
+written by export) and reports every field that differs from the baseline.
+Paths listed in the baseline's "ignore" array are skipped. Entries look like
+"ingresses.config.openshift.io/cluster:spec.domain".
+
+Exit codes:
+  0 - Success (check: compliant)
+  1 - Invalid arguments, oc failure, or unreadable input
+  2 - check found drift
+
+Requirements: Python 3.6+, oc
+"""
+
+import argparse
+import datetime
+import hashlib
+import json
+import subprocess
+import sys
+from typing import Any, Dict, List, Optional, Tuple
+
+FORMAT_VERSION = 1
+
+# (resource, name, namespace); name None means every object of the resource
+RESOURCES = [
+    ('ingresses.config.openshift.io', 'cluster', None),
+    ('ingresscontrollers.operator.openshift.io', None, 'openshift-ingress-operator'),
+    ('proxies.config.openshift.io', 'cluster', None),
+    ('networks.config.openshift.io', 'cluster', None),
+    ('networks.operator.openshift.io', 'cluster', None),
+    ('oauths.config.openshift.io', 'cluster', None),
+    ('authentications.config.openshift.io', 'cluster', None),
+    ('machineconfigpools.machineconfiguration.openshift.io', None, None),
+    ('machineconfigs.machineconfiguration.openshift.io', None, None),
+    ('schedulers.config.openshift.io', 'cluster', None),
+    ('images.config.openshift.io', 'cluster', None),
+]
+
+# Fields that are unique per cluster or written by controllers
+DEFAULT_IGNORE = [
+    'ingresses.config.openshift.io/cluster:spec.domain',
+    'ingresses.config.openshift.io/cluster:spec.appsDomain',
+    'ingresscontrollers.operator.openshift.io/*:spec.domain',
+    'ingresscontrollers.operator.openshift.io/*:spec.defaultCertificate',
+    'authentications.config.openshift.io/cluster:spec.serviceAccountIssuer',
+    'authentications.config.openshift.io/cluster:spec.oauthMetadata',
+    'machineconfigpools.machineconfiguration.openshift.io/*:spec.configuration',
+    'images.config.openshift.io/cluster:spec.externalRegistryHostnames',
+]
+
+
+def run_oc(args: List[str], context: Optional[str]) -> Dict[str, Any]:
+    """Run oc and return the parsed JSON output."""
+    cmd = ['oc'] + (['--context', context] if context else []) + args + ['-o', 'json']
+    try:
+        out = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+                             universal_newlines=True, check=True).stdout
+    except FileNotFoundError:
+        raise RuntimeError('oc not found in PATH')
+    except subprocess.CalledProcessError as e:
+        raise RuntimeError('{} failed: {}'.format(' '.join(cmd), e.stderr.strip()))
+    return json.loads(out)
+
+
+def is_generated_machineconfig(obj: Dict[str, Any]) -> bool:
+    """MachineConfigs rendered or generated by the MCO are not part of a baseline."""
+    meta = obj.get('metadata', {})
+    if meta.get('name', '').startswith('rendered-'):
+        return True
+    annotations = meta.get('annotations') or {}
+    return 'machineconfiguration.openshift.io/generated-by-controller-version' in annotations
+
+
+def normalize(obj: Dict[str, Any]) -> Dict[str, Any]:
+    """Keep the identity and spec of an object."""
+    meta = obj.get('metadata', {})
+    out = {'name': meta.get('name'), 'spec': obj.get('spec', {})}
+    if meta.get('namespace'):
+        out['namespace'] = meta['namespace']
+    return out
+
+
+def collect(context: Optional[str], include: List[str],
+            exclude: Optional[List[str]] = None) -> Dict[str, Dict[str, Any]]:
+    """Collect the baseline resources. Returns {"resource/name": normalized object}."""
+    resources = list(RESOURCES)
+    for item in include:
+        resource, _, name = item.partition('/')
+        resources.append((resource, name or None, None))
+
+    objects = {}
+    for resource, name, namespace in resources:
+        args = ['get', resource] + ([name] if name else [])
+        if namespace:
+            args += ['-n', namespace]
+        data = run_oc(args, context)
+        items = data.get('items', [data]) if data.get('kind', '').endswith('List') else [data]
+        for obj in items:
+            if resource.startswith('machineconfigs.') and is_generated_machineconfig(obj):
+                continue
+            key = '{}/{}'.format(resource, obj['metadata']['name'])
+            if key not in (exclude or []):
+                objects[key] = normalize(obj)
+    return objects
+
+
+def canonical(data: Any) -> str:
+    return json.dumps(data, sort_keys=True, indent=2, ensure_ascii=False) + '\n'
+
+
+def digest(objects: Dict[str, Any]) -> str:
+    return hashlib.sha256(canonical(objects).encode('utf-8')).hexdigest()
+
+
+def ignored(key: str, path: str, patterns: List[str]) -> bool:
+    """Match "resource/name:dotted.path" against ignore patterns (name may be *)."""
+    resource, _, name = key.partition('/')
+    for pattern in patterns:
+        pkey, _, ppath = pattern.partition(':')
+        presource, _, pname = pkey.partition('/')
+        if presource != resource or pname not in ('*', name):
+            continue
+        if path == ppath or path.startswith(ppath + '.') or path.startswith(ppath + '['):
+            return True
+    return False
+
+
+def diff(a: Any, b: Any, path: str = '') -> List[Tuple[str, Any, Any]]:
+    """Return (path, baseline value, actual value) for every difference."""
+    if isinstance(a, dict) and isinstance(b, dict):
+        out = []
+        for k in sorted(set(a) | set(b)):
+            sub = '{}.{}'.format(path, k) if path else k
+            if k not in a:
+                out.append((sub, None, b[k]))
+            elif k not in b:
+                out.append((sub, a[k], None))
+            else:
+                out.extend(diff(a[k], b[k], sub))
+        return out
+    if a != b:
+        return [(path, a, b)]
+    return []
+
+
+def check(baseline: Dict[str, Any], actual: Dict[str, Any]) -> Dict[str, Any]:
+    patterns = baseline.get('ignore', [])
+    expected = baseline['objects']
+    result = {'missing': [], 'extra': [], 'changed': []}
+
+    for key in sorted(expected):
+        if key not in actual:
+            result['missing'].append(key)
+            continue
+        for path, want, got in diff(expected[key]['spec'], actual[key]['spec'], 'spec'):
+            if not ignored(key, path, patterns):
+                result['changed'].append({'object': key, 'path': path, 'baseline': want, 'actual': got})
+
+    # Extra objects only matter for list-type resources, e.g. an additional MachineConfig
+    for key in sorted(set(actual) - set(expected) - set(baseline.get('exclude', []))):
+        if not ignored(key, 'spec', patterns):
+            result['extra'].append(key)
+    return result
+
+
+def cmd_export(args: argparse.Namespace) -> int:
+    objects = collect(args.context, args.include, args.exclude)
+    doc = {
+        'formatVersion': FORMAT_VERSION,
+        'name': args.name,
+        'created': datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ'),
+        'source': run_oc(['get', 'clusterversion', 'version'], args.context)['spec'].get('clusterID'),
+        'ignore': DEFAULT_IGNORE,
+        'exclude': args.exclude,
+        'digest': digest(objects),
+        'objects': objects,
+    }
+    with open(args.output, 'w', encoding='utf-8') as f:
+        f.write(canonical(doc))
+    print('Wrote {} ({} objects, sha256 {})'.format(args.output, len(objects), doc['digest']))
+    return 0
+
+
+def short(value: Any) -> str:
+    text = '<absent>' if value is None else json.dumps(value, sort_keys=True)
+    return text if len(text) <= 120 else text[:117] + '...'
+
+
+def cmd_check(args: argparse.Namespace) -> int:
+    with open(args.baseline, encoding='utf-8') as f:
+        baseline = json.load(f)
+    if baseline.get('formatVersion') != FORMAT_VERSION:
+        print('Error: unsupported baseline format {}'.format(baseline.get('formatVersion')), file=sys.stderr)
+        return 1
+    if digest(baseline['objects']) != baseline.get('digest'):
+        print('Error: baseline objects do not match their digest; the file was modified', file=sys.stderr)
+        return 1
+
+    if args.snapshot:
+        with open(args.snapshot, encoding='utf-8') as f:
+            actual = json.load(f)['objects']
+    else:
+        include = [k for k in baseline['objects']
+                   if not any(k.startswith(r + '/') for r, _, _ in RESOURCES)]
+        actual = collect(args.context, include)
+
+    result = check(baseline, actual)
+    drift = bool(result['missing'] or result['extra'] or result['changed'])
+
+    if args.json:
+        print(canonical(dict(result, baseline=baseline.get('name'), compliant=not drift)), end='')
+    else:
+        print('Baseline: {} ({} objects)'.format(baseline.get('name'), len(baseline['objects'])))
+        for key in result['missing']:
+            print('MISSING  {}'.format(key))
+        for key in result['extra']:
+            print('EXTRA    {}'.format(key))
+        for c in result['changed']:
+            print('CHANGED  {}  {}'.format(c['object'], c['path']))
+            print('           baseline: {}'.format(short(c['baseline'])))
+            print('           actual:   {}'.format(short(c['actual'])))
+        print('Compliant' if not drift else 'Drift: {} missing, {} extra, {} changed'.format(
+            len(result['missing']), len(result['extra']), len(result['changed'])))
+    return 2 if drift else 0
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Export and check cluster configuration baselines')
+    sub = parser.add_subparsers(dest='command')
+
+    p = sub.add_parser('export', help='export the current cluster as a baseline')
+    p.add_argument('-o', '--output', required=True)
+    p.add_argument('--name', default='baseline')
+    p.add_argument('--context')
+    p.add_argument('--include', action='append', default=[], metavar='RESOURCE/NAME',
+                   help='additional cluster-scoped object, e.g. apiservers.config.openshift.io/cluster')
+    p.add_argument('--exclude', action='append', default=[], metavar='RESOURCE/NAME',
+                   help='object to leave out, e.g. a MachineConfig specific to the reference cluster')
+
+    p = sub.add_parser('check', help='check a cluster against a baseline')
+    p.add_argument('baseline')
+    group = p.add_mutually_exclusive_group()
+    group.add_argument('--context')
+    group.add_argument('--snapshot', help='a file written by export, instead of a live cluster')
+    p.add_argument('--json', action='store_true')
+
+    args = parser.parse_args()
+    try:
+        if args.command == 'export':
+            return cmd_export(args)
+        if args.command == 'check':
+            return cmd_check(args)
+    except (RuntimeError, OSError, ValueError, KeyError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    parser.print_help(sys.stderr)
+    return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,218 @@
+#!/bin/bash
+
+# oc-token-helper.sh
+# Keeps OpenShift OAuth tokens in the OS credential store (macOS Keychain or
+# Linux secret-tool) and serves them to oc/kubectl as an exec credential plugin.
+#
+# Usage:
+#   oc-token-helper.sh store <server> <expires-in-seconds>   # token on stdin
+#   oc-token-helper.sh store-login <server> <user> [<idp>]   # password on stdin
+#   oc-token-helper.sh get <server>                          # ExecCredential JSON
+#   oc-token-helper.sh status <server>
+#   oc-token-helper.sh delete <server>
+#
+# Environment:
+#   OC_LOGIN_CA_FILE  CA bundle for the API and OAuth servers (optional)
+#
+# Exit codes:
+#   0 - Success
+#   1 - Invalid arguments or credential store error
+#   2 - No valid token and it could not be refreshed; run /openshift:login again
+
+set -euo pipefail
+
+SERVICE="openshift-login"
+# Refresh tokens that expire within this many seconds
+REFRESH_MARGIN=300
+
+usage() {
+  sed -n '7,12p' "$0" | sed 's/^# \{0,1\}//' >&2
+  exit 1
+}
+
+backend() {
+  if command -v security >/dev/null 2>&1; then
+    echo "keychain"
+  elif command -v secret-tool >/dev/null 2>&1; then
+    echo "secret-tool"
+  else
+    echo "none"
+  fi
+}
+
+# Quote a value for curl config files and security -i command lines
+# Args:
+#   $1: value
+quote() {
+  local value="${1//\\/\\\\}"
+  printf '"%s"' "${value//\"/\\\"}"
+}
+
+# Store a secret. Values are passed on stdin, never as arguments, so they do
+# not show up in ps
+# Args:
+#   $1: key
+#   $2: value
+secret_set() {
+  case "$(backend)" in
+    keychain)
+      printf 'add-generic-password -U -s %s -a %s -w %s\n' "$(quote "${SERVICE}")" "$(quote "$1")" "$(quote "$2")" |
+        security -i >/dev/null
+      ;;
+    secret-tool) printf '%s' "$2" | secret-tool store --label="${SERVICE} $1" service "${SERVICE}" key "$1" ;;
+    *)
+      echo "Error: No credential store found (macOS Keychain or secret-tool)" >&2
+      return 1
+      ;;
+  esac
+}
+
+# Print a secret, or return 1 if it does not exist
+# Args:
+#   $1: key
+secret_get() {
+  case "$(backend)" in
+    keychain) security find-generic-password -s "${SERVICE}" -a "$1" -w 2>/dev/null ;;
+    secret-tool) secret-tool lookup service "${SERVICE}" key "$1" 2>/dev/null ;;
+    *) return 1 ;;
+  esac
+}
+
+# Delete a secret if it exists
+# Args:
+#   $1: key
+secret_delete() {
+  case "$(backend)" in
+    keychain) security delete-generic-password -s "${SERVICE}" -a "$1" >/dev/null 2>&1 || true ;;
+    secret-tool) secret-tool clear service "${SERVICE}" key "$1" 2>/dev/null || true ;;
+  esac
+}
+
+# Format an epoch timestamp as RFC 3339 (GNU and BSD date)
+rfc3339() {
+  date -u -d "@$1" +%Y-%m-%dT%H:%M:%SZ 2>/dev/null || date -u -r "$1" +%Y-%m-%dT%H:%M:%SZ
+}
+
+curl_oauth() {
+  curl -s ${OC_LOGIN_CA_FILE:+--cacert "${OC_LOGIN_CA_FILE}"} "$@"
+}
+
+# Get a new token with the stored username and password through the
+# openshift-challenging-client, which only works for challenge-capable
+# identity providers (htpasswd, LDAP, basic auth, keystone)
+# Args:
+#   $1: API server URL
+refresh_token() {
+  local server="$1"
+  local user password idp issuer location token expires_in
+
+  user=$(secret_get "${server}/user") || return 1
+  password=$(secret_get "${server}/password") || return 1
+  idp=$(secret_get "${server}/idp" || true)
+  [ -z "${idp}" ] || idp=$(jq -rn --arg v "${idp}" '$v | @uri')
+
+  issuer=$(curl_oauth -f "${server}/.well-known/oauth-authorization-server" | jq -r '.issuer // empty') || return 1
+  [ -n "${issuer}" ] || return 1
+
+  # The credentials go to curl as a config file on stdin, not on its command line
+  location=$(printf 'user = %s\n' "$(quote "${user}:${password}")" |
+    curl_oauth -K - -o /dev/null -w '%{redirect_url}' -H "X-CSRF-Token: 1" \
+    "${issuer}/oauth/authorize?client_id=openshift-challenging-client&response_type=token${idp:+&idp=${idp}}")
+
+  token=$(printf '%s' "${location}" | sed -n 's/.*[#&]access_token=\([^&]*\).*/\1/p')
+  expires_in=$(printf '%s' "${location}" | sed -n 's/.*[#&]expires_in=\([0-9]*\).*/\1/p')
+  [ -n "${token}" ] || return 1
+
+  secret_set "${server}/token" "${token} $(( $(date +%s) + ${expires_in:-86400} ))"
+}
+
+cmd_store() {
+  local server="$1" expires_in="$2" token
+  token=$(cat)
+  [ -n "${token}" ] || { echo "Error: No token on stdin" >&2; return 1; }
+  secret_set "${server}/token" "${token} $(( $(date +%s) + expires_in ))"
+}
+
+cmd_store_login() {
+  local server="$1" user="$2" idp="${3:-}" password
+  password=$(cat)
+  [ -n "${password}" ] || { echo "Error: No password on stdin" >&2; return 1; }
+  secret_set "${server}/user" "${user}"
+  secret_set "${server}/password" "${password}"
+  if [ -n "${idp}" ]; then
+    secret_set "${server}/idp" "${idp}"
+  else
+    secret_delete "${server}/idp"
+  fi
+}
+
+cmd_get() {
+  local server="$1" entry="" token expiry now
+  now=$(date +%s)
+  entry=$(secret_get "${server}/token" || true)
+  expiry="${entry##* }"
+
+  if [ -z "${entry}" ] || [ $(( expiry - now )) -lt "${REFRESH_MARGIN}" ]; then
+    if refresh_token "${server}"; then
+      entry=$(secret_get "${server}/token")
+      expiry="${entry##* }"
+    elif [ -z "${entry}" ] || [ "${expiry}" -le "${now}" ]; then
+      echo "Error: The token for ${server} is missing or expired and cannot be refreshed. Run /openshift:login ${server}" >&2
+      return 2
+    else
+      # Still valid for a few minutes; hand it out and warn
+      echo "Warning: The token for ${server} expires in $(( (expiry - now) / 60 )) minutes. Run /openshift:login ${server}" >&2
+    fi
+  fi
+  token="${entry% *}"
+
+  jq -n --arg token "${token}" --arg exp "$(rfc3339 "${expiry}")" '{
+    apiVersion: "client.authentication.k8s.io/v1",
+    kind: "ExecCredential",
+    status: {token: $token, expirationTimestamp: $exp}
+  }'
+}
+
+cmd_status() {
+  local server="$1" entry expiry now refresh="no"
+  now=$(date +%s)
+  if secret_get "${server}/password" >/dev/null; then
+    refresh="yes (user $(secret_get "${server}/user"))"
+  fi
+  if ! entry=$(secret_get "${server}/token"); then
+    echo "server: ${server}"
+    echo "token: none"
+    echo "auto-refresh: ${refresh}"
+    return 2
+  fi
+  expiry="${entry##* }"
+  echo "server: ${server}"
+  echo "store: $(backend)"
+  if [ "${expiry}" -gt "${now}" ]; then
+    echo "token: valid until $(rfc3339 "${expiry}") ($(( (expiry - now) / 60 )) minutes)"
+  else
+    echo "token: expired at $(rfc3339 "${expiry}")"
+  fi
+  echo "auto-refresh: ${refresh}"
+}
+
+cmd_delete() {
+  local server="$1" key
+  for key in token user password idp; do
+    secret_delete "${server}/${key}"
+  done
+}
+
+[ $# -ge 2 ] || usage
+command="$1"
+server="${2%/}"
+shift 2
+
+case "${command}" in
+  store) [ $# -eq 1 ] || usage; cmd_store "${server}" "$1" ;;
+  store-login) [ $# -ge 1 ] || usage; cmd_store_login "${server}" "$@" ;;
+  get) cmd_get "${server}" ;;
+  status) cmd_status "${server}" ;;
+  delete) cmd_delete "${server}" ;;
+  *) usage ;;
+esac
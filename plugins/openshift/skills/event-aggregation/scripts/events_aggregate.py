@@ -0,0 +1,216 @@
+#!/usr/bin/env python3
+"""
+events_aggregate.py - Aggregate Kubernetes events into signatures and print
+the top N, without holding all events in memory
+
+Usage:
+  events_aggregate.py [--since DURATION] [--namespace NS] [--all-types]
+                      [--top N] [--page-size N] [--context CTX] [--json]
+                      [--progress]
+  events_aggregate.py --input EVENTS.json [--since DURATION] [--top N] [--json]
+
+Without --input, reads events from the API page by page with
+`oc get --raw`, keeping only the aggregates, so hundreds of thousands of
+events take seconds and little memory. Warning events only unless
+--all-types, filtered on the server.
+
+Each event message is normalized into a signature: UUIDs, IP addresses,
+hex strings, numbers, durations, and the generated suffixes of pod,
+ReplicaSet, and Job names are replaced with placeholders. Events with the
+same type, reason, object kind, and signature are counted together, using
+the event's own count of repeated occurrences.
+
+--progress prints one JSON object per page to stderr: {"type": "progress",
+"phase": "list", "done", "total", "percent", "etaSeconds", "item"}, counting
+events. total comes from the API's remainingItemCount and is null when the
+API server does not return it.
+
+Exit codes:
+  0 - Success
+  1 - oc failed, the input could not be read, or invalid arguments
+
+Requirements: Python 3.6+; oc (without --input)
+"""
+
+import argparse
+import functools
+import json
+import re
+import subprocess
+import sys
+import time
+import urllib.parse
+from datetime import datetime, timedelta, timezone
+from typing import Any, Dict, Iterator, List, Optional, Tuple
+
+from ai_helpers_events import progress
+from ai_helpers_units import parse_duration
+
+# Order matters: specific patterns before the generic number rule
+NORMALIZERS = [
+    (re.compile(r'\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b'), '<uuid>'),
+    (re.compile(r'sha256:[0-9a-f]{64}'), 'sha256:<digest>'),
+    (re.compile(r'\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b'), '<ip>'),
+    (re.compile(r'\b[0-9a-f]{12,}\b'), '<hex>'),
+    # <deployment>-<replicaset hash>-<pod suffix>, <name>-<pod or job suffix>
+    (re.compile(r'\b([a-z0-9][a-z0-9.-]*?)-[a-z0-9]{8,10}-[bcdfghjklmnpqrstvwxz2456789]{5}(?![a-z0-9-])'), r'\1-*'),
+    (re.compile(r'\b([a-z0-9][a-z0-9.-]*?)-[bcdfghjklmnpqrstvwxz2456789]{5}(?![a-z0-9-])'), r'\1-*'),
+    (re.compile(r'\b\d+(?:\.\d+)?(?:ms|s|m|h)(?:\d+(?:\.\d+)?(?:ms|s|m))*\b'), '<duration>'),
+    (re.compile(r'\b\d+(?:\.\d+)?\b'), '<n>'),
+]
+
+MAX_TRACKED = 1000  # distinct namespaces and objects remembered per signature
+
+
+@functools.lru_cache(maxsize=65536)
+def normalize(message: str) -> str:
+    message = ' '.join(message.split())
+    for pattern, repl in NORMALIZERS:
+        message = pattern.sub(repl, message)
+    return message[:300]
+
+
+def event_times(ev: Dict[str, Any]) -> Tuple[str, str]:
+    """First and last time as 'YYYY-MM-DDTHH:MM:SS'; API timestamps are UTC, so these compare as strings."""
+    series = ev.get('series') or {}
+    created = ev.get('eventTime') or ev.get('metadata', {}).get('creationTimestamp')
+    first = (ev.get('firstTimestamp') or created or '')[:19]
+    last = (ev.get('lastTimestamp') or series.get('lastObservedTime') or created or '')[:19]
+    return first, last or first
+
+
+def event_count(ev: Dict[str, Any]) -> int:
+    return int((ev.get('series') or {}).get('count') or ev.get('count') or 1)
+
+
+def api_pages(namespace: str, warnings_only: bool, page_size: int,
+              context: str) -> Iterator[Tuple[List[Dict[str, Any]], Optional[int]]]:
+    """Yield each page's events with the number of events left after it, if the API reports it."""
+    path = '/api/v1/namespaces/{}/events'.format(namespace) if namespace else '/api/v1/events'
+    params = {'limit': str(page_size)}
+    if warnings_only:
+        params['fieldSelector'] = 'type=Warning'
+    base = ['oc'] + (['--context', context] if context else []) + ['get', '--raw']
+    while True:
+        proc = subprocess.run(base + [path + '?' + urllib.parse.urlencode(params)],
+                              stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+        if proc.returncode != 0:
+            raise RuntimeError('oc get --raw {} failed: {}'.format(path, proc.stderr.strip()))
+        page = json.loads(proc.stdout)
+        meta = page.get('metadata') or {}
+        token = meta.get('continue')
+        yield page.get('items') or [], meta.get('remainingItemCount', 0 if not token else None)
+        if not token:
+            return
+        params['continue'] = token
+
+
+def file_pages(path: str) -> Iterator[Tuple[List[Dict[str, Any]], Optional[int]]]:
+    with open(path, encoding='utf-8') as f:
+        doc = json.load(f)
+    yield (doc.get('items', []) if isinstance(doc, dict) else doc), 0
+
+
+class Aggregator:
+    def __init__(self, since: str, warnings_only: bool):
+        self.since = since
+        self.warnings_only = warnings_only
+        self.groups = {}  # type: Dict[Tuple[str, str, str, str], Dict[str, Any]]
+        self.scanned = 0
+        self.matched = 0
+
+    def add(self, ev: Dict[str, Any]) -> None:
+        self.scanned += 1
+        etype = ev.get('type', '')
+        if self.warnings_only and etype != 'Warning':
+            return
+        first, last = event_times(ev)
+        if self.since and (not last or last < self.since):
+            return
+        self.matched += 1
+        obj = ev.get('involvedObject') or ev.get('regarding') or {}
+        message = ev.get('message') or ev.get('note') or ''
+        key = (etype, ev.get('reason', ''), obj.get('kind', ''), normalize(message))
+        g = self.groups.get(key)
+        if g is None:
+            g = self.groups[key] = {'occurrences': 0, 'events': 0, 'namespaces': set(), 'objects': set(),
+                                    'first': first, 'last': last, 'example': message[:500],
+                                    'exampleObject': '{}/{}'.format(obj.get('namespace', ''), obj.get('name', ''))}
+        g['occurrences'] += event_count(ev)
+        g['events'] += 1
+        for field, value in (('namespaces', obj.get('namespace', '')), ('objects', obj.get('name', ''))):
+            if len(g[field]) < MAX_TRACKED:
+                g[field].add(value)
+        if first and (not g['first'] or first < g['first']):
+            g['first'] = first
+        if last and (not g['last'] or last > g['last']):
+            g['last'] = last
+
+    def top(self, n: int) -> List[Dict[str, Any]]:
+        rows = []
+        for (etype, reason, kind, signature), g in sorted(self.groups.items(),
+                                                          key=lambda kv: -kv[1]['occurrences'])[:n]:
+            rows.append({
+                'type': etype, 'reason': reason, 'kind': kind, 'signature': signature,
+                'occurrences': g['occurrences'], 'events': g['events'],
+                'namespaces': len(g['namespaces']), 'objects': len(g['objects']),
+                'capped': len(g['objects']) >= MAX_TRACKED,
+                'topNamespaces': sorted(ns for ns in g['namespaces'] if ns)[:3],
+                'firstSeen': g['first'] + 'Z' if g['first'] else None,
+                'lastSeen': g['last'] + 'Z' if g['last'] else None,
+                'example': g['example'], 'exampleObject': g['exampleObject'],
+            })
+        return rows
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Aggregate events into signatures and print the top N')
+    parser.add_argument('--input', help='events JSON (oc get events -o json) instead of the live API')
+    parser.add_argument('--since', help='only events last seen within this duration, e.g. 1h or 2d')
+    parser.add_argument('--namespace', default='', help='one namespace (default: all)')
+    parser.add_argument('--all-types', action='store_true', help='include Normal events')
+    parser.add_argument('--top', type=int, default=20)
+    parser.add_argument('--page-size', type=int, default=5000, help='events per API request (default 5000)')
+    parser.add_argument('--context', default='', help='kubeconfig context')
+    parser.add_argument('--json', action='store_true')
+    parser.add_argument('--progress', action='store_true', help='print NDJSON progress events on stderr')
+    args = parser.parse_args()
+
+    start = time.time()
+    try:
+        cutoff = datetime.now(timezone.utc) - timedelta(seconds=parse_duration(args.since)) if args.since else None
+        since = cutoff.strftime('%Y-%m-%dT%H:%M:%S') if cutoff else ''
+        agg = Aggregator(since, not args.all_types)
+        pages = file_pages(args.input) if args.input else \
+            api_pages(args.namespace, not args.all_types, args.page_size, args.context)
+        for page, remaining in pages:
+            for ev in page:
+                agg.add(ev)
+            if args.progress:
+                progress('list', agg.scanned, agg.scanned + remaining if remaining is not None else None, start,
+                         args.input or args.namespace or 'all namespaces')
+    except (OSError, ValueError, RuntimeError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+
+    rows = agg.top(args.top)
+    summary = {'scanned': agg.scanned, 'matched': agg.matched, 'signatures': len(agg.groups),
+               'occurrences': sum(g['occurrences'] for g in agg.groups.values()),
+               'since': since + 'Z' if since else None, 'seconds': round(time.time() - start, 1)}
+    if args.json:
+        print(json.dumps({'summary': summary, 'top': rows}, indent=2))
+        return 0
+    print('{scanned} events scanned, {matched} in window, {signatures} signatures, '
+          '{occurrences} occurrences ({seconds}s)\n'.format(**summary))
+    for i, r in enumerate(rows, 1):
+        print('{:>3}. {:>8}x  {} {} {}  ({} objects in {} namespaces, last {})'.format(
+            i, r['occurrences'], r['type'], r['kind'], r['reason'],
+            '{}+'.format(r['objects']) if r['capped'] else r['objects'], r['namespaces'],
+            r['lastSeen'] or '-'))
+        print('       {}'.format(r['signature']))
+        print('       e.g. {}: {}'.format(r['exampleObject'], r['example'][:160]))
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
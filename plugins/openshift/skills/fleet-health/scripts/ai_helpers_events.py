@@ -0,0 +1 @@
+../../../../../lib/ai_helpers_events.py
\ No newline at end of file
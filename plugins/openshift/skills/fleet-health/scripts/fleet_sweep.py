@@ -0,0 +1,280 @@
+#!/usr/bin/env python3
+"""
+fleet_sweep.py - Health snapshot of every cluster in one or more kubeconfig files
+
+Usage:
+  fleet_sweep.py [KUBECONFIG...] [--parallel N] [--timeout SECONDS]
+                 [--all-contexts] [--match REGEX] [--json]
+                 [--notify-webhook URL] [--notify-format json|slack] [--progress]
+
+Without KUBECONFIG arguments, the files in $KUBECONFIG (or ~/.kube/config)
+are used. Contexts that point at the same API server are checked once, with
+the first context found, unless --all-contexts is given.
+
+For each cluster the snapshot records: API reachability and authentication,
+OpenShift version and update state, degraded or unavailable ClusterOperators,
+node readiness, and the number of pods that are not running.
+
+--notify-webhook POSTs the result when the sweep finishes, as
+{"command", "status", "exitCode", "finished", "result"} or, with
+--notify-format slack, as a Slack incoming-webhook message. URL may be
+"env:VARIABLE" to keep the webhook out of shell history. A failed POST is
+reported on stderr and does not change the exit code.
+
+--progress writes one JSON object per line to stderr as each cluster
+finishes: {"type": "progress", "phase": "sweep", "done", "total", "percent",
+"etaSeconds", "item"}, where item is the context name.
+
+Exit codes:
+  0 - Every cluster is healthy
+  1 - Invalid arguments, oc missing, or no contexts found
+  2 - At least one cluster is unreachable, unauthenticated, or unhealthy
+
+Requirements: Python 3.6+, oc
+"""
+
+import argparse
+import concurrent.futures
+import datetime
+import json
+import os
+import re
+import shutil
+import subprocess
+import sys
+import time
+from typing import Any, Dict, List, Optional, Pattern, Tuple
+
+from ai_helpers_events import notify, progress
+
+STATUS_ORDER = ['unreachable', 'unauthorized', 'critical', 'warning', 'healthy']
+
+
+class OcError(Exception):
+    pass
+
+
+def oc(kubeconfig: str, context: str, args: List[str], timeout: int) -> Dict[str, Any]:
+    """Run oc against one context and return its JSON output; every failure is an OcError."""
+    cmd = ['oc', '--kubeconfig', kubeconfig, '--context', context,
+           '--request-timeout', '{}s'.format(timeout)] + args + ['-o', 'json']
+    try:
+        proc = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+                              universal_newlines=True, timeout=timeout * 2)
+    except subprocess.TimeoutExpired:
+        raise OcError('timed out')
+    except OSError as e:
+        raise OcError('cannot run oc: {}'.format(e))
+    if proc.returncode != 0:
+        raise OcError(proc.stderr.strip().splitlines()[-1] if proc.stderr.strip() else 'oc failed')
+    try:
+        return json.loads(proc.stdout)
+    except ValueError:
+        raise OcError('oc {} returned invalid JSON'.format(' '.join(args)))
+
+
+def list_contexts(kubeconfig: str) -> List[Tuple[str, str]]:
+    """Return (context, server) pairs of a kubeconfig file."""
+    proc = subprocess.run(['oc', 'config', 'view', '--kubeconfig', kubeconfig, '-o', 'json'],
+                          stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+    if proc.returncode != 0:
+        print('Warning: cannot read {}: {}'.format(kubeconfig, proc.stderr.strip()), file=sys.stderr)
+        return []
+    try:
+        config = json.loads(proc.stdout)
+    except ValueError:
+        print('Warning: cannot read {}: oc config view returned invalid JSON'.format(kubeconfig), file=sys.stderr)
+        return []
+    servers = {c['name']: c.get('cluster', {}).get('server', '') for c in config.get('clusters') or []}
+    return [(c['name'], servers.get(c.get('context', {}).get('cluster'), ''))
+            for c in config.get('contexts') or []]
+
+
+def condition(obj: Dict[str, Any], ctype: str) -> Optional[Dict[str, Any]]:
+    for c in obj.get('status', {}).get('conditions') or []:
+        if c.get('type') == ctype:
+            return c
+    return None
+
+
+def snapshot(kubeconfig: str, context: str, server: str, timeout: int) -> Dict[str, Any]:
+    """Collect the health snapshot of one cluster. Never raises."""
+    result = {'context': context, 'kubeconfig': kubeconfig, 'server': server,
+              'status': 'healthy', 'findings': []}
+
+    def finding(severity: str, text: str) -> None:
+        result['findings'].append(text)
+        if STATUS_ORDER.index(severity) < STATUS_ORDER.index(result['status']):
+            result['status'] = severity
+
+    try:
+        cv = oc(kubeconfig, context, ['get', 'clusterversion', 'version'], timeout)
+    except OcError as e:
+        msg = str(e)
+        if re.search(r'Unauthorized|must be logged in|invalid bearer token|token has expired|'
+                     r'certificate has expired or is not yet valid', msg, re.I):
+            finding('unauthorized', msg)
+        elif re.search(r'NotFound|the server doesn\'t have a resource type', msg):
+            result['version'] = 'non-OpenShift'
+        else:
+            finding('unreachable', msg)
+        if result['status'] in ('unreachable', 'unauthorized'):
+            return result
+        cv = None
+
+    if cv:
+        history = cv.get('status', {}).get('history') or [{}]
+        result['version'] = cv.get('status', {}).get('desired', {}).get('version', history[0].get('version'))
+        progressing = condition(cv, 'Progressing')
+        failing = condition(cv, 'Failing')
+        if progressing and progressing.get('status') == 'True' and history[0].get('state') == 'Partial':
+            finding('warning', 'updating: {}'.format(progressing.get('message', '')[:120]))
+        if failing and failing.get('status') == 'True':
+            finding('critical', 'update failing: {}'.format(failing.get('message', '')[:120]))
+        result['availableUpdates'] = len(cv.get('status', {}).get('availableUpdates') or [])
+
+        try:
+            cos = oc(kubeconfig, context, ['get', 'clusteroperators'], timeout).get('items', [])
+            degraded = [co['metadata']['name'] for co in cos
+                        if (condition(co, 'Degraded') or {}).get('status') == 'True']
+            unavailable = [co['metadata']['name'] for co in cos
+                           if (condition(co, 'Available') or {}).get('status') != 'True']
+            result['operators'] = {'total': len(cos), 'degraded': degraded, 'unavailable': unavailable}
+            if unavailable:
+                finding('critical', 'unavailable operators: {}'.format(', '.join(unavailable)))
+            if degraded:
+                finding('warning', 'degraded operators: {}'.format(', '.join(degraded)))
+        except OcError as e:
+            finding('warning', 'clusteroperators: {}'.format(e))
+
+    try:
+        nodes = oc(kubeconfig, context, ['get', 'nodes'], timeout).get('items', [])
+        not_ready = [n['metadata']['name'] for n in nodes
+                     if (condition(n, 'Ready') or {}).get('status') != 'True']
+        result['nodes'] = {'total': len(nodes), 'notReady': not_ready}
+        if not_ready:
+            finding('critical' if len(not_ready) * 2 >= len(nodes) else 'warning',
+                    'nodes not ready: {}'.format(', '.join(not_ready[:5]) + (' ...' if len(not_ready) > 5 else '')))
+    except OcError as e:
+        finding('warning', 'nodes: {}'.format(e))
+
+    try:
+        pods = oc(kubeconfig, context, ['get', 'pods', '-A', '--field-selector',
+                                        'status.phase!=Running,status.phase!=Succeeded'], timeout).get('items', [])
+        result['podsNotRunning'] = len(pods)
+        if pods:
+            finding('warning', '{} pods not running'.format(len(pods)))
+    except OcError as e:
+        finding('warning', 'pods: {}'.format(e))
+
+    return result
+
+
+def targets(files: List[str], all_contexts: bool, match: Optional[Pattern]) -> List[Tuple[str, str, str]]:
+    seen = set()
+    out = []
+    for kubeconfig in files:
+        for context, server in list_contexts(kubeconfig):
+            if match and not match.search(context):
+                continue
+            if not all_contexts and server and server in seen:
+                continue
+            seen.add(server)
+            out.append((kubeconfig, context, server))
+    return out
+
+
+def print_table(results: List[Dict[str, Any]]) -> None:
+    icons = {'healthy': '✅', 'warning': '⚠️ ', 'critical': '❌', 'unauthorized': '🔒', 'unreachable': '⛔'}
+    width = max([len(r['context']) for r in results] + [7])
+    # the icons are two columns wide
+    print('{:<{w}}  {:<2} {:<12} {:<12} {:<7} {:<9} {}'.format(
+        'CONTEXT', '', 'STATUS', 'VERSION', 'NODES', 'OPERATORS', 'FINDINGS', w=width))
+    for r in results:
+        nodes = r.get('nodes')
+        ops = r.get('operators')
+        print('{:<{w}}  {} {:<12} {:<12} {:<7} {:<9} {}'.format(
+            r['context'], icons[r['status']], r['status'], r.get('version') or '-',
+            '{}/{}'.format(nodes['total'] - len(nodes['notReady']), nodes['total']) if nodes else '-',
+            '{}/{}'.format(ops['total'] - len(set(ops['degraded']) | set(ops['unavailable'])), ops['total']) if ops else '-',
+            '; '.join(r['findings'])[:160], w=width))
+    print('\n' + summary(results))
+
+
+def summary(results: List[Dict[str, Any]]) -> str:
+    counts = {s: sum(1 for r in results if r['status'] == s) for s in STATUS_ORDER}
+    return '{} clusters: '.format(len(results)) + ', '.join(
+        '{} {}'.format(counts[s], s) for s in reversed(STATUS_ORDER) if counts[s])
+
+
+def notify_results(url: str, fmt: str, results: List[Dict[str, Any]], code: int) -> None:
+    if fmt == 'slack':
+        lines = ['*Fleet sweep*: ' + summary(results)]
+        lines.extend('• `{}` {}: {}'.format(r['context'], r['status'], '; '.join(r['findings'])[:200])
+                     for r in results if r['status'] != 'healthy')
+        payload = {'text': '\n'.join(lines)}
+    else:
+        payload = {
+            'command': 'openshift:fleet',
+            'status': 'healthy' if code == 0 else 'attention',
+            'exitCode': code,
+            'finished': datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ'),
+            'result': results,
+        }
+    notify(url, payload)
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Health snapshot of every cluster in kubeconfig files')
+    parser.add_argument('kubeconfigs', nargs='*')
+    parser.add_argument('--parallel', type=int, default=8, help='clusters checked at once (default 8)')
+    parser.add_argument('--timeout', type=int, default=15, help='per-request timeout in seconds (default 15)')
+    parser.add_argument('--all-contexts', action='store_true', help='check every context, even for the same server')
+    parser.add_argument('--match', help='only contexts whose name matches this regular expression')
+    parser.add_argument('--json', action='store_true')
+    parser.add_argument('--notify-webhook', metavar='URL', help='POST the result here when done (or env:VARIABLE)')
+    parser.add_argument('--notify-format', choices=['json', 'slack'], default='json')
+    parser.add_argument('--progress', action='store_true', help='print NDJSON progress events on stderr')
+    args = parser.parse_args()
+
+    files = args.kubeconfigs or [f for f in os.environ.get('KUBECONFIG', '').split(os.pathsep) if f] \
+        or [os.path.expanduser('~/.kube/config')]
+    if args.parallel < 1:
+        print('Error: --parallel must be at least 1', file=sys.stderr)
+        return 1
+    try:
+        match = re.compile(args.match) if args.match else None
+    except re.error as e:
+        print('Error: invalid --match pattern {!r}: {}'.format(args.match, e), file=sys.stderr)
+        return 1
+    if shutil.which('oc') is None:
+        print('Error: oc not found in PATH', file=sys.stderr)
+        return 1
+
+    todo = targets(files, args.all_contexts, match)
+    if not todo:
+        print('Error: no contexts found in {}'.format(', '.join(files)), file=sys.stderr)
+        return 1
+
+    started = time.time()
+    results = []
+    with concurrent.futures.ThreadPoolExecutor(max_workers=args.parallel) as pool:
+        futures = [pool.submit(snapshot, t[0], t[1], t[2], args.timeout) for t in todo]
+        for future in concurrent.futures.as_completed(futures):
+            results.append(future.result())
+            if args.progress:
+                progress('sweep', len(results), len(todo), started, results[-1]['context'])
+    results.sort(key=lambda r: (STATUS_ORDER.index(r['status']), r['context']))
+
+    if args.json:
+        print(json.dumps(results, indent=2))
+    else:
+        print_table(results)
+    code = 0 if all(r['status'] == 'healthy' for r in results) else 2
+    if args.notify_webhook:
+        notify_results(args.notify_webhook, args.notify_format, results, code)
+    return code
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,760 @@
+#!/usr/bin/env python3
+"""
+environment.py - Save the inputs of a successful OpenShift install as a
+reusable environment profile and regenerate install-config.yaml from it
+
+Usage:
+  environment.py save NAME (--from INSTALL_DIR_OR_CONFIG | --from-cluster)
+                 [--pull-secret PATH] [--ssh-key PATH] [--release-image IMAGE]
+                 [--secret-ref PATH=SOURCE]... [--store DIR] [--force]
+  environment.py restore NAME --cluster-name NAME [--dir DIR]
+                 [--release-image IMAGE] [--secret-ref PATH=SOURCE]...
+                 [--set PATH=VALUE]... [--store DIR]
+  environment.py list [--store DIR]
+  environment.py show NAME [--store DIR]
+  environment.py export NAME [--namespace NS] [--apply] [--context CTX] [--store DIR]
+  environment.py import NAMESPACE/CONFIGMAP [--name NAME] [--context CTX]
+                 [--pull-secret PATH] [--ssh-key PATH] [--store DIR] [--force]
+  environment.py hive NAME (--cluster-name NAME | --pool NAME [--size N] [--running N])
+                 [--namespace NS] [--image-set NAME] [--release-image IMAGE]
+                 [--credential KEY=SOURCE]... [--vcenter-ca FILE]
+                 [--secret-ref PATH=SOURCE]... [--set PATH=VALUE]...
+                 [--secrets inline|omit] [-o FILE] [--store DIR]
+
+save reads install-config.yaml (or install-config.yaml.backup) from an install
+directory, or the install-config stored in the cluster's
+kube-system/cluster-config-v1 ConfigMap. It removes the cluster name, the pull
+secret, the SSH key, every field named "password", and the user:password
+part of proxy.httpProxy and proxy.httpsProxy, and records where to get them
+again: file paths for the pull secret and SSH key, and a SOURCE per secret
+path ("env:VARIABLE" or "file:PATH"). For a proxy URL, the source gives
+"user:password".
+
+restore fills in the new cluster name and the secrets, applies --set
+overrides (values are parsed as JSON when possible), and writes
+install-config.yaml and a backup copy into a new install directory.
+
+export writes a profile as a ConfigMap (printed as JSON, or applied with oc
+to the current or given context with --apply), so automation in a
+management cluster can read the validated environment: the profile under
+"profile.json", and the platform, base domain, release image, machine
+networks, VIPs, and vSphere failure domains as separate keys. The exported
+profile keeps only "env:" references; local file paths, including the path it
+was saved from, and any credentials left in older profiles are removed. import
+reads such a ConfigMap back into the local store, with the importer's own pull
+secret and SSH key paths. It applies the same filter to the ConfigMap, since
+anyone who can edit it could otherwise point a reference at a local file.
+
+hive converts a profile into Hive manifests for a hub cluster: a
+ClusterImageSet, the install-config, pull secret, and platform credentials
+Secrets, and a ClusterDeployment, or with --pool a ClusterPool that uses the
+install-config as its template. With --secrets omit, no Secret is written and
+the Secrets to create are listed on stderr instead, for GitOps repositories
+that manage secrets separately. Hive requires a certificates Secret for
+vSphere, so a vSphere ClusterDeployment always refers to <name>-vsphere-certs,
+and --vcenter-ca is required to write it unless Secrets are omitted.
+
+Paths look like "platform.vsphere.vcenters[0].password". --set creates
+missing keys, but list elements on the way must exist: "x[0].y" fails unless
+x already has an element 0. The last element of a path may be the next one of
+its list ("x[2]" when x has 2 elements), which appends it; a later index fails.
+
+Profiles are stored as JSON in ~/.config/claude-code/openshift-environments
+unless --store is given.
+
+Exit codes:
+  0 - Success
+  1 - Invalid arguments, missing profile, or unreadable input
+  2 - restore could not resolve a secret (unset variable, missing file)
+
+Requirements: Python 3.6+; PyYAML or yq to read YAML
+"""
+
+import argparse
+import copy
+import datetime
+import json
+import os
+import re
+import subprocess
+import sys
+import urllib.parse
+from typing import Any, Dict, List, Optional, Tuple
+
+FORMAT_VERSION = 1
+DEFAULT_STORE = os.path.expanduser('~/.config/claude-code/openshift-environments')
+
+try:
+    import yaml  # type: ignore
+except ImportError:
+    yaml = None
+
+
+def load_yaml(text: str) -> Any:
+    if yaml is not None:
+        return yaml.safe_load(text)
+    try:
+        out = subprocess.run(['yq', '-o', 'json'], input=text, stdout=subprocess.PIPE,
+                             stderr=subprocess.PIPE, universal_newlines=True, check=True).stdout
+    except FileNotFoundError:
+        raise RuntimeError('reading YAML needs PyYAML or yq')
+    except subprocess.CalledProcessError as e:
+        raise RuntimeError('yq failed: {}'.format(e.stderr.strip()))
+    return json.loads(out)
+
+
+def dump_yaml(data: Any) -> str:
+    # JSON is valid YAML, so the installer accepts either
+    if yaml is not None:
+        return yaml.safe_dump(data, default_flow_style=False, sort_keys=False)
+    return json.dumps(data, indent=2) + '\n'
+
+
+def split_path(path: str) -> List[Any]:
+    parts = []
+    for name, index in re.findall(r'([^.\[\]]+)|\[(\d+)\]', path):
+        parts.append(int(index) if index else name)
+    return parts
+
+
+def join_path(parts: List[Any]) -> str:
+    out = ''
+    for p in parts:
+        out += '[{}]'.format(p) if isinstance(p, int) else ('.' if out else '') + p
+    return out
+
+
+def set_path(data: Any, path: str, value: Any) -> None:
+    """Set the value at path, creating missing keys; list elements must exist already, or be the next one."""
+    parts = split_path(path)
+    if not parts:
+        raise ValueError('empty path: {!r}'.format(path))
+    for i, p in enumerate(parts):
+        where = join_path(parts[:i]) or 'the install-config'
+        if not isinstance(data, list if isinstance(p, int) else dict):
+            raise ValueError('cannot set {}: {} is not a {}'.format(path, where, 'list' if isinstance(p, int) else 'mapping'))
+        if i == len(parts) - 1:
+            break
+        if isinstance(p, int):
+            if p >= len(data):
+                raise ValueError('cannot set {}: {} has {} elements'.format(path, where, len(data)))
+            data = data[p]
+        else:
+            data = data.setdefault(p, [] if isinstance(parts[i + 1], int) else {})
+    last = parts[-1]
+    if isinstance(last, int) and last >= len(data):
+        # appending is fine, a gap would leave nulls in the install-config
+        if last > len(data):
+            raise ValueError('cannot set {}: {} has {} elements'.format(path, join_path(parts[:-1]), len(data)))
+        data.append(value)
+        return
+    data[last] = value
+
+
+PROXY_URLS = ('httpProxy', 'httpsProxy')
+
+
+def split_userinfo(url: str) -> Tuple[str, Optional[str]]:
+    """Return the URL without "user:password@" and the userinfo, or None if it has none."""
+    parts = urllib.parse.urlsplit(url)
+    userinfo, sep, host = parts.netloc.rpartition('@')
+    if not sep:
+        return url, None
+    return urllib.parse.urlunsplit(parts._replace(netloc=host)), userinfo
+
+
+def add_userinfo(url: str, userinfo: str) -> str:
+    """Put "user:password" back into a URL, percent-encoding both so "@" or ":" cannot change the host."""
+    parts = urllib.parse.urlsplit(url)
+    # Unquote first: a value copied from a working URL is already encoded
+    userinfo = ':'.join(urllib.parse.quote(urllib.parse.unquote(p), safe='') for p in userinfo.split(':', 1))
+    return urllib.parse.urlunsplit(parts._replace(netloc='{}@{}'.format(userinfo, parts.netloc)))
+
+
+def strip_secrets(data: Any, prefix: Optional[List[Any]] = None) -> List[str]:
+    """Remove every "password" field and proxy URL credentials in place and return their paths."""
+    prefix = prefix or []
+    found = []
+    if isinstance(data, dict):
+        for key in list(data):
+            if key.lower() == 'password':
+                del data[key]
+                found.append(join_path(prefix + [key]))
+            elif prefix == ['proxy'] and key in PROXY_URLS and isinstance(data[key], str):
+                data[key], userinfo = split_userinfo(data[key])
+                if userinfo is not None:
+                    found.append(join_path(prefix + [key]))
+            else:
+                found.extend(strip_secrets(data[key], prefix + [key]))
+    elif isinstance(data, list):
+        for i, item in enumerate(data):
+            found.extend(strip_secrets(item, prefix + [i]))
+    return found
+
+
+def parse_refs(items: List[str]) -> Dict[str, str]:
+    refs = {}
+    for item in items:
+        path, sep, source = item.partition('=')
+        if not sep or not re.match(r'(env|file):.+', source):
+            raise ValueError('--secret-ref must be PATH=env:VAR or PATH=file:PATH, got {}'.format(item))
+        refs[path] = source
+    return refs
+
+
+def resolve(source: str) -> Optional[str]:
+    kind, _, value = source.partition(':')
+    if kind == 'env':
+        return os.environ.get(value)
+    try:
+        with open(os.path.expanduser(value), encoding='utf-8') as f:
+            return f.read().strip()
+    except OSError:
+        return None
+
+
+def profile_path(store: str, name: str) -> str:
+    if not re.fullmatch(r'[A-Za-z0-9][A-Za-z0-9_.-]*', name):
+        raise ValueError('invalid profile name: {}'.format(name))
+    return os.path.join(store, name + '.json')
+
+
+def read_source(args: argparse.Namespace) -> Tuple[Dict[str, Any], str, Optional[str]]:
+    """Return the install-config, a description of its source, and the release image if known."""
+    if args.from_cluster:
+        cm = subprocess.run(['oc', '-n', 'kube-system', 'get', 'configmap', 'cluster-config-v1',
+                             '-o', 'jsonpath={.data.install-config}'], stdout=subprocess.PIPE,
+                            stderr=subprocess.PIPE, universal_newlines=True)
+        if cm.returncode != 0:
+            raise RuntimeError('cannot read cluster-config-v1: {}'.format(cm.stderr.strip()))
+        image = subprocess.run(['oc', 'get', 'clusterversion', 'version', '-o', 'jsonpath={.status.desired.image}'],
+                               stdout=subprocess.PIPE, stderr=subprocess.DEVNULL, universal_newlines=True).stdout
+        return load_yaml(cm.stdout), 'cluster', image or None
+
+    path = args.source
+    if os.path.isdir(path):
+        for name in ('install-config.yaml.backup', 'install-config.yaml'):
+            if os.path.exists(os.path.join(path, name)):
+                path = os.path.join(path, name)
+                break
+        else:
+            raise RuntimeError('no install-config.yaml or install-config.yaml.backup in {}'.format(args.source))
+    with open(path, encoding='utf-8') as f:
+        return load_yaml(f.read()), os.path.abspath(path), None
+
+
+def cmd_save(args: argparse.Namespace) -> int:
+    config, source, image = read_source(args)
+    config = copy.deepcopy(config)
+    cluster_name = (config.get('metadata') or {}).pop('name', None)
+    if not config.get('metadata'):
+        config.pop('metadata', None)
+    config.pop('pullSecret', None)
+    config.pop('sshKey', None)
+    secrets = strip_secrets(config)
+
+    refs = parse_refs(args.secret_ref)
+    unknown = sorted(set(refs) - set(secrets))
+    if unknown:
+        print('Warning: --secret-ref for paths without a secret field: {}'.format(', '.join(unknown)),
+              file=sys.stderr)
+
+    profile = {
+        'formatVersion': FORMAT_VERSION,
+        'name': args.name,
+        'created': datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ'),
+        'source': {'from': source, 'clusterName': cluster_name},
+        'releaseImage': args.release_image or image,
+        'refs': {
+            'pullSecret': args.pull_secret,
+            'sshKey': args.ssh_key,
+            'secrets': {path: refs.get(path) for path in secrets},
+        },
+        'installConfig': config,
+    }
+
+    path = profile_path(args.store, args.name)
+    if os.path.exists(path) and not args.force:
+        print('Error: profile {} exists; use --force to replace it'.format(path), file=sys.stderr)
+        return 1
+    os.makedirs(args.store, mode=0o700, exist_ok=True)
+    with open(path, 'w', encoding='utf-8') as f:
+        json.dump(profile, f, indent=2)
+        f.write('\n')
+    print('Saved {} (from {}, platform {}, {} secret fields)'.format(
+        path, cluster_name or source, ', '.join((config.get('platform') or {}).keys()) or '-', len(secrets)))
+    missing = [p for p, r in profile['refs']['secrets'].items() if not r]
+    if missing:
+        print('Secrets without a source, needed at restore: {}'.format(', '.join(missing)))
+    return 0
+
+
+def load_profile(store: str, name: str) -> Dict[str, Any]:
+    with open(profile_path(store, name), encoding='utf-8') as f:
+        profile = json.load(f)
+    if profile.get('formatVersion') != FORMAT_VERSION:
+        raise ValueError('unsupported profile format {}'.format(profile.get('formatVersion')))
+    return profile
+
+
+def build_install_config(profile: Dict[str, Any], args: argparse.Namespace) -> Tuple[Dict[str, Any], List[str]]:
+    """Return the install-config for args.cluster_name with secrets and overrides applied, and what is unresolved."""
+    config = copy.deepcopy(profile['installConfig'])
+    metadata = dict(config.pop('metadata', None) or {}, name=args.cluster_name)
+    config = dict({'apiVersion': config.pop('apiVersion', 'v1'),
+                   'baseDomain': config.pop('baseDomain', None),
+                   'metadata': metadata}, **config)
+
+    refs = dict(profile['refs'].get('secrets') or {})
+    refs.update(parse_refs(args.secret_ref))
+    unresolved = []
+    for path, source in sorted(refs.items()):
+        value = resolve(source) if source else None
+        if value is None:
+            unresolved.append('{} ({})'.format(path, source or 'no source'))
+        elif path in ['proxy.' + k for k in PROXY_URLS] and (config.get('proxy') or {}).get(path[6:]):
+            config['proxy'][path[6:]] = add_userinfo(config['proxy'][path[6:]], value)
+        else:
+            set_path(config, path, value)
+
+    for name, key in (('pullSecret', 'pullSecret'), ('sshKey', 'sshKey')):
+        ref = profile['refs'].get(name)
+        if ref:
+            try:
+                with open(os.path.expanduser(ref), encoding='utf-8') as f:
+                    config[key] = f.read().strip()
+            except OSError as e:
+                unresolved.append('{} ({}: {})'.format(name, ref, e.strerror or e))
+        elif name == 'pullSecret':
+            unresolved.append('pullSecret (no path saved)')
+
+    for item in args.set:
+        path, sep, raw = item.partition('=')
+        if not sep:
+            raise ValueError('--set must be PATH=VALUE, got {}'.format(item))
+        try:
+            value = json.loads(raw)
+        except ValueError:
+            value = raw
+        set_path(config, path, value)
+    return config, unresolved
+
+
+def report_unresolved(unresolved: List[str]) -> int:
+    print('Error: cannot resolve: {}'.format('; '.join(unresolved)), file=sys.stderr)
+    print('Pass --secret-ref PATH=env:VAR or PATH=file:PATH, or save the profile again with the references',
+          file=sys.stderr)
+    return 2
+
+
+def cmd_restore(args: argparse.Namespace) -> int:
+    profile = load_profile(args.store, args.name)
+    config, unresolved = build_install_config(profile, args)
+    if unresolved:
+        return report_unresolved(unresolved)
+
+    out_dir = args.dir or '{}-install-{}'.format(args.cluster_name, datetime.datetime.now().strftime('%Y%m%d-%H%M%S'))
+    os.makedirs(out_dir, exist_ok=True)
+    if os.path.exists(os.path.join(out_dir, 'install-config.yaml')):
+        print('Error: {} already has an install-config.yaml'.format(out_dir), file=sys.stderr)
+        return 1
+    text = dump_yaml(config)
+    for name in ('install-config.yaml', 'install-config.yaml.backup'):
+        fd = os.open(os.path.join(out_dir, name), os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0o600)
+        with os.fdopen(fd, 'w', encoding='utf-8') as f:
+            f.write(text)
+    print('Wrote {}/install-config.yaml for {}.{}'.format(out_dir, args.cluster_name, config.get('baseDomain')))
+    image = args.release_image or profile.get('releaseImage')
+    if image:
+        print('Release image: {}'.format(image))
+    return 0
+
+
+def cmd_list(args: argparse.Namespace) -> int:
+    if not os.path.isdir(args.store):
+        print('No profiles in {}'.format(args.store))
+        return 0
+    for name in sorted(os.listdir(args.store)):
+        if not name.endswith('.json'):
+            continue
+        try:
+            profile = load_profile(args.store, name[:-5])
+            config = profile['installConfig']
+            line = '{:<24} {:<10} {:<28} {}  from {}'.format(
+                profile['name'], ','.join((config.get('platform') or {}).keys()), config.get('baseDomain') or '-',
+                profile['created'][:10], profile['source'].get('clusterName') or profile['source'].get('from'))
+        except (OSError, ValueError, KeyError, AttributeError) as e:
+            print('Warning: skipping {}: {}'.format(name, e), file=sys.stderr)
+            continue
+        print(line)
+    return 0
+
+
+def cmd_show(args: argparse.Namespace) -> int:
+    print(json.dumps(load_profile(args.store, args.name), indent=2))
+    return 0
+
+
+CONFIGMAP_LABELS = {
+    'app.kubernetes.io/managed-by': 'ai-helpers',
+    'app.kubernetes.io/component': 'environment-profile',
+}
+
+
+def oc_args(context: Optional[str]) -> List[str]:
+    return ['oc'] + (['--context', context] if context else [])
+
+
+def drop_local_refs(profile: Dict[str, Any]) -> List[str]:
+    """Keep only "env:" secret references and remove the pull secret and SSH key paths; return what was removed."""
+    refs = profile['refs']
+    dropped = []
+    secrets = {}
+    for path, source in (refs.get('secrets') or {}).items():
+        if source and not source.startswith('env:'):
+            dropped.append('{} ({})'.format(path, source))
+            source = None
+        secrets[path] = source
+    refs['secrets'] = secrets
+    for name in ('pullSecret', 'sshKey'):
+        if refs.get(name):
+            dropped.append('{} ({})'.format(name, refs[name]))
+        refs[name] = None
+    return dropped
+
+
+def shareable(profile: Dict[str, Any]) -> Dict[str, Any]:
+    """Return a copy of the profile without credentials or local file paths, for publishing."""
+    profile = copy.deepcopy(profile)
+    for path in strip_secrets(profile['installConfig']):
+        profile['refs'].setdefault('secrets', {}).setdefault(path, None)
+    drop_local_refs(profile)
+    # the install directory or install-config path of whoever saved it
+    profile['source'] = {k: v for k, v in (profile.get('source') or {}).items() if k != 'from'}
+    return profile
+
+
+def configmap(profile: Dict[str, Any], namespace: str) -> Dict[str, Any]:
+    profile = shareable(profile)
+    config = profile['installConfig']
+    platform = config.get('platform') or {}
+    networking = config.get('networking') or {}
+    data = {
+        'profile.json': json.dumps(profile, indent=2),
+        'platform': ','.join(platform.keys()),
+        'baseDomain': config.get('baseDomain') or '',
+        'machineNetworks': ','.join(n.get('cidr', '') for n in networking.get('machineNetwork') or []),
+        'sourceCluster': profile['source'].get('clusterName') or '',
+    }
+    if profile.get('releaseImage'):
+        data['releaseImage'] = profile['releaseImage']
+    for name, settings in platform.items():
+        if not isinstance(settings, dict):
+            continue
+        for key in ('apiVIPs', 'ingressVIPs'):
+            if settings.get(key):
+                data[key] = ','.join(settings[key])
+        if name == 'vsphere' and settings.get('failureDomains'):
+            data['failureDomains.json'] = json.dumps(settings['failureDomains'], indent=2)
+    return {
+        'apiVersion': 'v1',
+        'kind': 'ConfigMap',
+        'metadata': {
+            'name': re.sub(r'[^a-z0-9.-]', '-', profile['name'].lower()),
+            'namespace': namespace,
+            'labels': CONFIGMAP_LABELS,
+        },
+        'data': data,
+    }
+
+
+def cmd_export(args: argparse.Namespace) -> int:
+    manifest = json.dumps(configmap(load_profile(args.store, args.name), args.namespace), indent=2)
+    if not args.apply:
+        print(manifest)
+        return 0
+    proc = subprocess.run(oc_args(args.context) + ['apply', '-f', '-'], input=manifest,
+                          stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+    if proc.returncode != 0:
+        raise RuntimeError('oc apply failed: {}'.format(proc.stderr.strip()))
+    print(proc.stdout.strip())
+    return 0
+
+
+def cmd_import(args: argparse.Namespace) -> int:
+    namespace, sep, name = args.source.partition('/')
+    if not sep or not name:
+        raise ValueError('import needs NAMESPACE/CONFIGMAP, got {}'.format(args.source))
+    proc = subprocess.run(oc_args(args.context) + ['-n', namespace, 'get', 'configmap', name, '-o', 'json'],
+                          stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+    if proc.returncode != 0:
+        raise RuntimeError('cannot read configmap {}: {}'.format(args.source, proc.stderr.strip()))
+    raw = (json.loads(proc.stdout).get('data') or {}).get('profile.json')
+    if not raw:
+        raise RuntimeError('configmap {} has no profile.json key'.format(args.source))
+    profile = json.loads(raw)
+    if profile.get('formatVersion') != FORMAT_VERSION:
+        raise ValueError('unsupported profile format {}'.format(profile.get('formatVersion')))
+
+    # a hand-edited ConfigMap may carry passwords; never store them locally
+    profile['refs'] = profile.get('refs') or {}
+    for path in strip_secrets(profile['installConfig']):
+        print('Warning: removed {} from the imported profile'.format(path), file=sys.stderr)
+        profile['refs'].setdefault('secrets', {}).setdefault(path, None)
+    # file references would make restore read local files named by whoever can write the ConfigMap
+    for ref in drop_local_refs(profile):
+        print('Warning: ignored the reference {} from the ConfigMap; only env: references are imported'.format(ref),
+              file=sys.stderr)
+    profile['refs']['pullSecret'] = args.pull_secret
+    profile['refs']['sshKey'] = args.ssh_key
+    profile['name'] = args.name or profile['name']
+    source = {k: v for k, v in (profile.get('source') or {}).items() if k != 'from'}
+    profile['source'] = dict(source, imported='configmap:{}'.format(args.source))
+
+    path = profile_path(args.store, profile['name'])
+    if os.path.exists(path) and not args.force:
+        print('Error: profile {} exists; use --force to replace it'.format(path), file=sys.stderr)
+        return 1
+    os.makedirs(args.store, mode=0o700, exist_ok=True)
+    with open(path, 'w', encoding='utf-8') as f:
+        json.dump(profile, f, indent=2)
+        f.write('\n')
+    print('Imported {} from configmap {}'.format(path, args.source))
+    return 0
+
+
+HIVE_PLATFORMS = ('aws', 'azure', 'gcp', 'vsphere')
+
+
+def image_set_name(image: str) -> str:
+    if '@' in image:
+        return 'img-' + image.split('@')[-1].split(':')[-1][:12]
+    last = image.rsplit('/', 1)[-1]
+    tag = last.rsplit(':', 1)[-1] if ':' in last else 'latest'
+    return 'img' + re.sub(r'[^a-z0-9.-]', '-', tag.lower())
+
+
+def secret(name: str, namespace: str, data: Dict[str, str], stype: str = 'Opaque') -> Dict[str, Any]:
+    return {'apiVersion': 'v1', 'kind': 'Secret', 'metadata': {'name': name, 'namespace': namespace},
+            'type': stype, 'stringData': data}
+
+
+def hive_platform(config: Dict[str, Any], creds: str, certs: str) -> Tuple[str, Dict[str, Any]]:
+    """Map the install-config platform onto the ClusterDeployment/ClusterPool platform section."""
+    platforms = [p for p in (config.get('platform') or {}) if p in HIVE_PLATFORMS]
+    if not platforms:
+        raise ValueError('platform {} is not provisioned by Hive ClusterDeployments; supported: {}'.format(
+            ','.join((config.get('platform') or {}).keys()) or '-', ', '.join(HIVE_PLATFORMS)))
+    name = platforms[0]
+    settings = config['platform'][name] or {}
+    out = {'credentialsSecretRef': {'name': creds}}
+    if name in ('aws', 'gcp'):
+        out['region'] = settings.get('region')
+    elif name == 'azure':
+        out['region'] = settings.get('region')
+        out['baseDomainResourceGroupName'] = settings.get('baseDomainResourceGroupName')
+    else:
+        fd = (settings.get('failureDomains') or [{}])[0]
+        topology = fd.get('topology') or {}
+        vcenter = (settings.get('vcenters') or [{}])[0]
+        out.update({
+            'vCenter': fd.get('server') or vcenter.get('server') or settings.get('vCenter'),
+            'datacenter': topology.get('datacenter') or settings.get('datacenter'),
+            'defaultDatastore': (topology.get('datastore') or settings.get('defaultDatastore') or '').split('/')[-1],
+            'cluster': (topology.get('computeCluster') or settings.get('cluster') or '').split('/')[-1],
+            'network': (topology.get('networks') or [settings.get('network')])[0],
+        })
+        if topology.get('folder') or settings.get('folder'):
+            out['folder'] = topology.get('folder') or settings.get('folder')
+        # required by Hive for vSphere: the installer and the cluster need to trust vCenter
+        out['certificatesSecretRef'] = {'name': certs}
+    return name, {name: out}
+
+
+def platform_credentials(name: str, config: Dict[str, Any], creds: Dict[str, str]) -> Dict[str, str]:
+    if name == 'vsphere':
+        vcenter = (config['platform']['vsphere'].get('vcenters') or [{}])[0]
+        data = {'username': vcenter.get('user') or config['platform']['vsphere'].get('username') or '',
+                'password': vcenter.get('password') or config['platform']['vsphere'].get('password') or ''}
+        data.update(creds)
+        return data
+    keys = {'aws': ['aws_access_key_id', 'aws_secret_access_key'],
+            'azure': ['osServicePrincipal.json'], 'gcp': ['osServiceAccount.json']}[name]
+    missing = [k for k in keys if k not in creds]
+    if missing:
+        raise ValueError('{} credentials need --credential for: {}'.format(name, ', '.join(missing)))
+    return creds
+
+
+def cmd_hive(args: argparse.Namespace) -> int:
+    profile = load_profile(args.store, args.name)
+    args.cluster_name = args.cluster_name or args.pool_name or args.name
+    config, unresolved = build_install_config(profile, args)
+    if unresolved and args.secrets == 'inline':
+        return report_unresolved(unresolved)
+
+    image = args.release_image or profile.get('releaseImage')
+    if not image:
+        raise ValueError('the profile has no release image; pass --release-image')
+    base = args.pool_name or args.cluster_name
+    ns = args.namespace or base
+    names = {'installConfig': base + '-install-config', 'pullSecret': base + '-pull-secret',
+             'creds': base + '-creds', 'certs': base + '-vsphere-certs'}
+    image_set = args.image_set or image_set_name(image)
+    platform, platform_spec = hive_platform(config, names['creds'], names['certs'])
+    if platform != 'vsphere':
+        names['certs'] = None
+    elif args.secrets == 'inline' and not args.vcenter_ca:
+        raise ValueError('vSphere needs the vCenter CA bundle for the {} Secret: pass --vcenter-ca FILE, '
+                         'or --secrets omit and create the Secret separately'.format(names['certs']))
+
+    creds = {}
+    for item in args.credential:
+        key, sep, source = item.partition('=')
+        value = resolve(source) if sep and re.match(r'(env|file):.+', source) else None
+        if value is None:
+            if args.secrets == 'inline':
+                raise ValueError('--credential {} could not be resolved'.format(item))
+            continue
+        creds[key] = value
+
+    docs = []
+    if not args.namespace:
+        docs.append({'apiVersion': 'v1', 'kind': 'Namespace', 'metadata': {'name': ns}})
+    docs.append({'apiVersion': 'hive.openshift.io/v1', 'kind': 'ClusterImageSet',
+                 'metadata': {'name': image_set}, 'spec': {'releaseImage': image}})
+
+    secrets = []
+    pull_secret = config.pop('pullSecret', None)
+    ic = dict(config)
+    if args.secrets == 'inline':
+        secrets.append(secret(names['pullSecret'], ns, {'.dockerconfigjson': pull_secret or ''},
+                              'kubernetes.io/dockerconfigjson'))
+        secrets.append(secret(names['installConfig'], ns, {'install-config.yaml': dump_yaml(ic)}))
+        secrets.append(secret(names['creds'], ns, platform_credentials(platform, config, creds)))
+        if names['certs']:
+            with open(os.path.expanduser(args.vcenter_ca), encoding='utf-8') as f:
+                secrets.append(secret(names['certs'], ns, {'.cacert': f.read()}))
+    docs.extend(secrets)
+
+    spec = {
+        'baseDomain': config.get('baseDomain'),
+        'platform': platform_spec,
+        'pullSecretRef': {'name': names['pullSecret']},
+    }
+    if args.pool_name:
+        spec.update({'imageSetRef': {'name': image_set},
+                     'installConfigSecretTemplateRef': {'name': names['installConfig']},
+                     'size': args.size})
+        if args.running is not None:
+            spec['runningCount'] = args.running
+        docs.append({'apiVersion': 'hive.openshift.io/v1', 'kind': 'ClusterPool',
+                     'metadata': {'name': args.pool_name, 'namespace': ns}, 'spec': spec})
+    else:
+        spec.update({'clusterName': args.cluster_name,
+                     'provisioning': {'installConfigSecretRef': {'name': names['installConfig']},
+                                      'imageSetRef': {'name': image_set}}})
+        docs.append({'apiVersion': 'hive.openshift.io/v1', 'kind': 'ClusterDeployment',
+                     'metadata': {'name': args.cluster_name, 'namespace': ns}, 'spec': spec})
+
+    if yaml is not None:
+        text = yaml.safe_dump_all(docs, default_flow_style=False, sort_keys=False)
+    else:
+        text = json.dumps({'apiVersion': 'v1', 'kind': 'List', 'items': docs}, indent=2) + '\n'
+    if args.output:
+        fd = os.open(args.output, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, 0o600)
+        with os.fdopen(fd, 'w', encoding='utf-8') as f:
+            f.write(text)
+        print('Wrote {} ({})'.format(args.output, ', '.join(d['kind'] for d in docs)))
+    else:
+        sys.stdout.write(text)
+
+    if args.secrets == 'omit':
+        print('Secrets to create in namespace {}:'.format(ns), file=sys.stderr)
+        print('  {}  (kubernetes.io/dockerconfigjson, .dockerconfigjson)'.format(names['pullSecret']),
+              file=sys.stderr)
+        print('  {}  (install-config.yaml; restore the profile for its content)'.format(names['installConfig']),
+              file=sys.stderr)
+        keys = {'vsphere': 'username, password', 'aws': 'aws_access_key_id, aws_secret_access_key',
+                'azure': 'osServicePrincipal.json', 'gcp': 'osServiceAccount.json'}[platform]
+        print('  {}  ({})'.format(names['creds'], keys), file=sys.stderr)
+        if names['certs']:
+            print('  {}  (.cacert, the vCenter CA bundle)'.format(names['certs']), file=sys.stderr)
+    return 0
+
+
+def main() -> int:
+    common = argparse.ArgumentParser(add_help=False)
+    common.add_argument('--store', default=DEFAULT_STORE, help='profile directory (default {})'.format(DEFAULT_STORE))
+    parser = argparse.ArgumentParser(description='Save and restore OpenShift install environment profiles')
+    sub = parser.add_subparsers(dest='command')
+
+    p = sub.add_parser('save', help='save an environment profile from an install', parents=[common])
+    p.add_argument('name')
+    group = p.add_mutually_exclusive_group(required=True)
+    group.add_argument('--from', dest='source', help='install directory or install-config.yaml')
+    group.add_argument('--from-cluster', action='store_true', help='the cluster of the current context')
+    p.add_argument('--pull-secret', help='path of the pull secret file to use at restore')
+    p.add_argument('--ssh-key', help='path of the SSH public key to use at restore')
+    p.add_argument('--release-image')
+    p.add_argument('--secret-ref', action='append', default=[], metavar='PATH=SOURCE')
+    p.add_argument('--force', action='store_true')
+
+    p = sub.add_parser('restore', help='write install-config.yaml from a profile', parents=[common])
+    p.add_argument('name')
+    p.add_argument('--cluster-name', required=True)
+    p.add_argument('--dir')
+    p.add_argument('--release-image')
+    p.add_argument('--secret-ref', action='append', default=[], metavar='PATH=SOURCE')
+    p.add_argument('--set', action='append', default=[], metavar='PATH=VALUE')
+
+    sub.add_parser('list', help='list saved profiles', parents=[common])
+    p = sub.add_parser('show', help='print a profile', parents=[common])
+    p.add_argument('name')
+    p = sub.add_parser('export', help='write a profile as a ConfigMap', parents=[common])
+    p.add_argument('name')
+    p.add_argument('--namespace', default='openshift-environments')
+    p.add_argument('--apply', action='store_true', help='oc apply the ConfigMap instead of printing it')
+    p.add_argument('--context', help='kubeconfig context of the management cluster')
+    p = sub.add_parser('hive', help='write Hive ClusterDeployment or ClusterPool manifests', parents=[common])
+    p.add_argument('name')
+    group = p.add_mutually_exclusive_group()
+    group.add_argument('--cluster-name')
+    group.add_argument('--pool', dest='pool_name', metavar='NAME', help='write a ClusterPool instead of a ClusterDeployment')
+    p.add_argument('--size', type=int, default=1, help='ClusterPool size (default 1)')
+    p.add_argument('--running', type=int, help='ClusterPool runningCount')
+    p.add_argument('--namespace', help='namespace of the objects (default: the cluster name)')
+    p.add_argument('--image-set', help='ClusterImageSet name (default: from the release image tag)')
+    p.add_argument('--release-image')
+    p.add_argument('--secret-ref', action='append', default=[], metavar='PATH=SOURCE')
+    p.add_argument('--credential', action='append', default=[], metavar='KEY=SOURCE',
+                   help='key of the platform credentials Secret, e.g. aws_access_key_id=env:AWS_ACCESS_KEY_ID')
+    p.add_argument('--vcenter-ca', metavar='FILE',
+                   help='vCenter CA bundle for the certificates Secret (required for vSphere with --secrets inline)')
+    p.add_argument('--set', action='append', default=[], metavar='PATH=VALUE')
+    p.add_argument('--secrets', choices=['inline', 'omit'], default='inline',
+                   help='write the Secrets (default), or only list the ones to create')
+    p.add_argument('-o', '--output', help='write to this file (mode 0600) instead of stdout')
+    p = sub.add_parser('import', help='read a profile from a ConfigMap', parents=[common])
+    p.add_argument('source', metavar='NAMESPACE/CONFIGMAP')
+    p.add_argument('--name', help='store under this profile name')
+    p.add_argument('--context', help='kubeconfig context of the management cluster')
+    p.add_argument('--pull-secret', help='path of the pull secret file to use at restore')
+    p.add_argument('--ssh-key', help='path of the SSH public key to use at restore')
+    p.add_argument('--force', action='store_true')
+
+    args = parser.parse_args()
+    commands = {'save': cmd_save, 'restore': cmd_restore, 'list': cmd_list, 'show': cmd_show,
+                'export': cmd_export, 'import': cmd_import, 'hive': cmd_hive}
+    if args.command not in commands:
+        parser.print_help(sys.stderr)
+        return 1
+    try:
+        return commands[args.command](args)
+    except (RuntimeError, OSError, ValueError, KeyError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
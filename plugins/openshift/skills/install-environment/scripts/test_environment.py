@@ -0,0 +1,129 @@
+#!/usr/bin/env python3
+"""Tests for environment profile export and import, and --set paths."""
+
+import json
+import os
+import stat
+import subprocess
+import sys
+import tempfile
+from pathlib import Path
+
+SCRIPT = Path(__file__).resolve().parent / "environment.py"
+
+INSTALL_CONFIG = {
+    "apiVersion": "v1",
+    "baseDomain": "example.com",
+    "metadata": {"name": "lab1"},
+    "platform": {"vsphere": {
+        "apiVIPs": ["10.0.0.10"],
+        "vcenters": [{"server": "vc.example.com", "user": "admin", "password": "secret"}],
+    }},
+    "pullSecret": "{}",
+    "sshKey": "ssh-ed25519 AAAA",
+}
+
+
+def run(*args, env=None):
+    return subprocess.run([sys.executable, str(SCRIPT)] + list(args), stdout=subprocess.PIPE,
+                          stderr=subprocess.PIPE, universal_newlines=True, env=env)
+
+
+def strings(value):
+    if isinstance(value, dict):
+        for v in value.values():
+            yield from strings(v)
+    elif isinstance(value, list):
+        for v in value:
+            yield from strings(v)
+    elif isinstance(value, str):
+        yield value
+
+
+def fake_oc(bin_dir, configmap):
+    """An oc that prints configmap for "get configmap"."""
+    data = Path(bin_dir) / "configmap.json"
+    data.write_text(json.dumps(configmap))
+    oc = Path(bin_dir) / "oc"
+    oc.write_text("#!/bin/sh\ncat {}\n".format(data))
+    oc.chmod(oc.stat().st_mode | stat.S_IEXEC)
+
+
+def set_error(data, path):
+    sys.path.insert(0, str(SCRIPT.parent))
+    from environment import set_path
+    try:
+        set_path(data, path, "value")
+    except ValueError as e:
+        return str(e)
+    return None
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+if __name__ == "__main__":
+    results = []
+
+    with tempfile.TemporaryDirectory() as tmp:
+        store = os.path.join(tmp, "store")
+        install_dir = Path(tmp) / "install"
+        install_dir.mkdir()
+        # JSON is valid YAML
+        (install_dir / "install-config.yaml").write_text(json.dumps(INSTALL_CONFIG))
+        saved = run("save", "lab", "--from", str(install_dir), "--store", store,
+                    "--pull-secret", os.path.join(tmp, "pull-secret.json"), "--ssh-key", os.path.join(tmp, "id.pub"),
+                    "--secret-ref", "platform.vsphere.vcenters[0].password=file:" + os.path.join(tmp, "vc-password"))
+        results.append(test("save succeeds", saved.returncode == 0))
+
+        exported = run("export", "lab", "--store", store)
+        results.append(test("export succeeds", exported.returncode == 0))
+        cm = json.loads(exported.stdout or "{}")
+        profile = json.loads(cm.get("data", {}).get("profile.json", "{}"))
+        values = list(strings(cm)) + list(strings(profile))
+        results.append(test("export leaves no absolute path",
+                            not [v for v in values if v.startswith("/") or tmp in v]))
+        results.append(test("export drops source.from", "from" not in profile.get("source", {})))
+        results.append(test("export keeps the source cluster name", cm.get("data", {}).get("sourceCluster") == "lab1"))
+        results.append(test("export turns file references into missing ones",
+                            profile.get("refs", {}).get("secrets") == {"platform.vsphere.vcenters[0].password": None}))
+
+        # a ConfigMap edited to read local files at restore
+        profile["refs"] = {
+            "pullSecret": os.path.join(tmp, "stolen"),
+            "sshKey": "~/.ssh/id_rsa",
+            "secrets": {"platform.vsphere.vcenters[0].password": "file:~/.aws/credentials",
+                        "proxy.httpProxy": "env:PROXY_USERINFO"},
+        }
+        profile["source"]["from"] = "/home/someone/install"
+        bin_dir = Path(tmp) / "bin"
+        bin_dir.mkdir()
+        fake_oc(bin_dir, {"data": {"profile.json": json.dumps(profile)}})
+        env = dict(os.environ, PATH="{}{}{}".format(bin_dir, os.pathsep, os.environ.get("PATH", "")))
+        imported = run("import", "openshift-environments/lab", "--name", "lab-imported", "--store", store,
+                       "--pull-secret", os.path.join(tmp, "my-pull-secret.json"), env=env)
+        results.append(test("import succeeds", imported.returncode == 0))
+        with open(os.path.join(store, "lab-imported.json")) as f:
+            local = json.load(f)
+        refs = local["refs"]
+        results.append(test("import drops file references",
+                            refs["secrets"] == {"platform.vsphere.vcenters[0].password": None,
+                                                "proxy.httpProxy": "env:PROXY_USERINFO"}))
+        results.append(test("import takes the pull secret path from the command line only",
+                            refs["pullSecret"] == os.path.join(tmp, "my-pull-secret.json")))
+        results.append(test("import drops the ConfigMap's SSH key path", refs["sshKey"] is None))
+        results.append(test("import warns for each dropped reference", imported.stderr.count("Warning: ignored") == 3))
+        results.append(test("import drops source.from", "from" not in local["source"]))
+
+    data = {"compute": [{"name": "worker"}]}
+    results.append(test("set appends the next list element", set_error(data, "compute[1]") is None
+                        and data["compute"][1] == "value"))
+    results.append(test("set refuses an index past the end", set_error(data, "compute[3]") is not None
+                        and len(data["compute"]) == 2))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
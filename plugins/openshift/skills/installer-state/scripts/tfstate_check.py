@@ -0,0 +1,179 @@
+#!/usr/bin/env python3
+"""
+tfstate_check.py - Check that the resources in an OpenShift installer's
+Terraform state still exist on the platform
+
+Usage:
+  tfstate_check.py INSTALL_DIR [--region REGION] [--parallel N] [--json]
+
+Reads terraform.tfstate and the per-stage terraform.<stage>.tfstate files
+that openshift-install leaves in the install directory, and looks up every
+managed resource instance with the platform CLI: aws for AWS, govc for
+vSphere. Resource types without a lookup are reported as unchecked.
+
+Each resource gets a status:
+  present   - the lookup found it
+  missing   - the platform reports it does not exist (or terminated/deleted)
+  error     - the lookup failed for another reason (permissions, network)
+  unchecked - no lookup for this resource type
+
+The AWS region defaults to the one in metadata.json.
+
+Exit codes:
+  0 - Every checked resource is present
+  1 - No state found, or invalid arguments
+  2 - At least one resource is missing or could not be checked because of an error
+
+Requirements: Python 3.6+; aws (AWS) or govc (vSphere)
+"""
+
+import argparse
+import concurrent.futures
+import glob
+import json
+import os
+import re
+import subprocess
+import sys
+from typing import Any, Dict, List, Optional
+
+NOT_FOUND = re.compile(r'NotFound|NoSuch|not found|Not Found|\(404\)|does not exist', re.IGNORECASE)
+
+# type -> (argv after the CLI name, with {id}; output values that mean the resource is gone)
+AWS_LOOKUPS = {
+    'aws_instance': (['ec2', 'describe-instances', '--instance-ids', '{id}',
+                      '--query', 'Reservations[].Instances[].State.Name'], ['terminated', 'shutting-down']),
+    'aws_vpc': (['ec2', 'describe-vpcs', '--vpc-ids', '{id}'], []),
+    'aws_subnet': (['ec2', 'describe-subnets', '--subnet-ids', '{id}'], []),
+    'aws_security_group': (['ec2', 'describe-security-groups', '--group-ids', '{id}'], []),
+    'aws_internet_gateway': (['ec2', 'describe-internet-gateways', '--internet-gateway-ids', '{id}'], []),
+    'aws_nat_gateway': (['ec2', 'describe-nat-gateways', '--nat-gateway-ids', '{id}',
+                         '--query', 'NatGateways[].State'], ['deleted', 'deleting']),
+    'aws_eip': (['ec2', 'describe-addresses', '--allocation-ids', '{id}'], []),
+    'aws_route_table': (['ec2', 'describe-route-tables', '--route-table-ids', '{id}'], []),
+    'aws_ebs_volume': (['ec2', 'describe-volumes', '--volume-ids', '{id}'], []),
+    'aws_network_interface': (['ec2', 'describe-network-interfaces', '--network-interface-ids', '{id}'], []),
+    'aws_lb': (['elbv2', 'describe-load-balancers', '--load-balancer-arns', '{id}'], []),
+    'aws_lb_target_group': (['elbv2', 'describe-target-groups', '--target-group-arns', '{id}'], []),
+    'aws_iam_role': (['iam', 'get-role', '--role-name', '{id}'], []),
+    'aws_iam_instance_profile': (['iam', 'get-instance-profile', '--instance-profile-name', '{id}'], []),
+    'aws_s3_bucket': (['s3api', 'head-bucket', '--bucket', '{id}'], []),
+    'aws_route53_zone': (['route53', 'get-hosted-zone', '--id', '{id}'], []),
+}
+
+# vSphere objects are recorded by managed object ID (e.g. vm-123, group-v45) or, for VMs, by instance UUID
+VSPHERE_LOOKUPS = {
+    'vsphere_virtual_machine': ['vm.info', '-vm.uuid', '{id}'],
+    'vsphere_folder': ['object.collect', '-s', 'Folder:{id}', 'name'],
+    'vsphereprivate_import_ova': ['object.collect', '-s', 'VirtualMachine:{id}', 'name'],
+    'vsphere_tag': ['tags.info', '{id}'],
+    'vsphere_tag_category': ['tags.category.info', '{id}'],
+}
+
+
+def load_states(install_dir: str) -> List[Dict[str, Any]]:
+    """Return one entry per managed resource instance in the install directory's state files."""
+    files = glob.glob(os.path.join(install_dir, 'terraform.tfstate'))
+    files += sorted(glob.glob(os.path.join(install_dir, 'terraform.*.tfstate')))
+    out = []
+    for path in files:
+        with open(path, encoding='utf-8') as f:
+            state = json.load(f)
+        if state.get('version') != 4:
+            raise ValueError('{}: unsupported state version {}'.format(path, state.get('version')))
+        for res in state.get('resources', []):
+            if res.get('mode') != 'managed':
+                continue
+            for inst in res.get('instances', []):
+                attrs = inst.get('attributes') or {}
+                out.append({
+                    'state': os.path.basename(path),
+                    'address': '{}{}.{}{}'.format(res['module'] + '.' if res.get('module') else '', res['type'],
+                                                  res['name'], '[{}]'.format(json.dumps(inst['index_key']))
+                                                  if 'index_key' in inst else ''),
+                    'type': res['type'],
+                    'id': attrs.get('id') or '',
+                    'name': attrs.get('name') or (attrs.get('tags') or {}).get('Name') or '',
+                })
+    return out
+
+
+def run(argv: List[str]) -> subprocess.CompletedProcess:
+    return subprocess.run(argv, stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True, timeout=60)
+
+
+def check(res: Dict[str, Any], region: Optional[str]) -> Dict[str, Any]:
+    res = dict(res, status='unchecked', detail='')
+    if res['type'] in AWS_LOOKUPS:
+        args, gone = AWS_LOOKUPS[res['type']]
+        argv = ['aws'] + [a.format(id=res['id']) for a in args] + ['--output', 'text']
+        if region and res['type'].split('_')[1] not in ('iam', 's3', 'route53'):
+            argv += ['--region', region]
+    elif res['type'] in VSPHERE_LOOKUPS:
+        argv = ['govc'] + [a.format(id=res['id']) for a in VSPHERE_LOOKUPS[res['type']]]
+        gone = []
+    else:
+        return res
+    if not res['id']:
+        return dict(res, status='error', detail='no id in state')
+    try:
+        proc = run(argv)
+    except FileNotFoundError:
+        return dict(res, status='error', detail='{} not found in PATH'.format(argv[0]))
+    except subprocess.TimeoutExpired:
+        return dict(res, status='error', detail='lookup timed out')
+    text = (proc.stdout + proc.stderr).strip()
+    if proc.returncode != 0:
+        status = 'missing' if NOT_FOUND.search(text) else 'error'
+        return dict(res, status=status, detail=text.splitlines()[-1][:200] if text else 'exit {}'.format(proc.returncode))
+    if gone and proc.stdout.strip() in gone:
+        return dict(res, status='missing', detail='state {}'.format(proc.stdout.strip()))
+    if res['type'] == 'vsphere_virtual_machine' and not proc.stdout.strip():
+        return dict(res, status='missing', detail='no VM with this UUID')
+    return dict(res, status='present')
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Check installer Terraform state against the platform')
+    parser.add_argument('install_dir')
+    parser.add_argument('--region', help='AWS region (default: from metadata.json)')
+    parser.add_argument('--parallel', type=int, default=8, help='lookups run at once (default 8)')
+    parser.add_argument('--json', action='store_true')
+    args = parser.parse_args()
+
+    region = args.region
+    metadata_path = os.path.join(args.install_dir, 'metadata.json')
+    if not region and os.path.exists(metadata_path):
+        with open(metadata_path, encoding='utf-8') as f:
+            region = (json.load(f).get('aws') or {}).get('region')
+
+    try:
+        resources = load_states(args.install_dir)
+    except (OSError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    if not resources:
+        print('Error: no Terraform state with managed resources in {}'.format(args.install_dir), file=sys.stderr)
+        return 1
+
+    with concurrent.futures.ThreadPoolExecutor(max_workers=max(1, args.parallel)) as pool:
+        results = list(pool.map(lambda r: check(r, region), resources))
+
+    order = ['missing', 'error', 'unchecked', 'present']
+    results.sort(key=lambda r: (order.index(r['status']), r['address']))
+    counts = {s: sum(1 for r in results if r['status'] == s) for s in order}
+    if args.json:
+        print(json.dumps({'installDir': os.path.abspath(args.install_dir), 'counts': counts,
+                          'resources': results}, indent=2))
+    else:
+        for r in results:
+            if r['status'] == 'present':
+                continue
+            print('{:<9} {:<60} {:<24} {}'.format(r['status'].upper(), r['address'], r['id'][:24], r['detail']))
+        print('\n{} resources: '.format(len(results)) + ', '.join(
+            '{} {}'.format(counts[s], s) for s in reversed(order) if counts[s]))
+    return 2 if counts['missing'] or counts['error'] else 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,335 @@
+#!/usr/bin/env python3
+"""
+prom_dump.py - Export metric series from a Prometheus-compatible API for offline analysis
+
+Usage:
+  prom_dump.py --url URL --start START [--end END] [--step STEP]
+               [--preset NAME[,NAME...]] [--query NAME=EXPR ...]
+               --output DIR [--format blocks|openmetrics]
+               [--ca-file FILE | --insecure] [--progress]
+  prom_dump.py --list-presets
+
+Queries the /api/v1/query_range endpoint (Prometheus or Thanos Querier) and
+writes the results as OpenMetrics text to DIR/metrics.om. With --format blocks
+(the default), it then runs "promtool tsdb create-blocks-from openmetrics" to
+build Prometheus TSDB blocks in DIR/blocks; promtool must be on PATH.
+DIR/manifest.json records the window, step, queries, series counts, and the
+blocks directory (null when the blocks were not built).
+
+The bearer token is read from the PROM_TOKEN environment variable so that it
+does not appear in the process list.
+
+START and END are RFC 3339 timestamps, Unix timestamps, "now", or a duration
+before now such as "6h" or "2d". Long windows are split into chunks so that no
+request exceeds the Prometheus limit of 11,000 points per series.
+
+--progress replaces the per-query summary lines on stderr with one JSON
+object per finished request: {"type": "progress", "phase": "export", "done",
+"total", "percent", "etaSeconds", "item"}, where item is the series name.
+Warnings stay plain text.
+
+Exit codes:
+  0 - All queries exported
+  1 - Invalid arguments, or no query returned data
+  2 - Some queries failed; the others were exported. Or the TSDB blocks
+      could not be built (promtool missing or failed); metrics.om is complete
+
+Requirements: Python 3.7+; promtool for --format blocks
+"""
+
+import argparse
+import json
+import os
+import re
+import shutil
+import ssl
+import subprocess
+import sys
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+from datetime import datetime, timezone
+from typing import Dict, List, Tuple
+
+from ai_helpers_events import progress
+from ai_helpers_units import parse_duration
+
+# Series are aggregated to the labels needed for regression analysis, so that a
+# snapshot of a large cluster stays in the tens of megabytes.
+PRESETS = {
+    'apiserver': [
+        ('apiserver_request_total',
+         'sum by (instance, verb, code, resource) (apiserver_request_total)'),
+        ('apiserver_request_duration_seconds_bucket',
+         'sum by (instance, verb, le) (apiserver_request_duration_seconds_bucket{verb!~"WATCH|CONNECT"})'),
+        ('apiserver_current_inflight_requests', 'apiserver_current_inflight_requests'),
+        ('apiserver_flowcontrol_rejected_requests_total',
+         'sum by (instance, priority_level, reason) (apiserver_flowcontrol_rejected_requests_total)'),
+    ],
+    'etcd': [
+        ('etcd_disk_wal_fsync_duration_seconds_bucket',
+         'sum by (instance, le) (etcd_disk_wal_fsync_duration_seconds_bucket)'),
+        ('etcd_disk_backend_commit_duration_seconds_bucket',
+         'sum by (instance, le) (etcd_disk_backend_commit_duration_seconds_bucket)'),
+        ('etcd_network_peer_round_trip_time_seconds_bucket',
+         'sum by (instance, To, le) (etcd_network_peer_round_trip_time_seconds_bucket)'),
+        ('etcd_server_leader_changes_seen_total', 'etcd_server_leader_changes_seen_total'),
+        ('etcd_server_has_leader', 'etcd_server_has_leader'),
+        ('etcd_mvcc_db_total_size_in_bytes', 'etcd_mvcc_db_total_size_in_bytes'),
+    ],
+    'node': [
+        ('node_cpu_seconds_total', 'sum by (instance, mode) (node_cpu_seconds_total)'),
+        ('node_memory_MemAvailable_bytes', 'node_memory_MemAvailable_bytes'),
+        ('node_memory_MemTotal_bytes', 'node_memory_MemTotal_bytes'),
+        ('node_load1', 'node_load1'),
+        ('node_disk_io_time_seconds_total', 'node_disk_io_time_seconds_total'),
+        ('node_network_receive_bytes_total',
+         'node_network_receive_bytes_total{device!~"veth.*|br-int|ovs-system|genev_sys.*"}'),
+        ('node_network_transmit_bytes_total',
+         'node_network_transmit_bytes_total{device!~"veth.*|br-int|ovs-system|genev_sys.*"}'),
+        ('node_pressure_cpu_waiting_seconds_total', 'node_pressure_cpu_waiting_seconds_total'),
+        ('node_pressure_memory_waiting_seconds_total', 'node_pressure_memory_waiting_seconds_total'),
+        ('node_pressure_io_waiting_seconds_total', 'node_pressure_io_waiting_seconds_total'),
+    ],
+    'kubelet': [
+        ('kubelet_pleg_relist_duration_seconds_bucket',
+         'sum by (node, le) (kubelet_pleg_relist_duration_seconds_bucket)'),
+        ('kubelet_running_pods', 'kubelet_running_pods'),
+        ('container_cpu_usage_seconds_total',
+         'sum by (namespace, pod, node) (container_cpu_usage_seconds_total{container!="",image!=""})'),
+        ('container_memory_working_set_bytes',
+         'sum by (namespace, pod, node) (container_memory_working_set_bytes{container!="",image!=""})'),
+    ],
+    'cluster': [
+        ('up', 'up'),
+        ('ALERTS', 'ALERTS{alertstate="firing"}'),
+        ('cluster_operator_conditions', 'cluster_operator_conditions'),
+        ('kube_pod_status_phase', 'sum by (namespace, phase) (kube_pod_status_phase)'),
+        ('kube_node_status_condition', 'kube_node_status_condition{status="true"}'),
+    ],
+}
+DEFAULT_PRESETS = 'apiserver,etcd,node,cluster'
+MAX_POINTS = 10000  # stay below the 11,000 points-per-series limit
+HTTP_TIMEOUT = 300
+
+def parse_time(value: str, now: float) -> float:
+    """Parse RFC 3339, a Unix timestamp, "now", or a duration before now."""
+    value = value.strip()
+    if value == 'now':
+        return now
+    try:
+        return now - parse_duration(value)
+    except ValueError:
+        pass
+    if re.match(r'^\d+(\.\d+)?$', value):
+        return float(value)
+    try:
+        parsed = datetime.fromisoformat(value.replace('Z', '+00:00'))
+    except ValueError:
+        raise ValueError(f"invalid time: {value!r}")
+    if parsed.tzinfo is None:
+        parsed = parsed.replace(tzinfo=timezone.utc)
+    return parsed.timestamp()
+
+
+def chunks(start: float, end: float, step: int) -> List[Tuple[float, float]]:
+    """Split [start, end] into windows of at most MAX_POINTS steps."""
+    span = step * (MAX_POINTS - 1)
+    windows = []
+    t = start
+    while t <= end:
+        windows.append((t, min(t + span, end)))
+        t += span + step
+    return windows
+
+
+def query_range(url: str, expr: str, start: float, end: float, step: int,
+                token: str, context: ssl.SSLContext) -> List[dict]:
+    """Run one query_range request and return its matrix result."""
+    params = urllib.parse.urlencode({'query': expr, 'start': start, 'end': end, 'step': step})
+    req = urllib.request.Request(f"{url.rstrip('/')}/api/v1/query_range", data=params.encode(),
+                                 headers={'Content-Type': 'application/x-www-form-urlencoded'})
+    if token:
+        req.add_header('Authorization', f'Bearer {token}')
+    try:
+        with urllib.request.urlopen(req, timeout=HTTP_TIMEOUT, context=context) as resp:
+            body = json.loads(resp.read().decode('utf-8'))
+    except urllib.error.HTTPError as e:
+        try:
+            body = json.loads(e.read().decode('utf-8'))
+        except ValueError:
+            raise RuntimeError(f"HTTP {e.code} {e.reason}")
+    if body.get('status') != 'success':
+        raise RuntimeError(body.get('error', 'query failed'))
+    if body['data'].get('resultType') != 'matrix':
+        raise RuntimeError(f"expected a range vector, got {body['data'].get('resultType')}")
+    return body['data']['result']
+
+
+def escape_label(value: str) -> str:
+    return value.replace('\\', '\\\\').replace('"', '\\"').replace('\n', '\\n')
+
+
+def series_key(labels: Dict[str, str]) -> Tuple[Tuple[str, str], ...]:
+    return tuple(sorted(labels.items()))
+
+
+def write_openmetrics(families: Dict[str, Dict[tuple, Dict[float, str]]], path: str) -> None:
+    """Write all series grouped by metric family, as promtool expects."""
+    with open(path, 'w') as f:
+        for name in sorted(families):
+            f.write(f"# TYPE {name} unknown\n")
+            for key in sorted(families[name]):
+                labels = ','.join(f'{k}="{escape_label(v)}"' for k, v in key)
+                selector = f"{name}{{{labels}}}" if labels else name
+                for ts, value in sorted(families[name][key].items()):
+                    stamp = str(int(ts)) if ts == int(ts) else f"{ts:.3f}"
+                    f.write(f"{selector} {value} {stamp}\n")
+        f.write("# EOF\n")
+
+
+def parse_queries(presets: str, queries: List[str]) -> List[Tuple[str, str]]:
+    selected = []
+    for preset in [p.strip() for p in presets.split(',') if p.strip()]:
+        if preset not in PRESETS:
+            raise ValueError(f"unknown preset: {preset} (available: {', '.join(sorted(PRESETS))})")
+        selected.extend(PRESETS[preset])
+    for query in queries:
+        name, sep, expr = query.partition('=')
+        if not sep or not re.match(r'^[a-zA-Z_:][a-zA-Z0-9_:]*$', name.strip()) or not expr.strip():
+            raise ValueError(f"invalid --query {query!r}; expected NAME=EXPR with a valid metric name")
+        selected.append((name.strip(), expr.strip()))
+    return selected
+
+
+def build_blocks(output: str) -> str:
+    """Convert DIR/metrics.om into TSDB blocks in DIR/blocks; returns the blocks directory."""
+    promtool = shutil.which('promtool')
+    if not promtool:
+        raise RuntimeError('promtool not found in PATH')
+    blocks = os.path.join(output, 'blocks')
+    proc = subprocess.run([promtool, 'tsdb', 'create-blocks-from', 'openmetrics',
+                           os.path.join(output, 'metrics.om'), blocks],
+                          stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+    if proc.returncode != 0:
+        raise RuntimeError(f"promtool failed: {(proc.stderr or proc.stdout).strip()}")
+    return blocks
+
+
+def main():
+    parser = argparse.ArgumentParser(description='Export Prometheus series as OpenMetrics for offline analysis')
+    parser.add_argument('--url', help='Prometheus or Thanos Querier base URL')
+    parser.add_argument('--start', help='Window start (RFC 3339, Unix time, or a duration before now, e.g. 6h)')
+    parser.add_argument('--end', default='now', help='Window end (default: now)')
+    parser.add_argument('--step', default='30s', help='Resolution (default: 30s)')
+    parser.add_argument('--preset', default=None,
+                        help=f'Comma-separated metric presets (default: {DEFAULT_PRESETS} when no --query is given)')
+    parser.add_argument('--query', action='append', default=[], help='Extra series as NAME=EXPR (repeatable)')
+    parser.add_argument('--output', help='Output directory')
+    parser.add_argument('--format', choices=['blocks', 'openmetrics'], default='blocks',
+                        help='blocks (default): OpenMetrics plus TSDB blocks built with promtool; '
+                             'openmetrics: the text file only')
+    parser.add_argument('--ca-file', help='CA bundle for the endpoint')
+    parser.add_argument('--insecure', action='store_true', help='Skip TLS verification')
+    parser.add_argument('--list-presets', action='store_true', help='Print the presets and exit')
+    parser.add_argument('--progress', action='store_true', help='Print NDJSON progress events on stderr')
+    args = parser.parse_args()
+
+    if args.list_presets:
+        for name in sorted(PRESETS):
+            print(f"{name}:")
+            for metric, expr in PRESETS[name]:
+                print(f"  {metric} = {expr}")
+        return 0
+
+    if not args.url or not args.start or not args.output:
+        parser.error('--url, --start, and --output are required')
+
+    presets = args.preset if args.preset is not None else ('' if args.query else DEFAULT_PRESETS)
+    try:
+        now = time.time()
+        start = parse_time(args.start, now)
+        end = parse_time(args.end, now)
+        step = parse_duration(args.step)
+        queries = parse_queries(presets, args.query)
+    except ValueError as e:
+        print(f"Error: {e}", file=sys.stderr)
+        return 1
+    if start >= end:
+        print("Error: --start must be before --end", file=sys.stderr)
+        return 1
+    if not queries:
+        print("Error: no queries selected", file=sys.stderr)
+        return 1
+
+    context = ssl.create_default_context(cafile=args.ca_file)
+    if args.insecure:
+        context.check_hostname = False
+        context.verify_mode = ssl.CERT_NONE
+    token = os.environ.get('PROM_TOKEN', '')
+
+    os.makedirs(args.output, exist_ok=True)
+    families = {}
+    manifest = {
+        'url': args.url,
+        'start': datetime.fromtimestamp(start, timezone.utc).isoformat(),
+        'end': datetime.fromtimestamp(end, timezone.utc).isoformat(),
+        'step_seconds': step,
+        'presets': [p for p in presets.split(',') if p],
+        'queries': [],
+    }
+    failed = 0
+    windows = chunks(start, end, step)
+    started, done, total = time.time(), 0, len(queries) * len(windows)
+    for i, (name, expr) in enumerate(queries):
+        entry = {'name': name, 'expr': expr, 'series': 0, 'samples': 0}
+        series = families.setdefault(name, {})
+        try:
+            for chunk_start, chunk_end in windows:
+                for result in query_range(args.url, expr, chunk_start, chunk_end, step, token, context):
+                    labels = {k: v for k, v in result['metric'].items() if k != '__name__'}
+                    samples = series.setdefault(series_key(labels), {})
+                    for ts, value in result.get('values', []):
+                        samples[float(ts)] = value
+                done += 1
+                if args.progress:
+                    progress('export', done, total, started, name)
+        except (RuntimeError, urllib.error.URLError, OSError, ValueError) as e:
+            entry['error'] = str(e)
+            failed += 1
+            print(f"Warning: {name}: {e}", file=sys.stderr)
+            done = (i + 1) * len(windows)
+            if args.progress:
+                progress('export', done, total, started, name)
+        entry['series'] = len(series)
+        entry['samples'] = sum(len(s) for s in series.values())
+        manifest['queries'].append(entry)
+        if not args.progress:
+            print(f"{name}: {entry['series']} series, {entry['samples']} samples", file=sys.stderr)
+
+    families = {name: series for name, series in families.items() if series}
+    write_openmetrics(families, os.path.join(args.output, 'metrics.om'))
+    total = sum(q['samples'] for q in manifest['queries'])
+    print(f"Wrote {total} samples in {sum(len(s) for s in families.values())} series to "
+          f"{os.path.join(args.output, 'metrics.om')}")
+
+    manifest['blocks'] = None
+    if args.format == 'blocks' and families:
+        try:
+            manifest['blocks'] = build_blocks(args.output)
+            print(f"Built TSDB blocks in {manifest['blocks']}")
+        except (RuntimeError, OSError) as e:
+            manifest['blocksError'] = str(e)
+            failed += 1
+            print(f"Warning: TSDB blocks not built: {e}; metrics.om is complete, build them with "
+                  f"'promtool tsdb create-blocks-from openmetrics metrics.om blocks'", file=sys.stderr)
+    with open(os.path.join(args.output, 'manifest.json'), 'w') as f:
+        json.dump(manifest, f, indent=2)
+    if not families:
+        return 1
+    return 2 if failed else 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
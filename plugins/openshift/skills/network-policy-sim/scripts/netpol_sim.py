@@ -0,0 +1,508 @@
+#!/usr/bin/env python3
+"""
+netpol_sim.py - Decide whether traffic between two endpoints is allowed by
+the cluster's network policies, without sending any traffic
+
+Usage:
+  netpol_sim.py DATA_DIR --from SOURCE --to DESTINATION --port PORT
+                [--protocol TCP|UDP|SCTP] [--resolve NAME=IP]... [--json]
+
+SOURCE is NAMESPACE/POD or an IP address outside the cluster.
+DESTINATION is NAMESPACE/POD, svc/NAMESPACE/NAME, an IP address, or a DNS
+name (with --resolve NAME=IP to give its address). For a service, PORT is
+the service port (number or name) and every backend pod is evaluated at
+its target port.
+
+DATA_DIR holds `oc get -o json` output, one file per kind; missing files
+mean no objects of that kind:
+  pods.json namespaces.json services.json nodes.json network.json
+  networkpolicies.json adminnetworkpolicies.json
+  baselineadminnetworkpolicies.json egressfirewalls.json
+
+Each direction is evaluated in the order OVN-Kubernetes applies:
+  1. AdminNetworkPolicies, lowest priority number first; the first rule
+     that matches decides (Allow, Deny) or hands over (Pass)
+  2. NetworkPolicies, if any select the pod for the direction: allowed
+     when any rule of any of them matches, denied otherwise
+  3. The BaselineAdminNetworkPolicy; the first rule that matches decides
+  4. Allowed by default
+Traffic from a pod to an address outside the pod and service networks
+(external hosts and nodes) is also checked against the EgressFirewall of
+the source namespace, first matching rule wins.
+Host-network pods are not subject to any of these.
+
+Exit codes:
+  0 - Allowed (to every backend, for a service)
+  1 - Invalid arguments or data
+  2 - Denied (to at least one backend)
+
+Requirements: Python 3.6+
+"""
+
+import argparse
+import ipaddress
+import json
+import os
+import sys
+from typing import Any, Dict, List, Optional, Tuple
+
+KINDS = ['pods', 'namespaces', 'services', 'nodes', 'network', 'networkpolicies',
+         'adminnetworkpolicies', 'baselineadminnetworkpolicies', 'egressfirewalls']
+
+
+def load(data_dir: str) -> Dict[str, List[Dict[str, Any]]]:
+    data = {}
+    for kind in KINDS:
+        path = os.path.join(data_dir, kind + '.json')
+        if not os.path.exists(path):
+            data[kind] = []
+            continue
+        with open(path, encoding='utf-8') as f:
+            doc = json.load(f)
+        data[kind] = doc.get('items', [doc]) if isinstance(doc, dict) else doc
+    return data
+
+
+def selector_matches(sel: Optional[Dict[str, Any]], labels: Dict[str, str]) -> bool:
+    """Kubernetes label selector semantics; an empty selector matches everything."""
+    if sel is None:
+        return False
+    for k, v in (sel.get('matchLabels') or {}).items():
+        if labels.get(k) != v:
+            return False
+    for expr in sel.get('matchExpressions') or []:
+        key, op, values = expr.get('key'), expr.get('operator'), expr.get('values') or []
+        if op == 'In' and labels.get(key) not in values:
+            return False
+        if op == 'NotIn' and key in labels and labels[key] in values:
+            return False
+        if op == 'Exists' and key not in labels:
+            return False
+        if op == 'DoesNotExist' and key in labels:
+            return False
+    return True
+
+
+def in_cidr(ip: str, cidr: str) -> bool:
+    try:
+        return ipaddress.ip_address(ip) in ipaddress.ip_network(cidr, strict=False)
+    except ValueError:
+        return False
+
+
+class Endpoint:
+    """A pod, or an address outside the pod network (node, external host)."""
+
+    def __init__(self, ip: str, pod: Optional[Dict[str, Any]] = None, ns_labels: Optional[Dict[str, str]] = None,
+                 node: Optional[Dict[str, Any]] = None, dns_name: str = ''):
+        self.ip = ip
+        self.pod = pod
+        self.ns_labels = ns_labels or {}
+        self.node = node
+        self.dns_name = dns_name
+
+    @property
+    def namespace(self) -> str:
+        return self.pod['metadata']['namespace'] if self.pod else ''
+
+    @property
+    def labels(self) -> Dict[str, str]:
+        return (self.pod['metadata'].get('labels') or {}) if self.pod else {}
+
+    @property
+    def host_network(self) -> bool:
+        return bool(self.pod and self.pod['spec'].get('hostNetwork'))
+
+    def policy_pod(self) -> bool:
+        """Whether policies treat this endpoint as a pod (host-network pods are node traffic)."""
+        return self.pod is not None and not self.host_network
+
+    def named_port(self, name: str, protocol: str) -> Optional[int]:
+        for c in (self.pod or {}).get('spec', {}).get('containers', []):
+            for p in c.get('ports') or []:
+                if p.get('name') == name and p.get('protocol', 'TCP') == protocol:
+                    return p.get('containerPort')
+        return None
+
+    def describe(self) -> str:
+        if self.pod:
+            return '{}/{} ({}{})'.format(self.namespace, self.pod['metadata']['name'], self.ip,
+                                         ', host network' if self.host_network else '')
+        if self.node:
+            return 'node {} ({})'.format(self.node['metadata']['name'], self.ip)
+        return '{} ({})'.format(self.dns_name, self.ip) if self.dns_name else self.ip
+
+
+class Cluster:
+    def __init__(self, data: Dict[str, List[Dict[str, Any]]]):
+        self.data = data
+        self.ns_labels = {n['metadata']['name']: n['metadata'].get('labels') or {} for n in data['namespaces']}
+        self.pods = {(p['metadata']['namespace'], p['metadata']['name']): p for p in data['pods']}
+        self.networks = []  # type: List[str]
+        for n in data['network']:
+            status = n.get('status') or n.get('spec') or {}
+            self.networks += [c['cidr'] for c in status.get('clusterNetwork') or []]
+            self.networks += status.get('serviceNetwork') or []
+
+    def pod_endpoint(self, pod: Dict[str, Any]) -> Endpoint:
+        status = pod.get('status') or {}
+        ips = [i['ip'] for i in status.get('podIPs') or []] or [status.get('podIP', '')]
+        return Endpoint(ips[0], pod=pod, ns_labels=self.ns_labels.get(pod['metadata']['namespace'], {}),
+                        node=self.node_by_name(pod['spec'].get('nodeName', '')))
+
+    def node_by_name(self, name: str) -> Optional[Dict[str, Any]]:
+        return next((n for n in self.data['nodes'] if n['metadata']['name'] == name), None)
+
+    def ip_endpoint(self, ip: str, dns_name: str = '') -> Endpoint:
+        for pod in self.data['pods']:
+            if not pod['spec'].get('hostNetwork') and ip in [i['ip'] for i in pod.get('status', {}).get('podIPs') or []]:
+                return self.pod_endpoint(pod)
+        for node in self.data['nodes']:
+            if ip in [a['address'] for a in node.get('status', {}).get('addresses') or []]:
+                return Endpoint(ip, node=node, dns_name=dns_name)
+        return Endpoint(ip, dns_name=dns_name)
+
+    def egress_firewall_applies(self, ep: Endpoint) -> bool:
+        """EgressFirewall covers every destination outside the pod and service networks, nodes included."""
+        return not ep.policy_pod() and not any(in_cidr(ep.ip, c) for c in self.networks)
+
+
+# --- Port matching ---------------------------------------------------------
+
+def np_ports_match(ports: Optional[List[Dict[str, Any]]], port: int, protocol: str, dst: Endpoint) -> bool:
+    if not ports:
+        return True
+    for p in ports:
+        if p.get('protocol', 'TCP') != protocol:
+            continue
+        want = p.get('port')
+        if want is None:
+            return True
+        if isinstance(want, str):
+            want = dst.named_port(want, protocol)
+            if want is None:
+                continue
+        if want == port or (p.get('endPort') and want <= port <= p['endPort']):
+            return True
+    return False
+
+
+def anp_ports_match(ports: Optional[List[Dict[str, Any]]], port: int, protocol: str, dst: Endpoint) -> bool:
+    if not ports:
+        return True
+    for p in ports:
+        if 'portNumber' in p:
+            pn = p['portNumber']
+            if pn.get('protocol', 'TCP') == protocol and pn.get('port') == port:
+                return True
+        elif 'portRange' in p:
+            pr = p['portRange']
+            if pr.get('protocol', 'TCP') == protocol and pr.get('start', 0) <= port <= pr.get('end', 0):
+                return True
+        elif 'namedPort' in p:
+            if dst.named_port(p['namedPort'], protocol) == port:
+                return True
+    return False
+
+
+# --- NetworkPolicy ---------------------------------------------------------
+
+def policy_types(np: Dict[str, Any]) -> List[str]:
+    spec = np.get('spec') or {}
+    if spec.get('policyTypes'):
+        return spec['policyTypes']
+    return ['Ingress'] + (['Egress'] if 'egress' in spec else [])
+
+
+def np_peer_matches(peer: Dict[str, Any], ep: Endpoint, policy_ns: str) -> bool:
+    if 'ipBlock' in peer:
+        block = peer['ipBlock']
+        return in_cidr(ep.ip, block['cidr']) and not any(in_cidr(ep.ip, e) for e in block.get('except') or [])
+    if not ep.policy_pod():
+        return False
+    if 'namespaceSelector' in peer:
+        if not selector_matches(peer['namespaceSelector'], ep.ns_labels):
+            return False
+    elif ep.namespace != policy_ns:
+        return False
+    return 'podSelector' not in peer or selector_matches(peer['podSelector'], ep.labels)
+
+
+def evaluate_np(cluster: Cluster, direction: str, pod: Endpoint, peer: Endpoint, port: int, protocol: str,
+                dst: Endpoint) -> Optional[Dict[str, Any]]:
+    """Return the decision of the NetworkPolicy tier, or None if no policy isolates the pod."""
+    selecting = [np for np in cluster.data['networkpolicies']
+                 if np['metadata']['namespace'] == pod.namespace
+                 and direction in policy_types(np)
+                 and selector_matches(np['spec'].get('podSelector', {}), pod.labels)]
+    if not selecting:
+        return None
+    key, peers_key = ('ingress', 'from') if direction == 'Ingress' else ('egress', 'to')
+    for np in selecting:
+        for i, rule in enumerate(np['spec'].get(key) or []):
+            peers = rule.get(peers_key)
+            if peers and not any(np_peer_matches(p, peer, pod.namespace) for p in peers):
+                continue
+            if np_ports_match(rule.get('ports'), port, protocol, dst):
+                return decision('NetworkPolicy', '{}/{}'.format(pod.namespace, np['metadata']['name']),
+                                '{} rule {}'.format(key, i + 1), 'Allow')
+    names = ', '.join(np['metadata']['name'] for np in selecting)
+    return decision('NetworkPolicy', '{}/{}'.format(pod.namespace, names), 'no rule matches', 'Deny',
+                    'the pod is isolated for {}; no rule allows this peer and port'.format(direction))
+
+
+# --- AdminNetworkPolicy and BaselineAdminNetworkPolicy -----------------------
+
+def subject_matches(subject: Dict[str, Any], pod: Endpoint) -> bool:
+    if 'namespaces' in subject:
+        return selector_matches(subject['namespaces'], pod.ns_labels)
+    if 'pods' in subject:
+        s = subject['pods']
+        return selector_matches(s.get('namespaceSelector', {}), pod.ns_labels) and \
+            selector_matches(s.get('podSelector', {}), pod.labels)
+    return False
+
+
+def anp_peer_matches(peer: Dict[str, Any], ep: Endpoint) -> bool:
+    if 'namespaces' in peer:
+        return ep.policy_pod() and selector_matches(peer['namespaces'], ep.ns_labels)
+    if 'pods' in peer:
+        s = peer['pods']
+        return ep.policy_pod() and selector_matches(s.get('namespaceSelector', {}), ep.ns_labels) and \
+            selector_matches(s.get('podSelector', {}), ep.labels)
+    if 'nodes' in peer:
+        return ep.node is not None and not ep.policy_pod() and \
+            selector_matches(peer['nodes'], ep.node['metadata'].get('labels') or {})
+    if 'networks' in peer:
+        return any(in_cidr(ep.ip, c) for c in peer['networks'])
+    if 'domainNames' in peer:
+        return bool(ep.dns_name) and any(domain_matches(d, ep.dns_name) for d in peer['domainNames'])
+    return False
+
+
+def domain_matches(pattern: str, name: str) -> bool:
+    pattern, name = pattern.rstrip('.').lower(), name.rstrip('.').lower()
+    if pattern.startswith('*.'):
+        return name.endswith(pattern[1:])
+    return pattern == name
+
+
+def first_admin_rule(obj: Dict[str, Any], direction: str, peer: Endpoint, port: int, protocol: str,
+                     dst: Endpoint) -> Optional[Tuple[str, str]]:
+    key, peers_key = ('ingress', 'from') if direction == 'Ingress' else ('egress', 'to')
+    for i, rule in enumerate(obj['spec'].get(key) or []):
+        if not any(anp_peer_matches(p, peer) for p in rule.get(peers_key) or []):
+            continue
+        if anp_ports_match(rule.get('ports'), port, protocol, dst):
+            return rule.get('name') or '{} rule {}'.format(key, i + 1), rule.get('action', '')
+    return None
+
+
+def evaluate_anp(cluster: Cluster, direction: str, pod: Endpoint, peer: Endpoint, port: int, protocol: str,
+                 dst: Endpoint) -> Optional[Dict[str, Any]]:
+    for anp in sorted(cluster.data['adminnetworkpolicies'], key=lambda a: a['spec'].get('priority', 1000)):
+        if not subject_matches(anp['spec'].get('subject') or {}, pod):
+            continue
+        hit = first_admin_rule(anp, direction, peer, port, protocol, dst)
+        if hit:
+            return decision('AdminNetworkPolicy', '{} (priority {})'.format(
+                anp['metadata']['name'], anp['spec'].get('priority')), hit[0], hit[1])
+    return None
+
+
+def evaluate_banp(cluster: Cluster, direction: str, pod: Endpoint, peer: Endpoint, port: int, protocol: str,
+                  dst: Endpoint) -> Optional[Dict[str, Any]]:
+    for banp in cluster.data['baselineadminnetworkpolicies']:
+        if not subject_matches(banp['spec'].get('subject') or {}, pod):
+            continue
+        hit = first_admin_rule(banp, direction, peer, port, protocol, dst)
+        if hit:
+            return decision('BaselineAdminNetworkPolicy', banp['metadata']['name'], hit[0], hit[1])
+    return None
+
+
+# --- EgressFirewall ----------------------------------------------------------
+
+def evaluate_egress_firewall(cluster: Cluster, src: Endpoint, dst: Endpoint, port: int,
+                             protocol: str) -> Optional[Dict[str, Any]]:
+    for ef in cluster.data['egressfirewalls']:
+        if ef['metadata']['namespace'] != src.namespace:
+            continue
+        for i, rule in enumerate(ef['spec'].get('egress') or []):
+            to = rule.get('to') or {}
+            if 'cidrSelector' in to:
+                matched = in_cidr(dst.ip, to['cidrSelector'])
+            elif 'dnsName' in to:
+                matched = bool(dst.dns_name) and domain_matches(to['dnsName'], dst.dns_name)
+            elif 'nodeSelector' in to:
+                matched = dst.node is not None and selector_matches(to['nodeSelector'],
+                                                                    dst.node['metadata'].get('labels') or {})
+            else:
+                matched = False
+            ports = rule.get('ports')
+            if matched and ports:
+                matched = any(p.get('protocol', 'TCP') == protocol and p.get('port') in (None, port) for p in ports)
+            if matched:
+                return decision('EgressFirewall', '{}/{}'.format(src.namespace, ef['metadata']['name']),
+                                'egress rule {}'.format(i + 1), rule.get('type', ''))
+        return decision('EgressFirewall', '{}/{}'.format(src.namespace, ef['metadata']['name']),
+                        'no rule matches', 'Allow', 'no rule matches; allowed by default')
+    return None
+
+
+# --- Evaluation --------------------------------------------------------------
+
+def decision(tier: str, policy: str, rule: str, action: str, detail: str = '') -> Dict[str, Any]:
+    return {'tier': tier, 'policy': policy, 'rule': rule, 'action': action, 'detail': detail}
+
+
+def evaluate_direction(cluster: Cluster, direction: str, pod: Endpoint, peer: Endpoint, port: int,
+                       protocol: str, dst: Endpoint) -> Dict[str, Any]:
+    if not pod.policy_pod():
+        reason = 'host-network pod, not subject to policy' if pod.host_network else 'not a pod'
+        return decision('-', '-', '-', 'Allow', reason)
+    result = evaluate_anp(cluster, direction, pod, peer, port, protocol, dst)
+    passed = result is not None and result['action'] == 'Pass'
+    if result and not passed:
+        return result
+    np_result = evaluate_np(cluster, direction, pod, peer, port, protocol, dst)
+    if np_result:
+        if passed:
+            np_result['detail'] = ('passed by {} {}; '.format(result['policy'], result['rule'])
+                                   + np_result['detail']).rstrip('; ')
+        return np_result
+    banp = evaluate_banp(cluster, direction, pod, peer, port, protocol, dst)
+    if banp:
+        return banp
+    return decision('default', '-', '-', 'Allow', 'no policy selects the pod for {}'.format(direction))
+
+
+def evaluate(cluster: Cluster, src: Endpoint, dst: Endpoint, port: int, protocol: str) -> Dict[str, Any]:
+    checks = {}
+    if src.pod:
+        checks['egress'] = evaluate_direction(cluster, 'Egress', src, dst, port, protocol, dst)
+        if src.policy_pod() and cluster.egress_firewall_applies(dst):
+            ef = evaluate_egress_firewall(cluster, src, dst, port, protocol)
+            if ef:
+                checks['egressFirewall'] = ef
+    if dst.pod:
+        checks['ingress'] = evaluate_direction(cluster, 'Ingress', dst, src, port, protocol, dst)
+    allowed = all(c['action'] == 'Allow' for c in checks.values())
+    return {'destination': dst.describe(), 'port': port, 'protocol': protocol, 'checks': checks, 'allowed': allowed}
+
+
+def resolve_source(cluster: Cluster, arg: str) -> Endpoint:
+    if '/' in arg:
+        ns, name = arg.split('/', 1)
+        if (ns, name) not in cluster.pods:
+            raise ValueError('pod {} not found in pods.json'.format(arg))
+        return cluster.pod_endpoint(cluster.pods[(ns, name)])
+    ipaddress.ip_address(arg)
+    return cluster.ip_endpoint(arg)
+
+
+def resolve_destinations(cluster: Cluster, arg: str, port: str, protocol: str,
+                         resolved: Dict[str, str]) -> List[Tuple[Endpoint, int]]:
+    """Return the destination endpoints with the port each is reached on."""
+    if arg.startswith('svc/'):
+        ns, name = arg[4:].split('/', 1)
+        svc = next((s for s in cluster.data['services']
+                    if s['metadata']['namespace'] == ns and s['metadata']['name'] == name), None)
+        if svc is None:
+            raise ValueError('service {}/{} not found in services.json'.format(ns, name))
+        if not svc['spec'].get('selector'):
+            raise ValueError('service {}/{} has no selector; give a backend pod or IP with --to'.format(ns, name))
+        sp = next((p for p in svc['spec'].get('ports') or []
+                   if (str(p.get('port')) == port or p.get('name') == port)
+                   and p.get('protocol', 'TCP') == protocol), None)
+        if sp is None:
+            raise ValueError('service {}/{} has no {} port {}'.format(ns, name, protocol, port))
+        backends = [p for (pns, _), p in sorted(cluster.pods.items())
+                    if pns == ns and p.get('status', {}).get('phase') == 'Running'
+                    and selector_matches({'matchLabels': svc['spec']['selector']}, p['metadata'].get('labels') or {})]
+        if not backends:
+            raise ValueError('service {}/{} has no running backend pods'.format(ns, name))
+        result = []
+        for pod in backends:
+            ep = cluster.pod_endpoint(pod)
+            target = sp.get('targetPort', sp['port'])
+            if isinstance(target, str) and not target.isdigit():
+                target = ep.named_port(target, protocol)
+                if target is None:
+                    continue
+            result.append((ep, int(target)))
+        return result
+    if '/' in arg:
+        ns, name = arg.split('/', 1)
+        if (ns, name) not in cluster.pods:
+            raise ValueError('pod {} not found in pods.json'.format(arg))
+        ep = cluster.pod_endpoint(cluster.pods[(ns, name)])
+        number = int(port) if port.isdigit() else ep.named_port(port, protocol)
+        if number is None:
+            raise ValueError('pod {} has no {} port named {}'.format(arg, protocol, port))
+        return [(ep, number)]
+    if not port.isdigit():
+        raise ValueError('a named port needs a pod or service destination')
+    try:
+        ipaddress.ip_address(arg)
+        return [(cluster.ip_endpoint(arg), int(port))]
+    except ValueError:
+        pass
+    if arg not in resolved:
+        raise ValueError('{} is not an IP address; give its address with --resolve {}=IP'.format(arg, arg))
+    return [(cluster.ip_endpoint(resolved[arg], dns_name=arg), int(port))]
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Decide whether network policies allow traffic between two endpoints')
+    parser.add_argument('data_dir')
+    parser.add_argument('--from', dest='source', required=True, help='NAMESPACE/POD or external IP')
+    parser.add_argument('--to', dest='destination', required=True,
+                        help='NAMESPACE/POD, svc/NAMESPACE/NAME, IP address, or DNS name')
+    parser.add_argument('--port', required=True, help='destination port number or name')
+    parser.add_argument('--protocol', default='TCP', choices=['TCP', 'UDP', 'SCTP'])
+    parser.add_argument('--resolve', action='append', default=[], metavar='NAME=IP',
+                        help='address of a DNS name destination')
+    parser.add_argument('--json', action='store_true')
+    args = parser.parse_args()
+
+    try:
+        resolved = dict(r.split('=', 1) for r in args.resolve)
+        cluster = Cluster(load(args.data_dir))
+        if not cluster.data['pods']:
+            raise ValueError('no pods in {}'.format(os.path.join(args.data_dir, 'pods.json')))
+        src = resolve_source(cluster, args.source)
+        destinations = resolve_destinations(cluster, args.destination, args.port, args.protocol, resolved)
+    except (OSError, ValueError, KeyError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    if not destinations:
+        print('Error: no backend of {} has a port named by the service target port'.format(args.destination),
+              file=sys.stderr)
+        return 1
+
+    results = [evaluate(cluster, src, dst, port, args.protocol) for dst, port in destinations]
+    allowed = all(r['allowed'] for r in results)
+    if args.json:
+        print(json.dumps({'source': src.describe(), 'target': args.destination, 'allowed': allowed,
+                          'results': results}, indent=2))
+    else:
+        print('From: {}'.format(src.describe()))
+        for r in results:
+            print('\nTo:   {} port {}/{}'.format(r['destination'], r['port'], r['protocol']))
+            for name, c in r['checks'].items():
+                where = c['tier'] if c['policy'] == '-' else '{} {}'.format(c['tier'], c['policy'])
+                if c['rule'] not in ('-', 'no rule matches'):
+                    where += ', ' + c['rule']
+                print('  {:<15} {:<6} {}{}'.format(name, c['action'].upper(), where,
+                                                   ' - ' + c['detail'] if c['detail'] else ''))
+            print('  Result: {}'.format('ALLOW' if r['allowed'] else 'DENY'))
+        if len(results) > 1:
+            denied = sum(1 for r in results if not r['allowed'])
+            print('\n{} of {} backends denied'.format(denied, len(results)) if denied
+                  else '\nAllowed to all {} backends'.format(len(results)))
+    return 0 if allowed else 2
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,143 @@
+#!/usr/bin/env python3
+"""Tests for the network policy simulator."""
+
+import os
+import sys
+
+sys.path.insert(0, os.path.dirname(__file__))
+from netpol_sim import KINDS, Cluster, evaluate, resolve_destinations, resolve_source
+
+
+def pod(ns, name, ip, labels=None, ports=None, node="worker-0", host_network=False):
+    return {"metadata": {"namespace": ns, "name": name, "labels": labels or {}},
+            "spec": {"nodeName": node, "hostNetwork": host_network, "containers": [{"ports": ports or []}]},
+            "status": {"phase": "Running", "podIP": ip, "podIPs": [{"ip": ip}]}}
+
+
+def cluster(**objects):
+    data = {kind: [] for kind in KINDS}
+    data["namespaces"] = [{"metadata": {"name": n, "labels": {"kubernetes.io/metadata.name": n}}}
+                          for n in ("app", "db", "monitoring", "openshift-dns")]
+    data["network"] = [{"status": {"clusterNetwork": [{"cidr": "10.128.0.0/14"}],
+                                   "serviceNetwork": ["172.30.0.0/16"]}}]
+    data["nodes"] = [{"metadata": {"name": "worker-0", "labels": {"node-role.kubernetes.io/worker": ""}},
+                      "status": {"addresses": [{"type": "InternalIP", "address": "192.168.10.20"}]}}]
+    data["pods"] = [
+        pod("app", "web", "10.128.2.10", {"app": "web"}),
+        pod("db", "postgres", "10.129.0.5", {"app": "postgres"}, [{"name": "pg", "containerPort": 5432}]),
+        pod("monitoring", "node-exporter", "192.168.10.20", {"app": "node-exporter"}, host_network=True),
+        pod("openshift-dns", "dns-default-abcde", "10.130.0.7", {"dns.operator.openshift.io/daemonset-dns": "default"},
+            [{"name": "dns", "containerPort": 5353, "protocol": "UDP"},
+             {"name": "dns-tcp", "containerPort": 5353, "protocol": "TCP"}]),
+    ]
+    data["services"] = [{"metadata": {"namespace": "openshift-dns", "name": "dns-default"},
+                         "spec": {"selector": {"dns.operator.openshift.io/daemonset-dns": "default"},
+                                  "ports": [{"name": "dns", "port": 53, "protocol": "UDP", "targetPort": "dns"},
+                                            {"name": "dns-tcp", "port": 53, "protocol": "TCP",
+                                             "targetPort": "dns-tcp"}]}}]
+    data.update(objects)
+    return Cluster(data)
+
+
+def check(c, source, destination, port, protocol="TCP"):
+    src = resolve_source(c, source)
+    dst, number = resolve_destinations(c, destination, str(port), protocol, {})[0]
+    return evaluate(c, src, dst, number, protocol)
+
+
+def anp(name, priority, action, namespace="db", ports=None):
+    rule = {"name": name + "-rule", "action": action, "from": [{"namespaces": {"matchLabels": {
+        "kubernetes.io/metadata.name": "app"}}}]}
+    if ports:
+        rule["ports"] = ports
+    return {"metadata": {"name": name}, "spec": {"priority": priority, "subject": {"namespaces": {
+        "matchLabels": {"kubernetes.io/metadata.name": namespace}}}, "ingress": [rule]}}
+
+
+ALLOW_WEB = {"metadata": {"namespace": "db", "name": "allow-web"},
+             "spec": {"podSelector": {"matchLabels": {"app": "postgres"}}, "policyTypes": ["Ingress"],
+                      "ingress": [{"from": [{"namespaceSelector": {"matchLabels": {
+                          "kubernetes.io/metadata.name": "app"}}}], "ports": [{"port": "pg"}]}]}}
+DENY_ALL = {"metadata": {"namespace": "db", "name": "deny-all"},
+            "spec": {"podSelector": {}, "policyTypes": ["Ingress"]}}
+BANP_DENY = {"metadata": {"name": "default"}, "spec": {"subject": {"namespaces": {}}, "ingress": [
+    {"name": "deny-all", "action": "Deny", "from": [{"namespaces": {}}]}]}}
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+def egress_firewall(*rules):
+    return [{"metadata": {"namespace": "app", "name": "default"}, "spec": {"egress": list(rules)}}]
+
+
+if __name__ == "__main__":
+    results = []
+
+    r = check(cluster(), "app/web", "db/postgres", 5432)
+    results.append(test("no policy allows by default", r["allowed"] and r["checks"]["ingress"]["tier"] == "default"))
+
+    r = check(cluster(networkpolicies=[DENY_ALL]), "app/web", "db/postgres", 5432)
+    results.append(test("isolated pod without matching rule is denied",
+                        not r["allowed"] and r["checks"]["ingress"]["tier"] == "NetworkPolicy"))
+    r = check(cluster(networkpolicies=[DENY_ALL, ALLOW_WEB]), "app/web", "db/postgres", "pg")
+    results.append(test("named port resolves to the container port", r["port"] == 5432))
+    results.append(test("any policy allowing the peer allows",
+                        r["allowed"] and r["checks"]["ingress"]["policy"] == "db/allow-web"))
+    r = check(cluster(networkpolicies=[ALLOW_WEB]), "app/web", "db/postgres", 5433)
+    results.append(test("named port does not match another port", not r["allowed"]))
+
+    r = check(cluster(networkpolicies=[ALLOW_WEB], adminnetworkpolicies=[anp("deny-app", 10, "Deny")]),
+              "app/web", "db/postgres", 5432)
+    results.append(test("ANP Deny overrides NetworkPolicy allow",
+                        not r["allowed"] and r["checks"]["ingress"]["tier"] == "AdminNetworkPolicy"))
+    r = check(cluster(adminnetworkpolicies=[anp("deny-app", 20, "Deny"), anp("allow-app", 5, "Allow")]),
+              "app/web", "db/postgres", 5432)
+    results.append(test("lowest ANP priority number wins", r["allowed"]
+                        and r["checks"]["ingress"]["policy"] == "allow-app (priority 5)"))
+    r = check(cluster(adminnetworkpolicies=[anp("pg-only", 5, "Allow", ports=[{"namedPort": "pg"}])]),
+              "app/web", "db/postgres", 5432)
+    results.append(test("ANP named port matches", r["checks"]["ingress"]["tier"] == "AdminNetworkPolicy"))
+
+    r = check(cluster(adminnetworkpolicies=[anp("pass-app", 5, "Pass")], baselineadminnetworkpolicies=[BANP_DENY]),
+              "app/web", "db/postgres", 5432)
+    results.append(test("ANP Pass without NetworkPolicy falls to BANP",
+                        not r["allowed"] and r["checks"]["ingress"]["tier"] == "BaselineAdminNetworkPolicy"))
+    r = check(cluster(adminnetworkpolicies=[anp("pass-app", 5, "Pass")], networkpolicies=[ALLOW_WEB],
+                      baselineadminnetworkpolicies=[BANP_DENY]), "app/web", "db/postgres", 5432)
+    results.append(test("ANP Pass hands over to NetworkPolicy before BANP",
+                        r["allowed"] and r["checks"]["ingress"]["tier"] == "NetworkPolicy"
+                        and "passed by pass-app" in r["checks"]["ingress"]["detail"]))
+
+    dns = resolve_destinations(cluster(), "svc/openshift-dns/dns-default", "53", "TCP", {})
+    results.append(test("service port is matched with its protocol", [p for _, p in dns] == [5353]))
+    r = check(cluster(), "app/web", "svc/openshift-dns/dns-default", "dns", "UDP")
+    results.append(test("named service port resolves for UDP", r["port"] == 5353 and r["allowed"]))
+
+    ef = egress_firewall({"type": "Allow", "to": {"cidrSelector": "203.0.113.0/24"}},
+                         {"type": "Deny", "to": {"cidrSelector": "0.0.0.0/0"}})
+    r = check(cluster(egressfirewalls=ef), "app/web", "203.0.113.8", 443)
+    results.append(test("first matching EgressFirewall rule wins", r["allowed"]
+                        and r["checks"]["egressFirewall"]["rule"] == "egress rule 1"))
+    r = check(cluster(egressfirewalls=ef), "app/web", "198.51.100.1", 443)
+    results.append(test("later EgressFirewall rule denies", not r["allowed"]))
+    r = check(cluster(egressfirewalls=ef), "app/web", "db/postgres", 5432)
+    results.append(test("EgressFirewall ignores pod destinations", "egressFirewall" not in r["checks"]))
+    r = check(cluster(egressfirewalls=ef), "app/web", "192.168.10.20", 10250)
+    results.append(test("EgressFirewall applies to node addresses", not r["allowed"]
+                        and r["checks"]["egressFirewall"]["rule"] == "egress rule 2"))
+    r = check(cluster(egressfirewalls=ef), "app/web", "monitoring/node-exporter", 9100)
+    results.append(test("EgressFirewall applies to host-network pods", not r["allowed"]
+                        and "egressFirewall" in r["checks"]))
+    nodes = egress_firewall({"type": "Allow", "to": {"nodeSelector": {"matchLabels": {
+        "node-role.kubernetes.io/worker": ""}}}}, {"type": "Deny", "to": {"cidrSelector": "0.0.0.0/0"}})
+    r = check(cluster(egressfirewalls=nodes), "app/web", "192.168.10.20", 10250)
+    results.append(test("EgressFirewall nodeSelector matches the node", r["allowed"]
+                        and r["checks"]["egressFirewall"]["rule"] == "egress rule 1"))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
@@ -0,0 +1,151 @@
+#!/bin/bash
+
+# ocm-cluster-info.sh
+# Collects a managed (ROSA, OSD) or registered cluster's record from the
+# OpenShift Cluster Manager API and prints it as one JSON document.
+#
+# Usage:
+#   ocm-cluster-info.sh <cluster-name|cluster-id|external-id>
+#   ocm-cluster-info.sh --current          # cluster of the current oc context
+#
+# Environment:
+#   OCM_URL               API URL (default: https://api.openshift.com)
+#   RH_API_OFFLINE_TOKEN  Offline token, when the ocm CLI is not logged in
+#                         (default: read from macOS Keychain or secret-tool)
+#
+# Exit codes:
+#   0 - Success
+#   1 - Invalid arguments, authentication or API error
+#   2 - Cluster not found
+
+set -euo pipefail
+
+OCM_URL="${OCM_URL:-https://api.openshift.com}"
+SSO_URL="https://sso.redhat.com/auth/realms/redhat-external/protocol/openid-connect/token"
+
+usage() {
+  sed -n '7,9p' "$0" | sed 's/^# \{0,1\}//' >&2
+  exit 1
+}
+
+# Quote a value for curl config files
+# Args:
+#   $1: value
+quote() {
+  local value="${1//\\/\\\\}"
+  printf '"%s"' "${value//\"/\\\"}"
+}
+
+# Print an access token, from the ocm CLI or by exchanging the offline token
+access_token() {
+  if command -v ocm >/dev/null 2>&1 && ocm token 2>/dev/null; then
+    return 0
+  fi
+  local offline="${RH_API_OFFLINE_TOKEN:-}"
+  if [ -z "${offline}" ]; then
+    offline=$(security find-generic-password -a "$USER" -s "RH_API_OFFLINE_TOKEN" -w 2>/dev/null ||
+      secret-tool lookup service redhat key RH_API_OFFLINE_TOKEN 2>/dev/null || true)
+  fi
+  if [ -z "${offline}" ]; then
+    echo "Error: Not logged in. Run 'ocm login --use-auth-code', or store an offline token from" >&2
+    echo "       https://console.redhat.com/openshift/token as RH_API_OFFLINE_TOKEN" >&2
+    return 1
+  fi
+  # The token goes to curl as a config file on stdin, not on its command line
+  printf 'data-urlencode = %s\n' "$(quote "refresh_token=${offline}")" |
+    curl -sSf -K - "${SSO_URL}" -d grant_type=refresh_token -d client_id=cloud-services | jq -r '.access_token'
+}
+
+# URL-encode a string
+# Args:
+#   $1: string
+uri() {
+  jq -rn --arg s "$1" '$s | @uri'
+}
+
+# GET an API path and print the JSON body, or "null" on 404
+# Args:
+#   $1: path, starting with /api/
+api_get() {
+  local body code
+  body=$(printf 'header = %s\n' "$(quote "Authorization: Bearer ${TOKEN}")" |
+    curl -sS -K - -w '\n%{http_code}' "${OCM_URL}$1")
+  code=${body##*$'\n'}
+  body=${body%$'\n'*}
+  case "${code}" in
+    200) printf '%s\n' "${body}" ;;
+    404) echo "null" ;;
+    *)
+      echo "Error: GET $1 returned HTTP ${code}: $(jq -r '.reason // .' <<<"${body}" 2>/dev/null)" >&2
+      return 1
+      ;;
+  esac
+}
+
+[ $# -eq 1 ] || usage
+
+if [ "$1" = "--current" ]; then
+  ID=$(oc get clusterversion version -o jsonpath='{.spec.clusterID}')
+else
+  ID="$1"
+fi
+[[ "${ID}" =~ ^[A-Za-z0-9._-]+$ ]] || { echo "Error: Invalid cluster identifier: ${ID}" >&2; exit 1; }
+
+TOKEN=$(access_token)
+[ -n "${TOKEN}" ] && [ "${TOKEN}" != "null" ] || { echo "Error: Could not get an access token" >&2; exit 1; }
+
+CLUSTERS=$(api_get "/api/clusters_mgmt/v1/clusters?search=$(uri "id = '${ID}' or external_id = '${ID}' or name = '${ID}'")&size=10")
+
+case "$(jq '.items | length' <<<"${CLUSTERS}")" in
+  0)
+    # Self-managed clusters that only report telemetry have a subscription but
+    # no clusters_mgmt record
+    SUBS=$(api_get "/api/accounts_mgmt/v1/subscriptions?search=$(uri "external_cluster_id = '${ID}' or display_name = '${ID}'")")
+    if [ "$(jq '.items | length' <<<"${SUBS}")" -eq 0 ]; then
+      echo "Error: No cluster or subscription matches ${ID}" >&2
+      exit 2
+    fi
+    jq '{cluster: null, subscription: .items[0]}' <<<"${SUBS}"
+    exit 0
+    ;;
+  1) ;;
+  *)
+    echo "Error: ${ID} matches several clusters; use the cluster ID:" >&2
+    jq -r '.items[] | "  \(.id)  \(.name)  \(.external_id // "-")"' <<<"${CLUSTERS}" >&2
+    exit 1
+    ;;
+esac
+
+CLUSTER=$(jq '.items[0]' <<<"${CLUSTERS}")
+CID=$(jq -r '.id' <<<"${CLUSTER}")
+HCP=$(jq -r '.hypershift.enabled // false' <<<"${CLUSTER}")
+SUB_ID=$(jq -r '.subscription.id // empty' <<<"${CLUSTER}")
+BASE="/api/clusters_mgmt/v1/clusters/${CID}"
+
+if [ "${HCP}" = "true" ]; then
+  POOLS=$(api_get "${BASE}/node_pools")
+  UPGRADES=$(api_get "${BASE}/control_plane/upgrade_policies")
+else
+  POOLS=$(api_get "${BASE}/machine_pools")
+  UPGRADES=$(api_get "${BASE}/upgrade_policies")
+fi
+LIMITED=$(api_get "${BASE}/limited_support_reasons")
+SUB="null"
+[ -n "${SUB_ID}" ] && SUB=$(api_get "/api/accounts_mgmt/v1/subscriptions/${SUB_ID}")
+EXTERNAL_ID=$(jq -r '.external_id // empty' <<<"${CLUSTER}")
+LOGS="null"
+[ -n "${EXTERNAL_ID}" ] && LOGS=$(api_get "/api/service_logs/v1/cluster_logs?search=$(uri "cluster_uuid = '${EXTERNAL_ID}'")&orderBy=$(uri "timestamp desc")&size=20")
+
+jq -n \
+  --argjson cluster "${CLUSTER}" \
+  --argjson pools "${POOLS}" \
+  --argjson upgrades "${UPGRADES}" \
+  --argjson limited "${LIMITED}" \
+  --argjson subscription "${SUB}" \
+  --argjson logs "${LOGS}" \
+  '{cluster: $cluster,
+    subscription: $subscription,
+    pools: ($pools.items // []),
+    upgradePolicies: ($upgrades.items // []),
+    limitedSupportReasons: ($limited.items // []),
+    serviceLogs: ($logs.items // [])}'
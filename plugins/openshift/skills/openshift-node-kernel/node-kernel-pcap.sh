@@ -0,0 +1,135 @@
+#!/bin/bash
+
+set -euo pipefail
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+source "${SCRIPT_DIR}/kernel-helper.sh"
+
+# Captures are bounded: tcpdump stops at the duration or the packet count,
+# whichever comes first
+MAX_DURATION=300
+MAX_COUNT=1000000
+
+# Parse arguments
+NODES=""
+IMAGE=""
+INTERFACE="any"
+FILTER=""
+DURATION=30
+COUNT=100000
+SNAPLEN=256
+OUTPUT_DIR=""
+
+while [[ $# -gt 0 ]]; do
+  case $1 in
+    --interface)
+      INTERFACE="$2"
+      shift 2
+      ;;
+    --filter)
+      FILTER="$2"
+      shift 2
+      ;;
+    --duration)
+      DURATION="$2"
+      shift 2
+      ;;
+    --count)
+      COUNT="$2"
+      shift 2
+      ;;
+    --snaplen)
+      SNAPLEN="$2"
+      shift 2
+      ;;
+    --output-dir)
+      OUTPUT_DIR="$2"
+      shift 2
+      ;;
+    *)
+      if [ -z "$NODES" ]; then
+        NODES="$1"
+      elif [ -z "$IMAGE" ]; then
+        IMAGE="$1"
+      else
+        echo "Error: Unexpected argument: $1" >&2
+        exit 1
+      fi
+      shift
+      ;;
+  esac
+done
+
+# Validate required parameters
+if [ -z "$NODES" ] || [ -z "$IMAGE" ]; then
+  echo "Error: node and image are required" >&2
+  echo "Usage: node-kernel-pcap.sh <node>[,<node>...] <image> [--interface <if>] [--filter <bpf>] [--duration <s>] [--count <n>] [--snaplen <bytes>] [--output-dir <dir>]" >&2
+  exit 1
+fi
+
+for value in "$DURATION" "$COUNT" "$SNAPLEN"; do
+  if ! [[ "$value" =~ ^[0-9]+$ ]] || [ "$value" -eq 0 ]; then
+    echo "Error: --duration, --count, and --snaplen must be positive integers" >&2
+    exit 1
+  fi
+done
+if [ "$DURATION" -gt "$MAX_DURATION" ] || [ "$COUNT" -gt "$MAX_COUNT" ]; then
+  echo "Error: captures are limited to ${MAX_DURATION}s and ${MAX_COUNT} packets" >&2
+  exit 1
+fi
+
+check_oc_available
+
+IFS=',' read -ra NODE_LIST <<< "$NODES"
+for node in "${NODE_LIST[@]}"; do
+  validate_node_exists "$node"
+done
+
+OUTPUT_DIR="${OUTPUT_DIR:-.work/node-kernel-pcap/$(date +%Y%m%d-%H%M%S)}"
+mkdir -p "$OUTPUT_DIR"
+
+# tcpdump runs from the host (RHCOS ships it) in the host network namespace.
+# The capture is streamed to stdout, so nothing is left on the node.
+capture() {
+  local node="$1"
+  local file="${OUTPUT_DIR}/${node}.pcap"
+  local cmd=(chroot /host timeout "${DURATION}" tcpdump -i "${INTERFACE}" -s "${SNAPLEN}" -c "${COUNT}" -U -w -)
+  if [ -n "$FILTER" ]; then
+    cmd+=("$FILTER")
+  fi
+  oc debug node/"${node}" --image="${IMAGE}" -- "${cmd[@]}" > "$file" 2> "${OUTPUT_DIR}/${node}.log" || true
+}
+
+echo "Capturing on ${#NODE_LIST[@]} node(s), interface ${INTERFACE}, up to ${DURATION}s or ${COUNT} packets${FILTER:+, filter: ${FILTER}}" >&2
+pids=()
+for node in "${NODE_LIST[@]}"; do
+  capture "$node" &
+  pids+=($!)
+done
+for pid in "${pids[@]}"; do
+  wait "$pid" || true
+done
+
+files=()
+for node in "${NODE_LIST[@]}"; do
+  file="${OUTPUT_DIR}/${node}.pcap"
+  # A pcap file starts with a 24-byte header; anything else is an error message
+  if [ "$(head -c 4 "$file" | od -An -tx1 | tr -d ' \n')" = "d4c3b2a1" ] || \
+     [ "$(head -c 4 "$file" | od -An -tx1 | tr -d ' \n')" = "a1b2c3d4" ]; then
+    files+=("$file")
+    echo "${node}: $(grep -E 'packets (captured|received by filter|dropped by kernel)' "${OUTPUT_DIR}/${node}.log" | tr '\n' ' ')" >&2
+  else
+    echo "Error: capture on ${node} failed, see ${OUTPUT_DIR}/${node}.log" >&2
+    cat "$file" >> "${OUTPUT_DIR}/${node}.log"
+    rm -f "$file"
+  fi
+done
+
+if [ ${#files[@]} -eq 0 ]; then
+  exit 1
+fi
+
+echo "" >&2
+echo "Captures saved to ${OUTPUT_DIR}" >&2
+echo "" >&2
+python3 "${SCRIPT_DIR}/pcap_summary.py" "${files[@]}"
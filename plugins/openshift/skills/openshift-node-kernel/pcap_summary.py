@@ -0,0 +1,296 @@
+#!/usr/bin/env python3
+"""
+pcap_summary.py - Quick protocol and error summary of packet captures
+
+Usage:
+  pcap_summary.py FILE [FILE...] [--json] [--top N]
+
+Reads classic pcap files (as written by tcpdump -w) with Ethernet, Linux
+cooked (SLL, SLL2, from -i any), or raw IP link types, and decapsulates
+Geneve (OVN-Kubernetes) and VXLAN (OpenShift SDN) so pod traffic is
+counted by its inner headers. Reports:
+  - packets and bytes per protocol
+  - TCP retransmissions (a data segment seen again on the same flow, interface and
+    encapsulation), resets, zero windows
+  - ICMP unreachable by type and code, and ICMP fragmentation needed / ICMPv6
+    packet too big with the reported MTU
+  - IPv4 fragments and packets larger than the smallest reported MTU
+  - the flows with the most retransmissions
+
+Exit codes:
+  0 - Summary printed
+  1 - A file could not be read or is not a pcap file
+"""
+
+import argparse
+import json
+import struct
+import sys
+from collections import Counter
+from typing import Any, Dict, Optional, Tuple
+
+GENEVE_PORT = 6081
+VXLAN_PORT = 4789
+
+ICMP_UNREACH = {
+    0: 'net unreachable', 1: 'host unreachable', 2: 'protocol unreachable', 3: 'port unreachable',
+    4: 'fragmentation needed', 9: 'net prohibited', 10: 'host prohibited', 13: 'administratively prohibited',
+}
+ICMP6_UNREACH = {0: 'no route', 1: 'administratively prohibited', 3: 'address unreachable', 4: 'port unreachable'}
+
+
+def read_pcap(path: str):
+    """Yield (linktype, packet bytes, original length) for each record of a classic pcap file."""
+    with open(path, 'rb') as f:
+        header = f.read(24)
+        if len(header) < 24:
+            raise ValueError('{}: not a pcap file'.format(path))
+        magic = header[:4]
+        if magic in (b'\xd4\xc3\xb2\xa1', b'\x4d\x3c\xb2\xa1'):
+            endian = '<'
+        elif magic in (b'\xa1\xb2\xc3\xd4', b'\xa1\xb2\x3c\x4d'):
+            endian = '>'
+        elif magic == b'\x0a\x0d\x0d\x0a':
+            raise ValueError('{}: pcapng is not supported, convert with: editcap -F pcap IN OUT'.format(path))
+        else:
+            raise ValueError('{}: not a pcap file'.format(path))
+        linktype = struct.unpack(endian + 'I', header[20:24])[0] & 0x0fffffff
+        while True:
+            rec = f.read(16)
+            if len(rec) < 16:
+                return
+            _, _, incl, orig = struct.unpack(endian + 'IIII', rec)
+            data = f.read(incl)
+            if len(data) < incl:
+                return
+            yield linktype, data, orig
+
+
+def l3_offset(linktype: int, data: bytes) -> Optional[Tuple[int, int]]:
+    """Return (ethertype, offset of the network header) for a frame."""
+    if linktype == 1:  # Ethernet
+        off, etype = 14, struct.unpack('!H', data[12:14])[0] if len(data) >= 14 else 0
+    elif linktype == 113:  # Linux cooked v1
+        off, etype = 16, struct.unpack('!H', data[14:16])[0] if len(data) >= 16 else 0
+    elif linktype == 276:  # Linux cooked v2
+        off, etype = 20, struct.unpack('!H', data[0:2])[0] if len(data) >= 20 else 0
+    elif linktype in (101, 12, 228, 229):  # raw IP
+        if not data:
+            return None
+        return (0x0800 if data[0] >> 4 == 4 else 0x86dd), 0
+    else:
+        return None
+    while etype in (0x8100, 0x88a8) and len(data) >= off + 4:  # VLAN tags
+        etype = struct.unpack('!H', data[off + 2:off + 4])[0]
+        off += 4
+    return etype, off
+
+
+class Summary:
+    def __init__(self):
+        self.packets = 0
+        self.bytes = 0
+        self.protocols = Counter()
+        self.tunnels = Counter()
+        self.seen_segments = set()
+        self.retransmits = Counter()
+        self.resets = 0
+        self.zero_windows = 0
+        self.unreachable = Counter()
+        self.mtus = Counter()
+        self.fragments = 0
+        self.sizes = Counter()
+        self.unparsed = 0
+
+    def packet(self, linktype: int, data: bytes, length: int):
+        self.packets += 1
+        self.bytes += length
+        parsed = l3_offset(linktype, data)
+        if not parsed:
+            self.unparsed += 1
+            return
+        # With -i any the same segment is captured on the pod veth and again,
+        # encapsulated, on the node NIC; only a repeat on one interface is a retransmit
+        interface = struct.unpack('!i', data[4:8])[0] if linktype == 276 else 0
+        self.network(parsed[0], data, parsed[1], length, depth=0, interface=interface)
+
+    def network(self, etype: int, data: bytes, off: int, length: int, depth: int, interface: int):
+        if etype == 0x0806:
+            self.protocols['arp'] += 1
+            return
+        if etype == 0x0800 and len(data) >= off + 20:
+            ihl = (data[off] & 0x0f) * 4
+            total = struct.unpack('!H', data[off + 2:off + 4])[0]
+            flags_frag = struct.unpack('!H', data[off + 6:off + 8])[0]
+            proto = data[off + 9]
+            src, dst = data[off + 12:off + 16], data[off + 16:off + 20]
+            self.sizes[total] += 1
+            if flags_frag & 0x2000 or flags_frag & 0x1fff:
+                self.fragments += 1
+                if flags_frag & 0x1fff:
+                    self.protocols['ipv4-fragment'] += 1
+                    return
+            self.transport(4, proto, src, dst, data, off + ihl, off + total, depth, interface)
+        elif etype == 0x86dd and len(data) >= off + 40:
+            proto = data[off + 6]
+            payload = struct.unpack('!H', data[off + 4:off + 6])[0]
+            src, dst = data[off + 8:off + 24], data[off + 24:off + 40]
+            self.sizes[payload + 40] += 1
+            end = off + 40 + payload
+            off += 40
+            while proto in (0, 43, 60) and len(data) >= off + 8:  # hop-by-hop, routing, destination options
+                proto, off = data[off], off + (data[off + 1] + 1) * 8
+            if proto == 44:
+                self.fragments += 1
+                self.protocols['ipv6-fragment'] += 1
+                return
+            self.transport(6, proto, src, dst, data, off, end, depth, interface)
+        else:
+            self.protocols['other-l2'] += 1
+
+    def transport(self, version: int, proto: int, src: bytes, dst: bytes, data: bytes, off: int, end: int,
+                  depth: int, interface: int):
+        if proto == 6 and len(data) >= off + 20:
+            self.protocols['tcp'] += 1
+            sport, dport, seq = struct.unpack('!HHI', data[off:off + 8])
+            doff = (data[off + 12] >> 4) * 4
+            flags = data[off + 13]
+            window = struct.unpack('!H', data[off + 14:off + 16])[0]
+            # From the IP length: frames may be padded or cut at the capture's snaplen
+            payload = end - off - doff
+            if flags & 0x04:
+                self.resets += 1
+            if window == 0 and not flags & 0x04 and not flags & 0x02:
+                self.zero_windows += 1
+            if payload > 0:
+                key = (interface, depth, src, sport, dst, dport, seq, payload)
+                if key in self.seen_segments:
+                    self.retransmits[(version, src, sport, dst, dport)] += 1
+                else:
+                    self.seen_segments.add(key)
+        elif proto == 17 and len(data) >= off + 8:
+            sport, dport = struct.unpack('!HH', data[off:off + 4])
+            if depth == 0 and dport == GENEVE_PORT and len(data) >= off + 16:
+                self.protocols['geneve'] += 1
+                self.tunnels['geneve'] += 1
+                opt_len = (data[off + 8] & 0x3f) * 4
+                inner = off + 16 + opt_len
+                if len(data) >= inner + 14:
+                    self.network(struct.unpack('!H', data[inner + 12:inner + 14])[0], data, inner + 14, 0, 1,
+                                     interface)
+                return
+            if depth == 0 and dport == VXLAN_PORT and len(data) >= off + 30:
+                self.protocols['vxlan'] += 1
+                self.tunnels['vxlan'] += 1
+                inner = off + 16
+                self.network(struct.unpack('!H', data[inner + 12:inner + 14])[0], data, inner + 14, 0, 1, interface)
+                return
+            self.protocols['dns' if 53 in (sport, dport) else 'udp'] += 1
+        elif proto == 1 and len(data) >= off + 8:
+            self.protocols['icmp'] += 1
+            icmp_type, code = data[off], data[off + 1]
+            if icmp_type == 3:
+                self.unreachable['icmp ' + ICMP_UNREACH.get(code, 'code {}'.format(code))] += 1
+                if code == 4:
+                    self.mtus[struct.unpack('!H', data[off + 6:off + 8])[0]] += 1
+            elif icmp_type == 11:
+                self.unreachable['icmp time exceeded'] += 1
+        elif proto == 58 and len(data) >= off + 8:
+            self.protocols['icmpv6'] += 1
+            icmp_type, code = data[off], data[off + 1]
+            if icmp_type == 1:
+                self.unreachable['icmpv6 ' + ICMP6_UNREACH.get(code, 'code {}'.format(code))] += 1
+            elif icmp_type == 2:
+                self.unreachable['icmpv6 packet too big'] += 1
+                self.mtus[struct.unpack('!I', data[off + 4:off + 8])[0]] += 1
+        elif proto == 132:
+            self.protocols['sctp'] += 1
+        else:
+            self.protocols['ip-proto-{}'.format(proto)] += 1
+
+    def result(self, top: int) -> Dict[str, Any]:
+        segments = len(self.seen_segments) + sum(self.retransmits.values())
+        min_mtu = min(self.mtus) if self.mtus else None
+        return {
+            'packets': self.packets,
+            'bytes': self.bytes,
+            'protocols': dict(self.protocols.most_common()),
+            'tunnels': dict(self.tunnels),
+            'tcp': {
+                'dataSegments': segments,
+                'retransmits': sum(self.retransmits.values()),
+                'retransmitPercent': round(100.0 * sum(self.retransmits.values()) / segments, 2) if segments else 0.0,
+                'resets': self.resets,
+                'zeroWindows': self.zero_windows,
+                'topRetransmitFlows': [
+                    {'flow': flow_name(k), 'retransmits': v} for k, v in self.retransmits.most_common(top)],
+            },
+            'unreachable': dict(self.unreachable.most_common()),
+            'reportedMtus': {str(k): v for k, v in sorted(self.mtus.items())},
+            'fragments': self.fragments,
+            'packetsOverReportedMtu': sum(v for k, v in self.sizes.items() if min_mtu and k > min_mtu),
+            'unparsed': self.unparsed,
+        }
+
+
+def addr(version: int, raw: bytes) -> str:
+    if version == 4:
+        return '.'.join(str(b) for b in raw)
+    words = ['{:x}'.format(w) for w in struct.unpack('!8H', raw)]
+    return ':'.join(words)
+
+
+def flow_name(key: Tuple[int, bytes, int, bytes, int]) -> str:
+    version, src, sport, dst, dport = key
+    fmt = '{}:{} -> {}:{}' if version == 4 else '[{}]:{} -> [{}]:{}'
+    return fmt.format(addr(version, src), sport, addr(version, dst), dport)
+
+
+def print_text(path: str, r: Dict[str, Any]):
+    print('{}: {} packets, {} bytes'.format(path, r['packets'], r['bytes']))
+    print('  Protocols: ' + ', '.join('{} {}'.format(k, v) for k, v in r['protocols'].items()))
+    tcp = r['tcp']
+    print('  TCP: {} data segments, {} retransmitted ({}%), {} resets, {} zero windows'.format(
+        tcp['dataSegments'], tcp['retransmits'], tcp['retransmitPercent'], tcp['resets'], tcp['zeroWindows']))
+    for flow in tcp['topRetransmitFlows']:
+        print('    {:>6}  {}'.format(flow['retransmits'], flow['flow']))
+    if r['unreachable']:
+        print('  ICMP errors: ' + ', '.join('{} {}'.format(k, v) for k, v in r['unreachable'].items()))
+    if r['reportedMtus']:
+        print('  Reported path MTUs: ' + ', '.join('{} ({}x)'.format(k, v) for k, v in r['reportedMtus'].items()))
+        print('  Packets larger than the smallest reported MTU: {}'.format(r['packetsOverReportedMtu']))
+    print('  IP fragments: {}'.format(r['fragments']))
+    if r['unparsed']:
+        print('  Unparsed frames (unsupported link type): {}'.format(r['unparsed']))
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='Summarize protocols and errors in pcap files')
+    parser.add_argument('files', nargs='+')
+    parser.add_argument('--json', action='store_true')
+    parser.add_argument('--top', type=int, default=5, help='flows with the most retransmissions to list (default 5)')
+    args = parser.parse_args()
+
+    results = {}
+    for path in args.files:
+        summary = Summary()
+        try:
+            for linktype, data, length in read_pcap(path):
+                summary.packet(linktype, data, length)
+        except (OSError, ValueError) as e:
+            print('Error: {}'.format(e), file=sys.stderr)
+            return 1
+        results[path] = summary.result(args.top)
+
+    if args.json:
+        print(json.dumps(results, indent=2))
+    else:
+        for i, (path, r) in enumerate(results.items()):
+            if i:
+                print()
+            print_text(path, r)
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
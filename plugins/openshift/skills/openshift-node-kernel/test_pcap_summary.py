@@ -0,0 +1,84 @@
+#!/usr/bin/env python3
+"""Tests for the pcap summary."""
+
+import os
+import struct
+import sys
+import tempfile
+
+sys.path.insert(0, os.path.dirname(__file__))
+from pcap_summary import GENEVE_PORT, Summary, read_pcap
+
+POD_A, POD_B = bytes([10, 128, 2, 10]), bytes([10, 129, 0, 5])
+NODE_A, NODE_B = bytes([192, 168, 10, 20]), bytes([192, 168, 10, 21])
+
+
+def ipv4(src, dst, proto, payload):
+    header = struct.pack("!BBHHHBBH4s4s", 0x45, 0, 20 + len(payload), 0, 0x4000, 64, proto, 0, src, dst)
+    return header + payload
+
+
+def tcp_segment(seq, data):
+    return struct.pack("!HHIIBBHHH", 40000, 5432, seq, 0, 5 << 4, 0x18, 65535, 0, 0) + data
+
+
+def ethernet(etype, payload):
+    return b"\x02" * 6 + b"\x04" * 6 + struct.pack("!H", etype) + payload
+
+
+def geneve(inner):
+    frame = ethernet(0x0800, inner)
+    udp = struct.pack("!HHHH", 6081, GENEVE_PORT, 8 + 8 + len(frame), 0)
+    return udp + struct.pack("!BBHI", 0, 0, 0x6558, 0) + frame
+
+
+def sll2(ifindex, packet):
+    return struct.pack("!HHiHBB8s", 0x0800, 0, ifindex, 1, 0, 6, b"\x02" * 6) + packet
+
+
+def write_pcap(path, frames):
+    with open(path, "wb") as f:
+        f.write(struct.pack("<IHHiIII", 0xa1b2c3d4, 2, 4, 0, 0, 65535, 276))
+        for frame in frames:
+            f.write(struct.pack("<IIII", 0, 0, len(frame), len(frame)) + frame)
+
+
+def summarize(tmp, name, frames):
+    path = os.path.join(tmp, name + ".pcap")
+    write_pcap(path, frames)
+    summary = Summary()
+    for linktype, data, length in read_pcap(path):
+        summary.packet(linktype, data, length)
+    return summary.result(5)
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+if __name__ == "__main__":
+    results = []
+    segment = ipv4(POD_A, POD_B, 6, tcp_segment(1000, b"select 1;"))
+    veth = sll2(12, segment)
+    nic = sll2(2, ipv4(NODE_A, NODE_B, 17, geneve(segment)))
+
+    with tempfile.TemporaryDirectory() as tmp:
+        r = summarize(tmp, "any", [veth, nic])
+        results.append(test("segment is decapsulated from Geneve", r["tunnels"] == {"geneve": 1}
+                            and r["protocols"]["tcp"] == 2))
+        results.append(test("segment on the veth and in Geneve on the NIC is not a retransmit",
+                            r["tcp"]["retransmits"] == 0))
+
+        r = summarize(tmp, "repeat", [veth, nic, veth])
+        results.append(test("segment repeated on the same interface is a retransmit", r["tcp"]["retransmits"] == 1
+                            and r["tcp"]["topRetransmitFlows"] == [
+                                {"flow": "10.128.2.10:40000 -> 10.129.0.5:5432", "retransmits": 1}]))
+
+        r = summarize(tmp, "tunnel", [nic, nic])
+        results.append(test("segment repeated inside the tunnel is a retransmit", r["tcp"]["retransmits"] == 1))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
@@ -0,0 +1,306 @@
+#!/usr/bin/env python3
+"""
+query_sbom.py - Index payload SBOMs and query packages by version
+
+Usage:
+  query_sbom.py index SBOM_DIR -o INDEX.json
+  query_sbom.py query INDEX.json "openssl < 3.0.7" [--type rpm] [--json]
+
+SBOM_DIR holds one SBOM per payload component, named <component>.spdx.json or
+<component>.cdx.json. Both SPDX 2.x JSON and CycloneDX JSON are supported.
+
+Query expressions are "<name> <op> <version>", where <name> may contain
+fnmatch wildcards (e.g. "openssl*") and <op> is one of <, <=, =, !=, >=, >.
+RPM packages, and packages without a purl, are compared with RPM version
+ordering (epoch:version-release). Every other purl type (golang, npm, cargo,
+...) is compared with semver precedence: a leading "v" and build metadata are
+ignored, and a pre-release sorts before its release, so "< 0.17.0" matches
+v0.17.0-rc.1. Go pseudo-versions are pre-releases ordered by their timestamp.
+
+Exit codes:
+  0 - Success (query: at least one match)
+  1 - Invalid arguments or unreadable input
+  2 - Query ran but matched nothing
+
+Requirements: Python 3.6+
+"""
+
+import argparse
+import fnmatch
+import itertools
+import json
+import os
+import re
+import sys
+from typing import Dict, List, Optional, Tuple
+from urllib.parse import unquote
+
+OPERATORS = ['<=', '>=', '!=', '<', '>', '=']
+
+
+def rpmvercmp(a: str, b: str) -> int:
+    """Compare two version strings with the RPM algorithm. Returns -1, 0, or 1."""
+    if a == b:
+        return 0
+    segment = re.compile(r'(~|\^|[0-9]+|[a-zA-Z]+)')
+    sa = [s for s in segment.findall(a)]
+    sb = [s for s in segment.findall(b)]
+    while sa or sb:
+        x = sa.pop(0) if sa else None
+        y = sb.pop(0) if sb else None
+        # Tilde sorts before everything, including the end of the string
+        if x == '~' or y == '~':
+            if x != y:
+                return -1 if x == '~' else 1
+            continue
+        # Caret sorts after the end of the string but before any other segment
+        if x == '^' or y == '^':
+            if x is None:
+                return -1
+            if y is None:
+                return 1
+            if x != y:
+                return 1 if x != '^' else -1
+            continue
+        if x is None or y is None:
+            return -1 if x is None else 1
+        if x.isdigit() and y.isdigit():
+            xi, yi = int(x), int(y)
+            if xi != yi:
+                return -1 if xi < yi else 1
+        elif x.isdigit() != y.isdigit():
+            # Numeric segments are newer than alphabetic ones
+            return 1 if x.isdigit() else -1
+        elif x != y:
+            return -1 if x < y else 1
+    return 0
+
+
+def split_evr(version: str) -> Tuple[int, str, Optional[str]]:
+    """Split [epoch:]version[-release] into its parts."""
+    epoch = 0
+    if ':' in version:
+        e, version = version.split(':', 1)
+        epoch = int(e) if e.isdigit() else 0
+    release = None
+    if '-' in version:
+        version, release = version.rsplit('-', 1)
+    return epoch, version.lstrip('v'), release
+
+
+def split_semver(version: str) -> Tuple[List[str], List[str]]:
+    """Split [v]major.minor.patch[-pre-release][+build] into core and pre-release identifiers."""
+    version = version.strip()
+    if version[:1] in ('v', 'V'):
+        version = version[1:]
+    core, _, pre = version.split('+', 1)[0].partition('-')
+    return core.split('.'), pre.split('.') if pre else []
+
+
+def semvercmp(a: str, b: str) -> int:
+    """Compare two versions with semver precedence. Returns -1, 0, or 1.
+
+    Missing core parts count as 0, so "1.2" equals "1.2.0". A Go pseudo-version
+    such as v1.2.4-0.20240102150405-abcdef123456 is a pre-release of the next
+    patch, so it sorts after v1.2.3, before v1.2.4, and by its timestamp
+    against other pseudo-versions of the same base.
+    """
+    (ca, pa), (cb, pb) = split_semver(a), split_semver(b)
+    for x, y in itertools.zip_longest(ca, cb, fillvalue='0'):
+        result = rpmvercmp(x, y)
+        if result != 0:
+            return result
+    # A release is newer than any of its pre-releases
+    if not pa or not pb:
+        return (not pa) - (not pb)
+    for x, y in zip(pa, pb):
+        if x == y:
+            continue
+        if x.isdigit() and y.isdigit():
+            return -1 if int(x) < int(y) else 1
+        if x.isdigit() != y.isdigit():
+            # Numeric identifiers are older than alphanumeric ones
+            return -1 if x.isdigit() else 1
+        return -1 if x < y else 1
+    return (len(pa) > len(pb)) - (len(pa) < len(pb))
+
+
+def compare_versions(installed: str, wanted: str, pkg_type: str = 'rpm') -> int:
+    """Compare an installed version against a query version.
+
+    Packages other than RPMs use semvercmp. For RPMs, a query without a
+    release (e.g. "3.0.7") compares only epoch and version, so "3.0.7-27.el9"
+    is equal to "3.0.7". A query without an epoch ignores the installed
+    epoch, since CVE advisories rarely state one.
+    """
+    if pkg_type not in ('rpm', 'unknown'):
+        return semvercmp(installed, wanted)
+    ie, iv, ir = split_evr(installed)
+    we, wv, wr = split_evr(wanted)
+    if ':' in wanted and ie != we:
+        return -1 if ie < we else 1
+    result = rpmvercmp(iv, wv)
+    if result != 0 or wr is None or ir is None:
+        return result
+    return rpmvercmp(ir, wr)
+
+
+def purl_type(purl: str) -> str:
+    """Extract the package type from a purl, e.g. pkg:rpm/... -> rpm."""
+    if not purl or not purl.startswith('pkg:'):
+        return 'unknown'
+    return purl[4:].split('/', 1)[0]
+
+
+def rpm_version_from_purl(purl: str) -> Optional[str]:
+    """Build epoch:version-release from an RPM purl, when it has an epoch qualifier."""
+    match = re.match(r'pkg:rpm/[^@]+@([^?]+)(?:\?(.*))?', purl or '')
+    if not match:
+        return None
+    version = unquote(match.group(1))
+    qualifiers = dict(q.split('=', 1) for q in (match.group(2) or '').split('&') if '=' in q)
+    if qualifiers.get('epoch') and ':' not in version:
+        version = f"{qualifiers['epoch']}:{version}"
+    return version
+
+
+def parse_sbom(path: str) -> List[Dict[str, str]]:
+    """Return the packages of an SPDX or CycloneDX JSON document."""
+    with open(path, 'r') as f:
+        doc = json.load(f)
+
+    packages = []
+    if 'spdxVersion' in doc:
+        for pkg in doc.get('packages', []):
+            purl = next((r.get('referenceLocator') for r in pkg.get('externalRefs', [])
+                         if r.get('referenceType') == 'purl'), '')
+            packages.append({'name': pkg.get('name', ''), 'version': pkg.get('versionInfo', ''), 'purl': purl})
+    elif doc.get('bomFormat') == 'CycloneDX':
+        stack = list(doc.get('components', []))
+        while stack:
+            comp = stack.pop()
+            stack.extend(comp.get('components', []))
+            packages.append({'name': comp.get('name', ''), 'version': comp.get('version', ''),
+                             'purl': comp.get('purl', '')})
+    else:
+        raise ValueError('not an SPDX or CycloneDX JSON document')
+
+    for pkg in packages:
+        pkg['type'] = purl_type(pkg['purl'])
+        if pkg['type'] == 'rpm':
+            pkg['version'] = rpm_version_from_purl(pkg['purl']) or pkg['version']
+    return [p for p in packages if p['name'] and p['version']]
+
+
+def build_index(sbom_dir: str, output: str) -> int:
+    """Index all SBOMs in a directory into one JSON file."""
+    index = []
+    failed = []
+    for name in sorted(os.listdir(sbom_dir)):
+        if not name.endswith('.json'):
+            continue
+        image = re.sub(r'\.(spdx|cdx)\.json$|\.json$', '', name)
+        try:
+            packages = parse_sbom(os.path.join(sbom_dir, name))
+        except (OSError, ValueError) as e:
+            failed.append(name)
+            print(f"Warning: {name}: {e}", file=sys.stderr)
+            continue
+        seen = set()
+        for pkg in packages:
+            key = (pkg['name'], pkg['version'], pkg['type'])
+            if key not in seen:
+                seen.add(key)
+                index.append(dict(pkg, image=image))
+
+    with open(output, 'w') as f:
+        json.dump(index, f)
+    images = len({p['image'] for p in index})
+    print(f"Indexed {len(index)} packages from {images} images into {output}")
+    if failed:
+        print(f"Failed to parse {len(failed)} SBOMs: {', '.join(failed)}", file=sys.stderr)
+    return 0
+
+
+def parse_query(expr: str) -> Tuple[str, Optional[str], Optional[str]]:
+    """Parse '<name> [<op> <version>]'."""
+    for op in OPERATORS:
+        if op in expr:
+            name, version = expr.split(op, 1)
+            return name.strip(), op, version.strip()
+    return expr.strip(), None, None
+
+
+def matches(installed: str, op: str, wanted: str, pkg_type: str = 'rpm') -> bool:
+    result = compare_versions(installed, wanted, pkg_type)
+    return {
+        '<': result < 0, '<=': result <= 0, '=': result == 0,
+        '!=': result != 0, '>=': result >= 0, '>': result > 0,
+    }[op]
+
+
+def run_query(index_path: str, expr: str, pkg_type: Optional[str], as_json: bool) -> int:
+    """Print every image that ships a package matching the query."""
+    with open(index_path, 'r') as f:
+        index = json.load(f)
+
+    name, op, version = parse_query(expr)
+    if not name or (op and not version):
+        print(f"Error: invalid query: {expr!r}", file=sys.stderr)
+        return 1
+
+    results = []
+    for pkg in index:
+        if not fnmatch.fnmatch(pkg['name'], name):
+            continue
+        if pkg_type and pkg['type'] != pkg_type:
+            continue
+        if op and not matches(pkg['version'], op, version, pkg['type']):
+            continue
+        results.append(pkg)
+
+    results.sort(key=lambda p: (p['image'], p['name']))
+    if as_json:
+        print(json.dumps({'query': expr, 'matches': results}, indent=2))
+    else:
+        images = sorted({p['image'] for p in results})
+        print(f"Query: {expr}")
+        print(f"Matches: {len(results)} packages in {len(images)} images\n")
+        if results:
+            print(f"{'IMAGE':<45} {'PACKAGE':<30} {'VERSION':<30} TYPE")
+            for p in results:
+                print(f"{p['image']:<45} {p['name']:<30} {p['version']:<30} {p['type']}")
+    return 0 if results else 2
+
+
+def main():
+    parser = argparse.ArgumentParser(description='Index payload SBOMs and query packages by version')
+    sub = parser.add_subparsers(dest='command')
+
+    p_index = sub.add_parser('index', help='Build a package index from a directory of SBOMs')
+    p_index.add_argument('sbom_dir')
+    p_index.add_argument('-o', '--output', required=True)
+
+    p_query = sub.add_parser('query', help='Find images shipping a package, optionally by version')
+    p_query.add_argument('index')
+    p_query.add_argument('expression', help='e.g. "openssl < 3.0.7" or "golang.org/x/net*"')
+    p_query.add_argument('--type', help='Only packages of this purl type (rpm, golang, pypi, npm, ...)')
+    p_query.add_argument('--json', action='store_true', help='Output results as JSON')
+
+    args = parser.parse_args()
+    if args.command == 'index':
+        if not os.path.isdir(args.sbom_dir):
+            print(f"Error: Directory not found: {args.sbom_dir}", file=sys.stderr)
+            return 1
+        return build_index(args.sbom_dir, args.output)
+    if args.command == 'query':
+        if not os.path.isfile(args.index):
+            print(f"Error: Index not found: {args.index}", file=sys.stderr)
+            return 1
+        return run_query(args.index, args.expression, args.type, args.json)
+    parser.print_help()
+    return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,49 @@
+#!/usr/bin/env python3
+"""Tests for the version comparison of the SBOM query helper."""
+
+import os
+import sys
+
+sys.path.insert(0, os.path.dirname(__file__))
+from query_sbom import matches
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+if __name__ == "__main__":
+    results = []
+
+    results.append(test("an RPM query without a release matches every release",
+                        matches("3.0.7-27.el9", "=", "3.0.7", "rpm")))
+    results.append(test("RPM releases are compared when the query has one",
+                        matches("3.0.7-27.el9", "<", "3.0.7-28.el9", "rpm")))
+    results.append(test("an RPM query without an epoch ignores the installed epoch",
+                        matches("1:3.0.7-27.el9", "=", "3.0.7", "rpm")))
+    results.append(test("packages without a purl use RPM ordering",
+                        matches("3.0.7-27.el9", "=", "3.0.7", "unknown")))
+
+    results.append(test("a semver pre-release sorts before its release",
+                        matches("v0.17.0-rc.1", "<", "0.17.0", "golang")))
+    results.append(test("a leading v is ignored", matches("v0.17.0", "=", "0.17.0", "golang")))
+    results.append(test("build metadata is ignored", matches("v2.0.0+incompatible", "=", "v2.0.0", "golang")))
+    results.append(test("missing core parts count as 0", matches("1.2", "=", "1.2.0", "npm")))
+    results.append(test("numeric pre-release identifiers compare as numbers",
+                        matches("1.0.0-beta.2", "<", "1.0.0-beta.11", "npm")))
+    results.append(test("a longer pre-release with the same prefix is newer",
+                        matches("1.0.0-alpha.1", ">", "1.0.0-alpha", "npm")))
+
+    pseudo = "v0.17.1-0.20240102150405-abcdef123456"
+    results.append(test("a pseudo-version sorts after the tag it was cut from", matches(pseudo, ">", "0.17.0", "golang")))
+    results.append(test("a pseudo-version sorts before the next tag", matches(pseudo, "<", "0.17.1", "golang")))
+    results.append(test("pseudo-versions of one base sort by timestamp",
+                        matches(pseudo, ">", "v0.17.1-0.20231102150405-fedcba654321", "golang")))
+    results.append(test("a v0.0.0 pseudo-version sorts before any tag",
+                        matches("v0.0.0-20231201000000-abcdef123456", "<", "0.1.0", "golang")))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
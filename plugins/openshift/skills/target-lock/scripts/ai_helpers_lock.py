@@ -0,0 +1 @@
+../../../../../lib/ai_helpers_lock.py
\ No newline at end of file
@@ -0,0 +1,279 @@
+#!/usr/bin/env python3
+"""
+host_compat.py - Collect ESXi NIC and HBA driver and firmware versions and
+compare them against a known-bad list
+
+Usage:
+  host_compat.py collect [--cluster PATH]... [--host PATH]... -o INVENTORY.json
+  host_compat.py check INVENTORY.json [--known-bad FILE]... [--json]
+
+collect uses govc (GOVC_URL and credentials from the environment) to read,
+for every ESXi host: the ESXi version and build, each physical NIC with its
+driver, driver version, and firmware, and each storage adapter with its
+driver, driver version, and firmware (Fibre Channel adapters only). Without
+--cluster or --host, every host in the inventory is collected.
+
+check matches the inventory against known-bad.json next to this script and
+any --known-bad files, and reports drivers whose version differs between
+hosts of the same vSphere cluster.
+
+Known-bad entries:
+  {"kind": "nic|hba", "driver": "i40en", "driverVersion": "<1.10.6",
+   "firmware": "8.30", "esxi": ">=7.0.3", "symptom": "...", "reference": "..."}
+Every field except kind, driver, and symptom is optional. Version fields are
+an exact version, or comparisons joined by commas (">=1.8,<1.10.6").
+
+Exit codes:
+  0 - No known-bad combination found
+  1 - Invalid arguments or govc failure
+  2 - At least one known-bad combination found
+
+Requirements: Python 3.6+, govc
+"""
+
+import argparse
+import json
+import os
+import re
+import subprocess
+import sys
+from typing import Any, Dict, List, Optional
+
+EMBEDDED = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'known-bad.json')
+
+
+def govc(args: List[str]) -> Any:
+    cmd = ['govc'] + args
+    try:
+        proc = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+                              universal_newlines=True)
+    except FileNotFoundError:
+        raise RuntimeError('govc not found in PATH')
+    if proc.returncode != 0:
+        raise RuntimeError('{} failed: {}'.format(' '.join(cmd), proc.stderr.strip()))
+    return json.loads(proc.stdout) if proc.stdout.strip() else None
+
+
+def esxcli(host: str, args: List[str]) -> List[Dict[str, Any]]:
+    """Run esxcli on a host and return rows with single values unwrapped."""
+    data = govc(['host.esxcli', '-json', '-host', host] + args) or {}
+    rows = data.get('Values') or data.get('values') or []
+    return [{k: (v[0] if isinstance(v, list) and len(v) == 1 else v) for k, v in row.items()} for row in rows]
+
+
+def find_value(obj: Any, pattern: str) -> Optional[str]:
+    """Find the first value whose key matches pattern, at any depth."""
+    if isinstance(obj, dict):
+        for k, v in obj.items():
+            if re.fullmatch(pattern, k, re.I) and isinstance(v, (str, list)):
+                return v[0] if isinstance(v, list) and v else v or None
+        for v in obj.values():
+            found = find_value(v, pattern)
+            if found:
+                return found
+    if isinstance(obj, list):
+        for v in obj:
+            found = find_value(v, pattern)
+            if found:
+                return found
+    return None
+
+
+def list_hosts(clusters: List[str], hosts: List[str]) -> List[str]:
+    if hosts and not clusters:
+        return hosts
+    out = list(hosts)
+    for root in clusters or ['/']:
+        found = subprocess.run(['govc', 'find', root, '-type', 'h'], stdout=subprocess.PIPE,
+                               stderr=subprocess.PIPE, universal_newlines=True)
+        if found.returncode != 0:
+            raise RuntimeError('govc find {} failed: {}'.format(root, found.stderr.strip()))
+        out.extend(line for line in found.stdout.splitlines() if line)
+    return sorted(set(out))
+
+
+def collect_host(path: str) -> Dict[str, Any]:
+    info = govc(['host.info', '-json', path]) or {}
+    system = (info.get('hostSystems') or info.get('HostSystems') or [{}])[0]
+    product = find_value(system, 'fullName') or '-'
+    modules = {}
+
+    def module_version(driver: str) -> Optional[str]:
+        if driver not in modules:
+            try:
+                rows = esxcli(path, ['system', 'module', 'get', '-m', driver])
+                modules[driver] = rows[0].get('Version') if rows else None
+            except RuntimeError:
+                modules[driver] = None
+        return modules[driver]
+
+    host = {'host': path, 'cluster': os.path.dirname(path.rstrip('/')), 'esxi': product, 'nics': [], 'hbas': []}
+    m = re.search(r'(\d+\.\d+\.\d+)', product)
+    host['esxiVersion'] = m.group(1) if m else None
+
+    for nic in esxcli(path, ['network', 'nic', 'list']):
+        name = nic.get('Name')
+        details = {}
+        try:
+            details = (esxcli(path, ['network', 'nic', 'get', '-n', name]) or [{}])[0]
+        except RuntimeError:
+            pass
+        host['nics'].append({
+            'name': name,
+            'driver': nic.get('Driver'),
+            'driverVersion': find_value(details, r'(Driver)?Version') or module_version(nic.get('Driver')),
+            'firmware': find_value(details, r'Firmware ?Version'),
+            'link': nic.get('LinkStatus') or nic.get('Link'),
+            'speed': nic.get('Speed'),
+            'description': nic.get('Description'),
+        })
+
+    fc = {}
+    try:
+        fc = {row.get('Adapter'): row for row in esxcli(path, ['storage', 'san', 'fc', 'list'])}
+    except RuntimeError:
+        pass
+    for hba in esxcli(path, ['storage', 'core', 'adapter', 'list']):
+        name = hba.get('HBAName')
+        driver = hba.get('Driver')
+        fc_row = fc.get(name, {})
+        host['hbas'].append({
+            'name': name,
+            'driver': driver,
+            'driverVersion': fc_row.get('DriverVersion') or module_version(driver),
+            'firmware': fc_row.get('FirmwareVersion'),
+            'description': hba.get('Description'),
+        })
+    return host
+
+
+def parse_version(text: str) -> List[Any]:
+    return [int(p) if p.isdigit() else p for p in re.split(r'[.\-_ ]', text) if p]
+
+
+def version_matches(actual: Optional[str], spec: Optional[str]) -> bool:
+    """True if there is no spec, or actual satisfies every comparison in it (ValueError if one is malformed)."""
+    if not spec:
+        return True
+    if not actual:
+        return False
+    for part in spec.split(','):
+        if not part.strip():
+            continue  # "" or a trailing comma, as in ">=4.14,"
+        m = re.match(r'\s*(==|<=|>=|<|>|=)?\s*([^\s<>=]\S*)\s*$', part)
+        if not m:
+            raise ValueError('invalid version spec {!r}: {!r} is not [OP]VERSION'.format(spec, part.strip()))
+        op, want = (m.group(1) or '=='), m.group(2)
+        try:
+            a, w = parse_version(actual), parse_version(want)
+            ok = {'<': a < w, '<=': a <= w, '>': a > w, '>=': a >= w, '=': a == w, '==': a == w}[op]
+        except TypeError:
+            ok = op in ('=', '==') and actual == want
+        if not ok:
+            return False
+    return True
+
+
+def load_known_bad(files: List[str]) -> List[Dict[str, Any]]:
+    entries = []
+    for path in [EMBEDDED] + files:
+        if os.path.exists(path) or path != EMBEDDED:
+            with open(path, encoding='utf-8') as f:
+                entries.extend(json.load(f))
+    return entries
+
+
+def check(inventory: List[Dict[str, Any]], known_bad: List[Dict[str, Any]]) -> Dict[str, Any]:
+    matches = []
+    for host in inventory:
+        for kind, devices in (('nic', host['nics']), ('hba', host['hbas'])):
+            for dev in devices:
+                for entry in known_bad:
+                    if entry.get('kind') != kind or entry.get('driver') != dev.get('driver'):
+                        continue
+                    if (version_matches(dev.get('driverVersion'), entry.get('driverVersion'))
+                            and version_matches(dev.get('firmware'), entry.get('firmware'))
+                            and version_matches(host.get('esxiVersion'), entry.get('esxi'))):
+                        matches.append({'host': host['host'], 'device': dev['name'], 'driver': dev['driver'],
+                                        'driverVersion': dev.get('driverVersion'), 'firmware': dev.get('firmware'),
+                                        'symptom': entry.get('symptom'), 'reference': entry.get('reference')})
+
+    # Same driver, different versions within one vSphere cluster
+    mixed = []
+    by_cluster = {}
+    for host in inventory:
+        for dev in host['nics'] + host['hbas']:
+            key = (host['cluster'], dev.get('driver'))
+            by_cluster.setdefault(key, {}).setdefault(
+                '{} / fw {}'.format(dev.get('driverVersion') or '-', dev.get('firmware') or '-'), set()).add(host['host'])
+    for (cluster, driver), versions in sorted(by_cluster.items()):
+        if driver and len(versions) > 1:
+            mixed.append({'cluster': cluster, 'driver': driver,
+                          'versions': {v: sorted(h) for v, h in sorted(versions.items())}})
+    return {'hosts': len(inventory), 'knownBad': matches, 'mixedVersions': mixed}
+
+
+def cmd_collect(args: argparse.Namespace) -> int:
+    inventory = []
+    for path in list_hosts(args.cluster, args.host):
+        print('Collecting {}'.format(path), file=sys.stderr)
+        try:
+            inventory.append(collect_host(path))
+        except RuntimeError as e:
+            print('Warning: {}: {}'.format(path, e), file=sys.stderr)
+    with open(args.output, 'w', encoding='utf-8') as f:
+        json.dump(inventory, f, indent=2)
+    print('Wrote {} ({} hosts)'.format(args.output, len(inventory)))
+    return 0 if inventory else 1
+
+
+def cmd_check(args: argparse.Namespace) -> int:
+    with open(args.inventory, encoding='utf-8') as f:
+        inventory = json.load(f)
+    result = check(inventory, load_known_bad(args.known_bad))
+    if args.json:
+        print(json.dumps(result, indent=2))
+    else:
+        print('{} hosts, {} known-bad matches, {} drivers with mixed versions'.format(
+            result['hosts'], len(result['knownBad']), len(result['mixedVersions'])))
+        for m in result['knownBad']:
+            print('KNOWN-BAD  {} {} {} {} fw {}: {}'.format(m['host'], m['device'], m['driver'],
+                                                            m['driverVersion'], m['firmware'] or '-', m['symptom']))
+            if m.get('reference'):
+                print('           {}'.format(m['reference']))
+        for m in result['mixedVersions']:
+            print('MIXED      {} {}'.format(m['cluster'], m['driver']))
+            for version, hosts in m['versions'].items():
+                print('           {}: {}'.format(version, ', '.join(os.path.basename(h) for h in hosts)))
+    return 2 if result['knownBad'] else 0
+
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description='ESXi NIC and HBA driver and firmware compatibility report')
+    sub = parser.add_subparsers(dest='command')
+
+    p = sub.add_parser('collect', help='collect driver and firmware versions with govc')
+    p.add_argument('--cluster', action='append', default=[], help='vSphere cluster inventory path')
+    p.add_argument('--host', action='append', default=[], help='ESXi host inventory path')
+    p.add_argument('-o', '--output', required=True)
+
+    p = sub.add_parser('check', help='compare an inventory against known-bad versions')
+    p.add_argument('inventory')
+    p.add_argument('--known-bad', action='append', default=[], metavar='FILE')
+    p.add_argument('--json', action='store_true')
+
+    args = parser.parse_args()
+    try:
+        if args.command == 'collect':
+            return cmd_collect(args)
+        if args.command == 'check':
+            return cmd_check(args)
+    except (RuntimeError, OSError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    parser.print_help(sys.stderr)
+    return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,205 @@
+#!/usr/bin/env python3
+"""Tests for the vSphere inventory tag commands, credential sources, and sessions, run against a fake govc and oc."""
+
+import base64
+import json
+import os
+import stat
+import subprocess
+import sys
+import tempfile
+from pathlib import Path
+
+SCRIPT = Path(__file__).resolve().parent / "vsphere_inventory.py"
+
+# answers keyed by the govc subcommand; tags.attached.ls is keyed by the object path
+FAKE_GOVC = r'''#!/usr/bin/env python3
+import json, os, sys
+args = sys.argv[1:]
+server = os.environ.get("GOVC_URL")
+categories = [{"id": "urn:cat:r", "name": "openshift-region", "cardinality": "SINGLE", "associable_types": ["Datacenter"]},
+              {"id": "urn:cat:z", "name": "openshift-zone", "cardinality": "SINGLE", "associable_types": ["ClusterComputeResource"]}]
+tags = [{"id": "urn:tag:r1", "name": "us-east", "category_id": "urn:cat:r"},
+        {"id": "urn:tag:z1", "name": "us-east-1a", "category_id": "urn:cat:z"},
+        {"id": "urn:tag:z2", "name": "us-east-1b", "category_id": "urn:cat:z"}]
+# older govc releases print tag names rather than IDs
+attached = {"/DC1": ["urn:tag:r1"], "/DC1/host/Cluster1": ["urn:tag:z1"], "/DC1/host/Cluster2": ["us-east-1b"]}
+if server == "down.example.com":
+    sys.exit("govc: no route to host")
+if args[0] == "about":
+    # reports the credentials govc received, to check they come through the environment
+    print(json.dumps({"about": {"version": "8.0.3", "build": os.environ.get("GOVC_PERSIST_SESSION"), "instanceUuid": "{}:{}:{}".format(
+        os.environ.get("GOVC_USERNAME"), os.environ.get("GOVC_PASSWORD"), os.environ.get("GOVC_INSECURE"))}}))
+elif args[0] == "session.logout":
+    pass
+elif args[0] == "object.collect":
+    print("[]")
+elif args[0] == "tags.category.ls":
+    print(json.dumps(categories))
+elif args[0] == "tags.ls":
+    print(json.dumps(tags))
+elif args[0] == "tags.attached.ls":
+    if args[-1] not in attached:
+        sys.exit("govc: {} not found".format(args[-1]))
+    print(json.dumps(attached[args[-1]]))
+else:
+    sys.exit("govc: unexpected {}".format(" ".join(args)))
+'''
+
+CREDENTIALS = """[Global]
+user = "global-user"
+password = "global%pass"
+insecure-flag = "1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "DC1"
+
+[VirtualCenter "vc2.example.com"]
+user = "admin2"
+password = "secret2"
+insecure-flag = "0"
+"""
+
+# the vsphere-creds secret and the cloud provider config, as oc prints them
+SECRET = {"data": {"vc3.example.com.username": base64.b64encode(b"cluster-user").decode(),
+                   "vc3.example.com.password": base64.b64encode(b"cluster-pass").decode()}}
+CLOUD_CONFIG = {"data": {"config": '[Global]\ninsecure-flag = "1"\n\n[VirtualCenter "vc3.example.com"]\n'}}
+
+
+def executable(path, text):
+    path.write_text(text)
+    path.chmod(path.stat().st_mode | stat.S_IEXEC)
+
+
+def fake_oc(bin_dir):
+    """An oc that prints the secret or ConfigMap and records its arguments."""
+    (bin_dir / "secret.json").write_text(json.dumps(SECRET))
+    (bin_dir / "configmap.json").write_text(json.dumps(CLOUD_CONFIG))
+    executable(bin_dir / "oc", '#!/bin/sh\necho "$@" >> {0}/oc.log\n'
+               'case "$*" in *secret*) cat {0}/secret.json ;; *) cat {0}/configmap.json ;; esac\n'.format(bin_dir))
+
+
+def about(*args, env):
+    """The credentials the fake govc received, as user:password:insecure."""
+    proc = run("dump", "--skip-vms", "--json", *args, env=env)
+    return json.loads(proc.stdout)["vcenter"]["instanceUuid"] if proc.returncode == 0 else proc.stderr
+
+
+def run(*args, env):
+    return subprocess.run([sys.executable, str(SCRIPT)] + list(args), stdout=subprocess.PIPE,
+                          stderr=subprocess.PIPE, universal_newlines=True, env=env)
+
+
+def run_json(*args, env):
+    proc = run(*args, "--json", env=env)
+    return proc.returncode, json.loads(proc.stdout) if proc.returncode == 0 else None
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+if __name__ == "__main__":
+    results = []
+
+    with tempfile.TemporaryDirectory() as tmp:
+        executable(Path(tmp) / "govc", FAKE_GOVC)
+        fake_oc(Path(tmp))
+        env = dict(os.environ, PATH="{}{}{}".format(tmp, os.pathsep, os.environ.get("PATH", "")))
+
+        rc, out = run_json("list-tag-categories", env=env)
+        results.append(test("list-tag-categories counts the tags per category",
+                            rc == 0 and [(c["name"], c["tags"]) for c in out["tagCategories"]]
+                            == [("openshift-region", 1), ("openshift-zone", 2)]))
+
+        rc, out = run_json("list-tags", "--category", "openshift-zone", "--name-pattern", "*-1A", env=env)
+        results.append(test("list-tags filters by category and name",
+                            rc == 0 and out["tags"] == [{"id": "urn:tag:z1", "name": "us-east-1a",
+                                                         "category": "openshift-zone", "description": None}]))
+        results.append(test("list-tags rejects an unknown category",
+                            run("list-tags", "--category", "nope", env=env).returncode == 1))
+
+        rc, out = run_json("list-attached-tags", "--object", "/DC1/host/Cluster1", env=env)
+        results.append(test("list-attached-tags resolves tag IDs",
+                            rc == 0 and out["tags"] == [{"category": "openshift-zone", "name": "us-east-1a"}]))
+        rc, out = run_json("list-attached-tags", "--object", "/DC1/host/Cluster2", env=env)
+        results.append(test("list-attached-tags resolves tag names",
+                            rc == 0 and out["tags"] == [{"category": "openshift-zone", "name": "us-east-1b"}]))
+        missing = run("list-attached-tags", "--object", "/DC1/host/Gone", env=env)
+        results.append(test("list-attached-tags fails for a missing object",
+                            missing.returncode == 1 and "not found" in missing.stderr))
+
+        config = Path(tmp) / "vcenters.json"
+        config.write_text(json.dumps({"vcenters": [{"server": "vc1.example.com", "username": "admin1",
+                                                    "passwordEnv": "VC1_PASSWORD"},
+                                                   {"server": "vc2.example.com", "username": "admin2",
+                                                    "password": "secret2", "insecure": True},
+                                                   {"server": "down.example.com", "password": "secret3"}]}))
+        env["VC1_PASSWORD"] = "secret1"
+        proc = run("dump", "--config", str(config), "--skip-vms", "--json", env=env)
+        out = json.loads(proc.stdout) if proc.stdout else {}
+        vcenters = out.get("vcenters", {})
+        results.append(test("dump covers every vCenter of the config, keyed by server",
+                            list(vcenters) == ["vc1.example.com", "vc2.example.com", "down.example.com"]))
+        results.append(test("dump passes each vCenter's credentials in its environment",
+                            [vcenters.get(s, {}).get("vcenter", {}).get("instanceUuid")
+                             for s in ("vc1.example.com", "vc2.example.com")]
+                            == ["admin1:secret1:false", "admin2:secret2:true"]))
+        results.append(test("an unreachable vCenter is reported and makes the dump partial",
+                            proc.returncode == 2 and vcenters.get("down.example.com", {}).get("errors")
+                            and not vcenters["vc1.example.com"]["errors"]))
+
+        env["VSPHERE_CONFIG"] = str(config)
+        results.append(test("list commands need --vcenter when the config lists several",
+                            run("list-tags", env=env).returncode == 1))
+        proc = run("list-tags", "--vcenter", "vc2.example.com", env=env)
+        results.append(test("--vcenter selects one vCenter of VSPHERE_CONFIG", proc.returncode == 0))
+        results.append(test("--vcenter rejects a server the config does not list",
+                            run("list-tags", "--vcenter", "vc9.example.com", env=env).returncode == 1))
+        proc = run("dump", "--vcenter", "vc1.example.com", "--no-session-cache", "--json", env=env)
+        results.append(test("--no-session-cache turns off govc's session cache",
+                            proc.returncode == 0 and json.loads(proc.stdout)["vcenter"]["build"] == "false"))
+        proc = run("dump", "--vcenter", "vc1.example.com", "--json", env=env)
+        results.append(test("govc's session cache stays on by default",
+                            proc.returncode == 0 and json.loads(proc.stdout)["vcenter"]["build"] is None))
+        proc = run("logout", env=env)
+        results.append(test("logout ends the session of every vCenter of the config",
+                            proc.stdout.count("Logged out of") == 2 and "down.example.com" in proc.stderr
+                            and proc.returncode == 1))
+        proc = run("logout", "--vcenter", "vc2.example.com", env=env)
+        results.append(test("logout --vcenter ends one session",
+                            proc.returncode == 0 and proc.stdout.strip() == "Logged out of vc2.example.com"))
+        del env["VC1_PASSWORD"]
+        proc = run("dump", env=env)
+        results.append(test("a missing passwordEnv variable is an error",
+                            proc.returncode == 1 and "VC1_PASSWORD" in proc.stderr))
+
+        credentials = Path(tmp) / "cloud.conf"
+        credentials.write_text(CREDENTIALS)
+        results.append(test("--credentials-file takes [Global] values for a server without its own",
+                            about("--credentials-file", str(credentials), "--vcenter", "vc1.example.com", env=env)
+                            == "global-user:global%pass:true"))
+        results.append(test("--credentials-file takes a server's own values over [Global]",
+                            about("--credentials-file", str(credentials), "--vcenter", "vc2.example.com", env=env)
+                            == "admin2:secret2:false"))
+        results.append(test("--from-cluster reads the vsphere-creds secret and the insecure flag",
+                            about("--from-cluster", "--context", "admin", env=env) == "cluster-user:cluster-pass:true"))
+        results.append(test("--from-cluster passes --context to oc",
+                            (Path(tmp) / "oc.log").read_text().startswith("--context admin -n kube-system get secret")))
+        results.append(test("--config, --credentials-file, and --from-cluster exclude each other",
+                            run("dump", "--config", str(config), "--from-cluster", env=env).returncode == 1))
+
+        env.update(GOVC_URL="env.example.com", GOVC_USERNAME="env-user", GOVC_PASSWORD="env-pass", GOVC_INSECURE="1")
+        results.append(test("--credentials-file takes precedence over VSPHERE_CONFIG and GOVC_*",
+                            about("--credentials-file", str(credentials), "--vcenter", "vc2.example.com", env=env)
+                            == "admin2:secret2:false"))
+        results.append(test("VSPHERE_CONFIG takes precedence over GOVC_*",
+                            about("--vcenter", "vc2.example.com", env=env) == "admin2:secret2:true"))
+        del env["VSPHERE_CONFIG"]
+        results.append(test("GOVC_* is used without another source", about(env=env) == "env-user:env-pass:1"))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
@@ -0,0 +1,1110 @@
+#!/usr/bin/env python3
+"""
+vsphere_inventory.py - Snapshot the vCenter inventory that OpenShift installs
+use into one JSON document, list its VMs, templates, resource pools,
+folders, datastores, networks, storage policies, and tags, or describe one
+datastore or network
+
+Usage:
+  vsphere_inventory.py dump [--skip-vms] [--tags] [COMMON]
+  vsphere_inventory.py list-vms [--cluster C] [--folder F] [--name-pattern GLOB] [--powered-on] [COMMON]
+  vsphere_inventory.py list-templates [--cluster C] [--folder F] [--name-pattern GLOB] [COMMON]
+  vsphere_inventory.py list-resource-pools [--cluster C] [--name-pattern GLOB] [COMMON]
+  vsphere_inventory.py list-folders [--folder F] [--name-pattern GLOB] [COMMON]
+  vsphere_inventory.py list-datastores [--cluster C] [--name-pattern GLOB] [--detailed] [COMMON]
+  vsphere_inventory.py describe-datastore NAME|PATH [--cluster C] [COMMON]
+  vsphere_inventory.py list-networks [--cluster C] [--name-pattern GLOB] [COMMON]
+  vsphere_inventory.py describe-network NAME|PATH [--cluster C] [COMMON]
+  vsphere_inventory.py list-storage-policies [--name-pattern GLOB] [--timeout SECONDS] [--json] [VCENTER]
+  vsphere_inventory.py list-tag-categories [--name-pattern GLOB] [--timeout SECONDS] [--json] [VCENTER]
+  vsphere_inventory.py list-tags [--category NAME] [--name-pattern GLOB] [--timeout SECONDS] [--json] [VCENTER]
+  vsphere_inventory.py list-attached-tags --object PATH [--timeout SECONDS] [--json] [VCENTER]
+  vsphere_inventory.py logout [--timeout SECONDS] [VCENTER]
+
+  COMMON: [--datacenter DC]... [--parallel N] [--timeout SECONDS] [--max-objects N]
+          [--progress] [--json] [VCENTER]
+  VCENTER: [--config FILE | --credentials-file FILE | --from-cluster [--context CTX]]
+           [--vcenter SERVER] [--no-session-cache]
+
+Each object type (datacenters, folders, compute resources, hosts,
+datastores, networks, port groups, opaque networks, distributed switches,
+resource pools, virtual machines) is read with one
+`govc object.collect -type` call, which retrieves the selected properties of
+every object of that type through a single container view instead of one
+call per object. The calls run in parallel, and the references between
+objects are resolved into inventory paths, so the result reads like
+`govc ls` output. With --datacenter, every type except datacenters and
+folders is collected per datacenter. The list commands collect only the
+types their rows need and filter them: --cluster by cluster name or path,
+--folder by inventory path prefix, --name-pattern by a case-insensitive glob.
+For datastores and networks, --cluster keeps those on a host of the cluster.
+
+Datastore rows always carry the capacity, type, and accessibility. The
+detailed rows (list-datastores --detailed, describe-datastore) add the
+datastore's maintenance mode, its datastore cluster (storage pod), thin
+provisioning (uncommitted and provisioned bytes), the hosts that mount it
+with their access and maintenance mode, and the SPBM storage policies it is
+compatible with, from `govc storage.policy.info -s`. With --cluster,
+describe-datastore lists every host of that cluster, including those that
+do not mount the datastore.
+
+Network rows carry the VLAN (vlanType vlan, trunk with ranges such as
+"100-199,300", or pvlan), the distributed switch that owns a port group and
+its uplink names, whether the network is NSX-backed (an opaque network, or a
+port group with NSX backing), and the hosts it is available on. Standard
+port groups are configured per host, so their VLAN is read from each host's
+port group list and can differ between hosts. describe-network --cluster
+lists every host of that cluster, including those without the network.
+
+Tags come from the vAPI tagging service through govc tags.category.ls,
+tags.ls, and tags.attached.ls, not from the property collector. dump --tags
+adds the tags attached to each datacenter and cluster, as {category, name},
+for failure domain planning with the openshift-region and openshift-zone
+categories; that is one call per datacenter and cluster. A failed lookup
+leaves "tags" null and is recorded under "errors". The script only reads
+tags; creating and attaching them stays with govc tags.category.create,
+tags.create, and tags.attach, as /openshift:generate-install-config prints.
+
+govc does not expose the property collector's paging (RetrievePropertiesEx
+with maxObjects), so each type below a root arrives in one response. Split
+large inventories with --datacenter. A response with more than --max-objects
+objects (default 50000) is cut to that many, sorted by reference, with a
+warning on stderr and an entry under "errors", so that one huge type cannot
+exhaust memory in later processing; raise the limit or narrow the root.
+
+The vCenters and their credentials come from the first of:
+
+  1. --config FILE, a JSON or YAML file (below)
+  2. --credentials-file FILE, the INI format of the vSphere cloud provider
+     config: user, password, and insecure-flag in [Global], overridden per
+     server in [VirtualCenter "<server>"] sections
+  3. --from-cluster, the kube-system/vsphere-creds secret of the cluster of
+     the current or --context kubeconfig context ("<server>.username" and
+     "<server>.password"), with insecure-flag from the
+     openshift-config/cloud-provider-config ConfigMap, read with oc
+  4. the file in the VSPHERE_CONFIG environment variable
+  5. GOVC_URL, GOVC_USERNAME, GOVC_PASSWORD, and GOVC_INSECURE from the
+     environment
+
+--config, --credentials-file, and --from-cluster exclude each other. The
+config file lists vCenters with their own credentials:
+
+  vcenters:
+  - server: vcenter1.example.com
+    username: administrator@vsphere.local
+    passwordEnv: VCENTER1_PASSWORD   # or password: ..., kept out of argv
+    insecure: false
+
+Each server's credentials are passed to govc in its environment, never on
+the command line. dump collects every listed vCenter at once, each with its
+own --parallel pool, and writes {"collected", "seconds", "vcenters":
+{server: <dump document>}}; a vCenter that cannot be reached has only
+"errors". The other commands read one vCenter: the only one listed, or the
+one --vcenter names. The same holds for several servers in a credentials
+file or cluster secret. YAML needs PyYAML; JSON is read without it.
+
+govc keeps its login session in ~/.govmomi/sessions (GOVC_PERSIST_SESSION,
+on by default), reuses it while vCenter accepts it, and logs in again when
+it has expired, so a series of calls logs in once per vCenter and user.
+logout ends the session and deletes the cached one, for every vCenter of
+the config unless --vcenter names one. --no-session-cache sets
+GOVC_PERSIST_SESSION=false, so that each govc call logs in and out and no
+session is stored, for shared machines; it is slower.
+
+--progress writes one JSON object per finished call to stderr:
+{"type": "progress", "phase": "collect", "done", "total", "percent",
+"etaSeconds", "item"}, where item is the object type and root path.
+
+A call that fails, exceeds --timeout, or hits --max-objects is recorded
+under "errors" and the other types are still returned.
+
+Exit codes:
+  0 - Every type was collected
+  1 - govc is missing, the login or logout failed, invalid arguments or
+      config, or the datastore, network, tag category, or object was not
+      found or is ambiguous
+  2 - At least one type could not be collected or was cut at --max-objects
+      (partial result)
+
+Requirements: Python 3.6+, govc
+"""
+
+import argparse
+import base64
+import concurrent.futures
+import configparser
+import datetime
+import fnmatch
+import json
+import os
+import subprocess
+import sys
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+from ai_helpers_events import progress
+
+try:
+    import yaml  # type: ignore
+except ImportError:
+    yaml = None
+
+# govc type code -> (result key, properties)
+TYPES = {
+    'd': ('datacenters', ['name', 'parent']),
+    'f': ('folders', ['name', 'parent', 'childType']),
+    'r': ('computeResources', ['name', 'parent', 'summary.numHosts', 'summary.numEffectiveHosts',
+                               'summary.totalCpu', 'summary.totalMemory', 'datastore', 'network']),
+    'h': ('hosts', ['name', 'parent', 'runtime.connectionState', 'runtime.inMaintenanceMode',
+                    'summary.config.product.version', 'summary.hardware.numCpuCores',
+                    'summary.hardware.memorySize', 'datastore', 'network', 'config.network.portgroup']),
+    's': ('datastores', ['name', 'parent', 'summary.type', 'summary.capacity', 'summary.freeSpace',
+                         'summary.accessible', 'summary.uncommitted', 'summary.maintenanceMode', 'host']),
+    'n': ('networks', ['name', 'parent', 'host']),
+    # subtypes of networks, collected for the properties only they have, and the switches that own port groups
+    'g': ('portgroups', ['config.distributedVirtualSwitch', 'config.defaultPortConfig', 'config.uplink',
+                         'config.backingType']),
+    'o': ('opaqueNetworks', ['summary.opaqueNetworkType', 'summary.opaqueNetworkId']),
+    'w': ('switches', ['name', 'parent', 'config.uplinkPortPolicy']),
+    'p': ('resourcePools', ['name', 'parent']),
+    'm': ('vms', ['name', 'parent', 'resourcePool', 'runtime.host', 'config.template', 'runtime.powerState',
+                  'summary.config.guestFullName', 'summary.config.numCpu', 'summary.config.memorySizeMB',
+                  'summary.storage.committed', 'datastore', 'network']),
+}
+DEFAULT_MAX_OBJECTS = 50000
+GLOBAL_TYPES = ('d', 'f')  # always collected from the root folder, to resolve paths
+COMPUTE_RESOURCES = ('ClusterComputeResource:', 'ComputeResource:')
+# Folder childType -> the part of the inventory it holds
+FOLDER_KINDS = [('Datacenter', 'datacenter'), ('VirtualMachine', 'vm'), ('ComputeResource', 'host'),
+                ('Datastore', 'datastore'), ('Network', 'network')]
+
+GIB = 1 << 30
+# Keys of datastore rows shown only with --detailed
+DATASTORE_DETAILS = ('maintenanceMode', 'datastoreCluster', 'uncommittedBytes', 'provisionedBytes', 'hosts',
+                     'storagePolicies')
+NETWORK_KINDS = {'Network': 'standard', 'DistributedVirtualPortgroup': 'distributed', 'OpaqueNetwork': 'opaque'}
+
+
+def gib(value: Any) -> Optional[int]:
+    return None if value is None else int(value // GIB)
+
+
+def vlan_text(row: Dict[str, Any]) -> str:
+    if not row['vlan']:
+        return '-'
+    return {'trunk': 'trunk ', 'pvlan': 'pvlan '}.get(row['vlanType'], '') + row['vlan']
+
+
+# Command -> (document key, what it lists, types to collect,
+#             text columns as (header, width, row key or function of the row))
+LISTS = {
+    'list-vms': ('vms', 'virtual machines', 'dfrhpmsn', [('PATH', 56, 'path'), ('POWER', 11, 'powerState'),
+                                                         ('CPUS', 4, 'cpus'), ('MEMORY MB', 9, 'memoryMB'),
+                                                         ('GUEST OS', 0, 'guestOS')]),
+    'list-templates': ('vms', 'templates', 'dfrhmsn', [('PATH', 56, 'path'), ('CPUS', 4, 'cpus'),
+                                                       ('MEMORY MB', 9, 'memoryMB'), ('GUEST OS', 0, 'guestOS')]),
+    'list-resource-pools': ('resourcePools', 'resource pools', 'dfrp', [('PATH', 64, 'path'),
+                                                                        ('CLUSTER', 0, 'cluster')]),
+    'list-folders': ('folders', 'folders', 'df', [('PATH', 64, 'path'), ('KIND', 0, 'kind')]),
+    'list-datastores': ('datastores', 'datastores', 'dfrhs', [
+        ('PATH', 48, 'path'), ('TYPE', 6, 'type'), ('CAPACITY GiB', 12, lambda r: gib(r['capacityBytes'])),
+        ('FREE GiB', 0, lambda r: gib(r['freeBytes']))]),
+    'list-networks': ('networks', 'networks', 'dfrhngow', [
+        ('PATH', 48, 'path'), ('TYPE', 11, lambda r: 'uplink' if r['uplinkPortgroup'] else NETWORK_KINDS.get(r['kind'])),
+        ('VLAN', 18, vlan_text), ('NSX', 3, lambda r: 'yes' if r['nsx'] else 'no'),
+        ('SWITCH', 24, 'distributedSwitch'), ('HOSTS', 0, lambda r: len(r['hosts']))]),
+}
+DETAILED_COLUMNS = [
+    ('PATH', 48, 'path'), ('TYPE', 6, 'type'), ('CAPACITY GiB', 12, lambda r: gib(r['capacityBytes'])),
+    ('FREE GiB', 8, lambda r: gib(r['freeBytes'])), ('PROVISIONED GiB', 15, lambda r: gib(r['provisionedBytes'])),
+    ('MAINTENANCE', 11, 'maintenanceMode'),
+    ('HOSTS', 6, lambda r: '{}/{}'.format(sum(1 for h in r['hosts'] if h['accessible']), len(r['hosts']))),
+    ('DATASTORE CLUSTER', 0, lambda r: r['datastoreCluster'] or '-')]
+
+
+def govc(args: List[str], timeout: int, env: Optional[Dict[str, str]] = None) -> Any:
+    """Run govc; env adds the GOVC_* variables of one vCenter to the environment."""
+    cmd = ['govc'] + args
+    try:
+        proc = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True,
+                              timeout=timeout, env=dict(os.environ, **env) if env else None)
+    except FileNotFoundError:
+        raise RuntimeError('govc not found in PATH')
+    except subprocess.TimeoutExpired:
+        raise RuntimeError('{} timed out after {}s'.format(' '.join(cmd[:2]), timeout))
+    if proc.returncode != 0:
+        raise RuntimeError('{} failed: {}'.format(' '.join(cmd[:2]), proc.stderr.strip()))
+    return json.loads(proc.stdout) if proc.stdout.strip() else None
+
+
+def load_config(path: str) -> List[Dict[str, Any]]:
+    """The vCenters listed in a JSON or YAML config file, checked."""
+    with open(path) as f:
+        text = f.read()
+    try:
+        data = json.loads(text)
+    except ValueError:
+        if yaml is None:
+            raise ValueError('{} is not JSON, and reading YAML needs PyYAML'.format(path))
+        try:
+            data = yaml.safe_load(text)
+        except yaml.YAMLError as e:
+            raise ValueError('{}: {}'.format(path, e))
+    vcenters = data.get('vcenters') if isinstance(data, dict) else None
+    if not isinstance(vcenters, list) or not vcenters:
+        raise ValueError('{} lists no vcenters'.format(path))
+    for i, vc in enumerate(vcenters):
+        if not isinstance(vc, dict) or not vc.get('server'):
+            raise ValueError('{}: vcenters[{}] has no server'.format(path, i))
+    servers = [vc['server'] for vc in vcenters]
+    duplicate = next((s for s in servers if servers.count(s) > 1), None)
+    if duplicate:
+        raise ValueError('{} lists {} twice'.format(path, duplicate))
+    return vcenters
+
+
+def flag(value: Any) -> bool:
+    return str(value).strip().strip('"').lower() in ('1', 'true', 'yes')
+
+
+def parse_credentials(text: str, source: str) -> List[Dict[str, Any]]:
+    """The vCenters of a vSphere cloud provider config in INI format."""
+    parser = configparser.ConfigParser(interpolation=None, strict=False)
+    try:
+        parser.read_string(text, source)
+    except configparser.Error as e:
+        raise ValueError('{}: {}'.format(source, e))
+    defaults = dict(parser['Global']) if parser.has_section('Global') else {}
+    vcenters = []
+    for section in parser.sections():
+        kind, _, server = section.partition(' ')
+        if kind != 'VirtualCenter' or not server.strip('"'):
+            continue
+        values = dict(defaults, **dict(parser[section]))
+        vcenters.append({'server': server.strip('"'), 'username': values.get('user', '').strip('"'),
+                         'password': values.get('password', '').strip('"'),
+                         'insecure': flag(values.get('insecure-flag', ''))})
+    if not vcenters:
+        raise ValueError('{} has no [VirtualCenter "<server>"] section'.format(source))
+    return vcenters
+
+
+def load_credentials_file(path: str) -> List[Dict[str, Any]]:
+    with open(path) as f:
+        return parse_credentials(f.read(), path)
+
+
+def oc_get(context: Optional[str], namespace: str, kind: str, name: str, timeout: int) -> Dict[str, Any]:
+    cmd = ['oc'] + (['--context', context] if context else []) + ['-n', namespace, 'get', kind, name, '-o', 'json']
+    try:
+        proc = subprocess.run(cmd, stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+                              universal_newlines=True, timeout=timeout)
+    except FileNotFoundError:
+        raise RuntimeError('oc not found in PATH')
+    except subprocess.TimeoutExpired:
+        raise RuntimeError('oc get {} {} timed out after {}s'.format(kind, name, timeout))
+    if proc.returncode != 0:
+        raise RuntimeError('cannot read {}/{}: {}'.format(namespace, name, proc.stderr.strip()))
+    return json.loads(proc.stdout)
+
+
+def insecure_servers(config: str) -> Dict[str, bool]:
+    """insecure-flag per server from the cloud provider config, INI or YAML; '' is the global value."""
+    try:
+        return {vc['server']: vc['insecure'] for vc in parse_credentials(config, 'cloud-provider-config')}
+    except ValueError:
+        pass
+    data = yaml.safe_load(config) if yaml is not None else None
+    if not isinstance(data, dict):
+        return {}
+    insecure = {'': flag((data.get('global') or {}).get('insecureFlag', False))}
+    for name, vc in (data.get('vcenter') or {}).items():
+        insecure[(vc or {}).get('server') or name] = flag((vc or {}).get('insecureFlag', insecure['']))
+    return insecure
+
+
+def cluster_vcenters(context: Optional[str], timeout: int) -> List[Dict[str, Any]]:
+    """The vCenters and credentials of the cluster's vsphere-creds secret."""
+    data = oc_get(context, 'kube-system', 'secret', 'vsphere-creds', timeout).get('data') or {}
+    insecure = {}  # type: Dict[str, bool]
+    try:
+        config = oc_get(context, 'openshift-config', 'configmap', 'cloud-provider-config', timeout)
+        insecure = insecure_servers((config.get('data') or {}).get('config') or '')
+    except (RuntimeError, ValueError) as e:
+        print('Warning: {}; connecting with certificate checks'.format(e), file=sys.stderr)
+    vcenters = []
+    for key in sorted(data):
+        if not key.endswith('.username'):
+            continue
+        server = key[:-len('.username')]
+        vcenters.append({'server': server, 'username': base64.b64decode(data[key]).decode(),
+                         'password': base64.b64decode(data.get(server + '.password', '')).decode(),
+                         'insecure': insecure.get(server, insecure.get('', False))})
+    if not vcenters:
+        raise ValueError('the vsphere-creds secret has no <server>.username key')
+    return vcenters
+
+
+def load_vcenters(args: argparse.Namespace) -> Tuple[Optional[List[Dict[str, Any]]], str]:
+    """The vCenters from the first credential source given, and its name; None for the GOVC_* environment."""
+    if args.config:
+        return load_config(args.config), args.config
+    if args.credentials_file:
+        return load_credentials_file(args.credentials_file), args.credentials_file
+    if args.from_cluster:
+        return cluster_vcenters(args.context, args.timeout), 'the vsphere-creds secret'
+    if os.environ.get('VSPHERE_CONFIG'):
+        return load_config(os.environ['VSPHERE_CONFIG']), os.environ['VSPHERE_CONFIG']
+    return None, 'the environment'
+
+
+def vcenter_env(vc: Dict[str, Any]) -> Dict[str, str]:
+    """The GOVC_* variables for one config entry."""
+    password = vc.get('password')
+    if vc.get('passwordEnv'):
+        password = os.environ.get(vc['passwordEnv'])
+        if password is None:
+            raise ValueError('{}: {} is not set'.format(vc['server'], vc['passwordEnv']))
+    # set every variable, so that none is inherited from the environment of another vCenter
+    return {'GOVC_URL': vc['server'], 'GOVC_USERNAME': vc.get('username') or '',
+            'GOVC_PASSWORD': '' if password is None else str(password),
+            'GOVC_INSECURE': 'true' if vc.get('insecure') else 'false'}
+
+
+def select_vcenter(vcenters: List[Dict[str, Any]], server: Optional[str]) -> Optional[Dict[str, Any]]:
+    """The entry for --vcenter, or the only entry; None when there are several to choose from."""
+    if server:
+        found = [vc for vc in vcenters if server in (vc['server'], vc['server'].split('://')[-1].split('/')[0])]
+        if not found:
+            raise ValueError('no vCenter {} in the credentials; they list {}'.format(
+                server, ', '.join(vc['server'] for vc in vcenters)))
+        return found[0]
+    return vcenters[0] if len(vcenters) == 1 else None
+
+
+def field(obj: Dict[str, Any], name: str) -> Any:
+    """govc's JSON is lower case in current releases and capitalized in older ones."""
+    if name in obj:
+        return obj[name]
+    return obj.get(name[:1].upper() + name[1:])
+
+
+def ref(value: Any) -> Optional[str]:
+    if isinstance(value, dict) and field(value, 'type') and field(value, 'value'):
+        return '{}:{}'.format(field(value, 'type'), field(value, 'value'))
+    return None
+
+
+def items(value: Any) -> List[Any]:
+    """An array property, bare or wrapped in its type name, as {"ManagedObjectReference": [...]}."""
+    if isinstance(value, dict):
+        value = next((v for v in value.values() if isinstance(v, list)), [])
+    return value or []
+
+
+def refs(value: Any) -> List[str]:
+    return [r for r in (ref(v) for v in items(value)) if r]
+
+
+def collect(code: str, root: str, timeout: int, env: Optional[Dict[str, str]] = None) -> Dict[str, Dict[str, Any]]:
+    """Collect one type below root; returns reference -> {property: value}."""
+    data = govc(['object.collect', '-json', '-type', code, root] + TYPES[code][1], timeout, env) or []
+    if isinstance(data, dict):
+        data = field(data, 'objects') or field(data, 'returnval') or []
+    objects = {}
+    for content in data:
+        key = ref(field(content, 'obj'))
+        if key:
+            objects[key] = {field(p, 'name'): field(p, 'val') for p in field(content, 'propSet') or []}
+    return objects
+
+
+class Inventory:
+    def __init__(self, objects: Dict[str, Dict[str, Any]]):
+        self.objects = objects
+        self._paths = {}  # type: Dict[str, str]
+
+    def path(self, key: Optional[str]) -> Optional[str]:
+        """Inventory path of an object; the root folder is not collected, so the walk stops there."""
+        if not key or key not in self.objects:
+            return None
+        if key not in self._paths:
+            parent = self.path(ref(self.objects[key].get('parent')))
+            self._paths[key] = '{}/{}'.format(parent or '', self.objects[key].get('name', key))
+        return self._paths[key]
+
+    def name(self, key: Optional[str]) -> Optional[str]:
+        return self.objects.get(key, {}).get('name') if key else None
+
+    def compute_resource(self, key: Optional[str]) -> Optional[str]:
+        """The cluster (or standalone host's compute resource) above a host or resource pool."""
+        while key and key in self.objects:
+            if key.startswith(COMPUTE_RESOURCES):
+                return key
+            key = ref(self.objects[key].get('parent'))
+        return None
+
+    def rows(self, keys: List[str], build) -> List[Dict[str, Any]]:
+        return sorted((dict(path=self.path(k), **build(self.objects[k], k)) for k in keys),
+                      key=lambda r: r['path'] or '')
+
+
+def build_document(results: Dict[str, Dict[str, Dict[str, Any]]]) -> Dict[str, Any]:
+    objects = {}
+    by_type = {}  # type: Dict[str, List[str]]
+    for code, found in results.items():
+        for key, props in found.items():
+            objects.setdefault(key, {}).update(props)
+        by_type.setdefault(code, []).extend(found)
+    inv = Inventory(objects)
+    dc_names = {inv.name(k) for k in by_type.get('d', [])}
+
+    def datacenter(_obj, key):
+        return {'datacenter': next((p for p in (inv.path(key) or '').split('/') if p in dc_names), None)}
+
+    doc = {
+        'datacenters': inv.rows(by_type.get('d', []), lambda o, k: {'name': o.get('name')}),
+        'clusters': inv.rows(by_type.get('r', []), lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), cluster=k.startswith('ClusterComputeResource:'),
+            hosts=o.get('summary.numHosts'), effectiveHosts=o.get('summary.numEffectiveHosts'),
+            cpuMhz=o.get('summary.totalCpu'), memoryBytes=o.get('summary.totalMemory'),
+            datastores=sorted(filter(None, (inv.path(r) for r in refs(o.get('datastore'))))),
+            networks=sorted(filter(None, (inv.name(r) for r in refs(o.get('network'))))))),
+        'hosts': inv.rows(by_type.get('h', []), lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), cluster=inv.path(inv.compute_resource(k)),
+            connectionState=o.get('runtime.connectionState'),
+            maintenanceMode=o.get('runtime.inMaintenanceMode'), esxiVersion=o.get('summary.config.product.version'),
+            cpuCores=o.get('summary.hardware.numCpuCores'), memoryBytes=o.get('summary.hardware.memorySize'),
+            datastores=sorted(filter(None, (inv.path(r) for r in refs(o.get('datastore'))))),
+            networks=sorted(filter(None, (inv.name(r) for r in refs(o.get('network'))))))),
+        'datastores': inv.rows(by_type.get('s', []), lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), type=o.get('summary.type'),
+            capacityBytes=o.get('summary.capacity'), freeBytes=o.get('summary.freeSpace'),
+            accessible=o.get('summary.accessible'), **datastore_details(inv, o))),
+        'networks': inv.rows(by_type.get('n', []), lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), kind=k.split(':')[0], **network_details(inv, k, o))),
+        'resourcePools': inv.rows(by_type.get('p', []), lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), cluster=inv.path(inv.compute_resource(k)))),
+        'folders': inv.rows(by_type.get('f', []), lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), kind=folder_kind(o.get('childType')))),
+    }
+    if 'm' in results:
+        # Templates have no resource pool, but are registered on a host
+        doc['vms'] = inv.rows(by_type['m'], lambda o, k: dict(
+            datacenter(o, k), name=o.get('name'), template=bool(o.get('config.template')),
+            powerState=o.get('runtime.powerState'), guestOS=o.get('summary.config.guestFullName'),
+            host=inv.name(ref(o.get('runtime.host'))),
+            cluster=inv.path(inv.compute_resource(ref(o.get('runtime.host')) or ref(o.get('resourcePool')))),
+            resourcePool=inv.path(ref(o.get('resourcePool'))), cpus=o.get('summary.config.numCpu'),
+            memoryMB=o.get('summary.config.memorySizeMB'), committedBytes=o.get('summary.storage.committed'),
+            datastores=sorted(filter(None, (inv.path(r) for r in refs(o.get('datastore'))))),
+            networks=sorted(filter(None, (inv.name(r) for r in refs(o.get('network')))))))
+    return doc
+
+
+def datastore_details(inv: Inventory, o: Dict[str, Any]) -> Dict[str, Any]:
+    capacity, free, uncommitted = o.get('summary.capacity'), o.get('summary.freeSpace'), o.get('summary.uncommitted')
+    parent = ref(o.get('parent'))
+    hosts = []
+    for mount in items(o.get('host')):
+        key = ref(field(mount, 'key'))
+        info = field(mount, 'mountInfo') or {}
+        hosts.append({'name': inv.name(key) or key, 'cluster': inv.path(inv.compute_resource(key)),
+                      'mounted': field(info, 'mounted') is not False, 'accessible': bool(field(info, 'accessible')),
+                      'maintenanceMode': inv.objects.get(key, {}).get('runtime.inMaintenanceMode')})
+    return {
+        'maintenanceMode': o.get('summary.maintenanceMode'),
+        'datastoreCluster': inv.path(parent) if parent and parent.startswith('StoragePod:') else None,
+        'uncommittedBytes': uncommitted,
+        # what thin-provisioned disks would use if they were filled: used space plus the uncommitted rest
+        'provisionedBytes': capacity - free + (uncommitted or 0) if capacity is not None and free is not None else None,
+        'hosts': sorted(hosts, key=lambda h: h['name']),
+    }
+
+
+def vlan_spec(spec: Any) -> Tuple[Optional[str], Optional[str]]:
+    """(vlanType, vlan) of a port group's VLAN setting: vlan, trunk ranges such as "100-199,300", or pvlan."""
+    if not isinstance(spec, dict):
+        return None, None
+    if field(spec, 'pvlanId') is not None:
+        return 'pvlan', str(field(spec, 'pvlanId'))
+    vlan_id = field(spec, 'vlanId')
+    if isinstance(vlan_id, (list, dict)):
+        ranges = [(field(r, 'start'), field(r, 'end')) for r in items(vlan_id)]
+        return 'trunk', ','.join(str(a) if a == b else '{}-{}'.format(a, b) for a, b in ranges)
+    if vlan_id == 4095:  # standard port groups pass all VLANs to the guest with 4095
+        return 'trunk', '0-4094'
+    return ('vlan', str(vlan_id)) if vlan_id is not None else (None, None)
+
+
+def network_details(inv: Inventory, key: str, o: Dict[str, Any]) -> Dict[str, Any]:
+    kind = key.split(':')[0]
+    hosts = []
+    vlans = set()
+    for host_key in refs(o.get('host')):
+        host = inv.objects.get(host_key, {})
+        entry = {'name': inv.name(host_key) or host_key, 'cluster': inv.path(inv.compute_resource(host_key)),
+                 'available': True, 'maintenanceMode': host.get('runtime.inMaintenanceMode')}
+        if kind == 'Network':
+            # a standard port group is configured per host, so the VLAN can differ between hosts
+            spec = next((field(pg, 'spec') for pg in items(host.get('config.network.portgroup'))
+                         if field(field(pg, 'spec') or {}, 'name') == o.get('name')), None) or {}
+            entry.update(vlanId=field(spec, 'vlanId'), vswitch=field(spec, 'vswitchName'))
+            if entry['vlanId'] is not None:
+                vlans.add(entry['vlanId'])
+        hosts.append(entry)
+
+    if kind == 'Network':
+        types = [vlan_spec({'vlanId': v}) for v in sorted(vlans)]
+        vlan_type = types[0][0] if len(types) == 1 else 'vlan' if types else None
+        vlan = ','.join(v for _, v in types) or None
+    else:
+        vlan_type, vlan = vlan_spec(field(o.get('config.defaultPortConfig') or {}, 'vlan'))
+    switch = ref(o.get('config.distributedVirtualSwitch'))
+    policy = inv.objects.get(switch, {}).get('config.uplinkPortPolicy') or {}
+    return {
+        'vlanType': vlan_type,
+        'vlan': vlan,
+        'distributedSwitch': inv.path(switch) if switch else None,
+        'uplinks': list(items(field(policy, 'uplinkPortName'))) if switch else [],
+        'uplinkPortgroup': bool(o.get('config.uplink')),
+        'nsx': kind == 'OpaqueNetwork' or o.get('config.backingType') == 'nsx',
+        'opaqueNetworkType': o.get('summary.opaqueNetworkType'),
+        'opaqueNetworkId': o.get('summary.opaqueNetworkId'),
+        'hosts': sorted(hosts, key=lambda h: h['name']),
+    }
+
+
+def matches_cluster(cluster: Optional[str], want: str) -> bool:
+    want = want.rstrip('/')
+    return bool(cluster) and want in (cluster, cluster.rsplit('/', 1)[-1])
+
+
+def storage_policies(timeout: int, env: Optional[Dict[str, str]] = None) -> List[Dict[str, Any]]:
+    """SPBM policies with the names of the datastores compatible with each."""
+    data = govc(['storage.policy.info', '-json', '-s'], timeout, env) or {}
+    policies = []
+    for p in field(data, 'policies') or []:
+        profile = field(p, 'profile') or {}
+        policies.append({'name': field(profile, 'name'), 'id': field(field(profile, 'profileId') or {}, 'uniqueId'),
+                         'description': field(profile, 'description') or None,
+                         'compatibleDatastores': sorted(field(p, 'compatibleDatastores') or [])})
+    return sorted(policies, key=lambda p: p['name'] or '')
+
+
+def add_policies(rows: List[Dict[str, Any]], args: argparse.Namespace, errors: List[Dict[str, Any]]) -> None:
+    """Set storagePolicies on datastore rows; a failed policy lookup leaves it null and is recorded."""
+    try:
+        policies = storage_policies(args.timeout, args.env)
+    except (RuntimeError, ValueError) as e:
+        errors.append({'type': 'storagePolicies', 'root': '/', 'error': str(e)})
+        print('Warning: storage policies: {}'.format(e), file=sys.stderr)
+        policies = None
+    for r in rows:
+        r['storagePolicies'] = None if policies is None else [
+            p['name'] for p in policies if r['name'] in p['compatibleDatastores']]
+
+
+def tag_catalog(timeout: int, env: Optional[Dict[str, str]] = None) -> Tuple[List[Dict[str, Any]], List[Dict[str, Any]]]:
+    """Tag categories, with their number of tags, and tags, with their category name."""
+    categories = [{'id': c.get('id'), 'name': c.get('name'), 'description': c.get('description') or None,
+                   'cardinality': c.get('cardinality'), 'associableTypes': sorted(c.get('associable_types') or [])}
+                  for c in govc(['tags.category.ls', '-json'], timeout, env) or []]
+    names = {c['id']: c['name'] for c in categories}
+    tags = [{'id': t.get('id'), 'name': t.get('name'), 'category': names.get(t.get('category_id'), t.get('category_id')),
+             'description': t.get('description') or None}
+            for t in govc(['tags.ls', '-json'], timeout, env) or []]
+    for c in categories:
+        c['tags'] = sum(1 for t in tags if t['category'] == c['name'])
+    return (sorted(categories, key=lambda c: c['name'] or ''),
+            sorted(tags, key=lambda t: (t['category'] or '', t['name'] or '')))
+
+
+def attached_tags(path: str, tags: List[Dict[str, Any]], timeout: int,
+                  env: Optional[Dict[str, str]] = None) -> List[Dict[str, Any]]:
+    """Tags attached to the object at path, as {category, name}."""
+    by_id = {t['id']: t for t in tags}
+    by_name = {}  # type: Dict[str, Dict[str, Any]]
+    for t in tags:
+        by_name.setdefault(t['name'], t)
+    found = []
+    for item in govc(['tags.attached.ls', '-json', '-r', path], timeout, env) or []:
+        # govc prints tag IDs or names, or tag objects in some releases
+        if isinstance(item, dict):
+            item = item.get('id') or item.get('name')
+        tag = by_id.get(item) or by_name.get(item)
+        found.append({'category': tag['category'] if tag else None, 'name': tag['name'] if tag else item})
+    return sorted(found, key=lambda t: (t['category'] or '', t['name'] or ''))
+
+
+def add_tags(rows: List[Dict[str, Any]], args: argparse.Namespace, errors: List[Dict[str, Any]]) -> None:
+    """Set tags on datacenter and cluster rows; a failed lookup leaves it null and is recorded."""
+    for r in rows:
+        r['tags'] = None
+    try:
+        _, tags = tag_catalog(args.timeout, args.env)
+    except (RuntimeError, ValueError) as e:
+        errors.append({'type': 'tags', 'root': '/', 'error': str(e)})
+        print('Warning: tags: {}'.format(e), file=sys.stderr)
+        return
+    with concurrent.futures.ThreadPoolExecutor(max_workers=args.parallel) as pool:
+        futures = {pool.submit(attached_tags, r['path'], tags, args.timeout, args.env): r for r in rows}
+        for future in concurrent.futures.as_completed(futures):
+            row = futures[future]
+            try:
+                row['tags'] = future.result()
+            except (RuntimeError, ValueError) as e:
+                errors.append({'type': 'tags', 'root': row['path'], 'error': str(e)})
+                print('Warning: tags of {}: {}'.format(row['path'], e), file=sys.stderr)
+
+
+def folder_kind(child_type: Any) -> Optional[str]:
+    types = child_type if isinstance(child_type, list) else (field(child_type or {}, 'string') or [])
+    return next((kind for t, kind in FOLDER_KINDS if t in types), None)
+
+
+def matches_name(name: Optional[str], pattern: Optional[str]) -> bool:
+    return not pattern or fnmatch.fnmatchcase((name or '').lower(), pattern.lower())
+
+
+def select(rows: List[Dict[str, Any]], args: argparse.Namespace) -> List[Dict[str, Any]]:
+    """Apply the list command filters to document rows."""
+    if args.command in ('list-vms', 'list-templates'):
+        rows = [r for r in rows if r['template'] == (args.command == 'list-templates')]
+    if getattr(args, 'cluster', None) and args.command in ('list-datastores', 'list-networks'):
+        rows = [dict(r, hosts=[h for h in r['hosts'] if matches_cluster(h['cluster'], args.cluster)]) for r in rows]
+        rows = [r for r in rows if r['hosts']]
+    elif getattr(args, 'cluster', None):
+        rows = [r for r in rows if matches_cluster(r['cluster'], args.cluster)]
+    if getattr(args, 'folder', None):
+        prefix = '/' + args.folder.strip('/') + '/'
+        rows = [r for r in rows if (r['path'] or '').startswith(prefix)]
+    rows = [r for r in rows if matches_name(r['name'], args.name_pattern)]
+    if getattr(args, 'powered_on', False):
+        rows = [r for r in rows if r['powerState'] == 'poweredOn']
+    return rows
+
+
+def snapshot(codes: str, args: argparse.Namespace, started: float):
+    """Collect the given types; returns the per-type objects and the calls that failed."""
+    roots = ['/' + dc.strip('/') for dc in args.datacenter] or ['/']
+    jobs = [(code, '/') for code in GLOBAL_TYPES]  # type: List[Tuple[str, str]]
+    jobs += [(code, root) for root in roots for code in codes if code not in GLOBAL_TYPES]
+
+    results = {}  # type: Dict[str, Dict[str, Dict[str, Any]]]
+    errors = []
+    with concurrent.futures.ThreadPoolExecutor(max_workers=args.parallel) as pool:
+        futures = {pool.submit(collect, code, root, args.timeout, args.env): (code, root) for code, root in jobs}
+        for done, future in enumerate(concurrent.futures.as_completed(futures), 1):
+            code, root = futures[future]
+            try:
+                found = future.result()
+                if len(found) > args.max_objects:
+                    message = '{} objects, more than --max-objects {}; kept the first {}'.format(
+                        len(found), args.max_objects, args.max_objects)
+                    found = {k: found[k] for k in sorted(found)[:args.max_objects]}
+                    errors.append({'type': TYPES[code][0], 'root': root, 'error': message})
+                    print('Warning: {} in {}: {}'.format(TYPES[code][0], root, message), file=sys.stderr)
+                results.setdefault(code, {}).update(found)
+            except (RuntimeError, ValueError) as e:
+                errors.append({'type': TYPES[code][0], 'root': root, 'error': str(e)})
+                print('Warning: {} in {}: {}'.format(TYPES[code][0], root, e), file=sys.stderr)
+            if args.progress:
+                progress('collect', done, len(jobs), started, '{}{} {}'.format(
+                    args.env['GOVC_URL'] + ' ' if args.env and 'GOVC_URL' in args.env else '', TYPES[code][0], root))
+    return results, errors
+
+
+def now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ')
+
+
+def dump_document(args: argparse.Namespace, about: Dict[str, Any], started: float) -> Dict[str, Any]:
+    results, errors = snapshot(''.join(c for c in TYPES if not (c == 'm' and args.skip_vms)), args, started)
+
+    doc = {'vcenter': {'version': field(about, 'version'), 'build': field(about, 'build'),
+                       'instanceUuid': field(about, 'instanceUuid')},
+           'collected': now(),
+           'seconds': round(time.time() - started, 1), 'datacenterFilter': args.datacenter or None}
+    doc.update(build_document(results))
+    if args.tags:
+        add_tags(doc['datacenters'] + doc['clusters'], args, errors)
+    doc['errors'] = errors
+    return doc
+
+
+def print_dump(doc: Dict[str, Any], args: argparse.Namespace) -> None:
+    roots = ['/' + dc.strip('/') for dc in args.datacenter] or ['/']
+    if 'vcenter' in doc:
+        print('vCenter {} (build {}), collected in {}s\n'.format(
+            doc['vcenter']['version'] or '?', doc['vcenter']['build'] or '?', doc['seconds']))
+        print('{:<24} {:>9} {:>6} {:>11} {:>9} {:>6} {:>8}'.format(
+            'DATACENTER', 'CLUSTERS', 'HOSTS', 'DATASTORES', 'NETWORKS', 'POOLS', 'VMS'))
+        for dc in doc['datacenters']:
+            if args.datacenter and dc['path'] not in roots:
+                continue
+            count = {k: sum(1 for r in doc.get(k, []) if r['datacenter'] == dc['name'])
+                     for k in ('clusters', 'hosts', 'datastores', 'networks', 'resourcePools', 'vms')}
+            print('{:<24} {:>9} {:>6} {:>11} {:>9} {:>6} {:>8}'.format(
+                dc['name'], count['clusters'], count['hosts'], count['datastores'], count['networks'],
+                count['resourcePools'], count['vms'] if 'vms' in doc else '-'))
+        if args.tags:
+            print()
+            print_table([('OBJECT', 40, 'path'), ('TAGS', 0, lambda r: '-' if r['tags'] is None else ', '.join(
+                '{}:{}'.format(t['category'], t['name']) for t in r['tags']) or 'none')],
+                        doc['datacenters'] + doc['clusters'])
+    for e in doc['errors']:
+        print('\nIncomplete: {} in {}: {}'.format(e['type'], e['root'], e['error']))
+
+
+def cmd_dump(args: argparse.Namespace, about: Dict[str, Any], started: float) -> int:
+    doc = dump_document(args, about, started)
+    if args.json:
+        print(json.dumps(doc, indent=2))
+    else:
+        print_dump(doc, args)
+    return 2 if doc['errors'] else 0
+
+
+def dump_vcenter(args: argparse.Namespace, started: float) -> Dict[str, Any]:
+    """One vCenter's dump document; a failed login leaves only the error."""
+    try:
+        about = govc(['about', '-json'], args.timeout, args.env) or {}
+    except (RuntimeError, ValueError) as e:
+        print('Warning: {}: {}'.format(args.env['GOVC_URL'], e), file=sys.stderr)
+        return {'errors': [{'type': 'vcenter', 'root': '/', 'error': str(e)}]}
+    return dump_document(args, field(about, 'about') or {}, started)
+
+
+def cmd_dump_all(args: argparse.Namespace, envs: List[Dict[str, str]], started: float) -> int:
+    """dump every vCenter of the config at once, keyed by server."""
+    docs = {}
+    with concurrent.futures.ThreadPoolExecutor(max_workers=len(envs)) as pool:
+        futures = {pool.submit(dump_vcenter, argparse.Namespace(**dict(vars(args), env=env)), started): env['GOVC_URL']
+                   for env in envs}
+        for future in concurrent.futures.as_completed(futures):
+            docs[futures[future]] = future.result()
+    docs = {env['GOVC_URL']: docs[env['GOVC_URL']] for env in envs}
+    failed = any(doc['errors'] for doc in docs.values())
+    if args.json:
+        print(json.dumps({'collected': now(), 'seconds': round(time.time() - started, 1), 'vcenters': docs},
+                         indent=2))
+    else:
+        for i, (server, doc) in enumerate(docs.items()):
+            print('{}== {}\n'.format('\n' if i else '', server))
+            print_dump(doc, args)
+    return 2 if failed else 0
+
+
+def print_table(columns: List[Tuple[str, int, Any]], rows: List[Dict[str, Any]]) -> None:
+    line = ' '.join('{{:<{}}}'.format(width) if width else '{}' for _, width, _ in columns)
+    print(line.format(*(header for header, _, _ in columns)))
+    for r in rows:
+        values = (col(r) if callable(col) else r[col] for _, _, col in columns)
+        print(line.format(*('-' if v is None else v for v in values)))
+
+
+def cmd_list(args: argparse.Namespace, started: float) -> int:
+    key, what, codes, columns = LISTS[args.command]
+    results, errors = snapshot(codes, args, started)
+    rows = select(build_document(results).get(key, []), args)
+    filters = {k: v for k, v in (('datacenter', args.datacenter or None), ('cluster', getattr(args, 'cluster', None)),
+                                 ('folder', getattr(args, 'folder', None)), ('namePattern', args.name_pattern),
+                                 ('poweredOn', getattr(args, 'powered_on', None) or None)) if v}
+    if args.command == 'list-datastores':
+        if args.detailed:
+            add_policies(rows, args, errors)
+            columns = DETAILED_COLUMNS
+        else:
+            rows = [{k: v for k, v in r.items() if k not in DATASTORE_DETAILS} for r in rows]
+
+    if args.json:
+        print(json.dumps({'collected': now(), 'filters': filters, key: rows, 'errors': errors}, indent=2))
+    else:
+        print_table(columns, rows)
+        print('\n{} {}'.format(len(rows), what))
+        for e in errors:
+            print('Incomplete: {} in {}: {}'.format(e['type'], e['root'], e['error']))
+    return 2 if errors else 0
+
+
+def find_one(rows: List[Dict[str, Any]], want: str, what: str) -> Optional[Dict[str, Any]]:
+    """The row named or at the path want; prints an error and returns None when none or several match."""
+    want = want.rstrip('/')
+    found = [r for r in rows if want in (r['path'], r['name'])]
+    if len(found) != 1:
+        print('Error: {} {} {}{}'.format('no' if not found else 'ambiguous', what, want,
+                                          ': ' + ', '.join(r['path'] for r in found) if found else ''),
+              file=sys.stderr)
+        return None
+    return found[0]
+
+
+def cluster_hosts(doc: Dict[str, Any], row: Dict[str, Any], cluster: str, missing: Dict[str, Any]) -> bool:
+    """Replace row's hosts with every host of the cluster, so that hosts without the object show up too;
+    missing holds the fields of those. False when the cluster has no hosts."""
+    present = {h['name']: h for h in row['hosts']}
+    row['hosts'] = [present.get(h['name'], dict(missing, name=h['name'], cluster=h['cluster'],
+                                                 maintenanceMode=h['maintenanceMode']))
+                    for h in doc['hosts'] if matches_cluster(h['cluster'], cluster)]
+    if not row['hosts']:
+        print('Error: no hosts in cluster {}'.format(cluster), file=sys.stderr)
+    return bool(row['hosts'])
+
+
+def cmd_describe_datastore(args: argparse.Namespace, started: float) -> int:
+    results, errors = snapshot('dfrhs', args, started)
+    doc = build_document(results)
+    row = find_one(doc['datastores'], args.datastore, 'datastore')
+    if row is None:
+        return 1
+    add_policies([row], args, errors)
+    if args.cluster and not cluster_hosts(doc, row, args.cluster, {'mounted': False, 'accessible': False}):
+        return 1
+
+    if args.json:
+        print(json.dumps({'collected': now(), 'cluster': args.cluster, 'datastore': row, 'errors': errors}, indent=2))
+    else:
+        print('{}  ({}, {})'.format(row['path'], row['type'] or '?', 'accessible' if row['accessible'] else 'NOT accessible'))
+        print('  Capacity:          {} GiB, {} GiB free'.format(gib(row['capacityBytes']), gib(row['freeBytes'])))
+        print('  Provisioned:       {} GiB ({} GiB uncommitted by thin disks)'.format(
+            gib(row['provisionedBytes']), gib(row['uncommittedBytes'] or 0)))
+        print('  Maintenance mode:  {}'.format(row['maintenanceMode'] or '-'))
+        print('  Datastore cluster: {}'.format(row['datastoreCluster'] or '-'))
+        print('  Storage policies:  {}'.format('?' if row['storagePolicies'] is None
+                                               else ', '.join(row['storagePolicies']) or '-'))
+        print('  Hosts{}:'.format(' in ' + args.cluster if args.cluster else ''))
+        for h in row['hosts']:
+            state = 'accessible' if h['accessible'] else 'mounted, not accessible' if h['mounted'] else 'not mounted'
+            print('    {:<40} {}{}'.format(h['name'], state, ', in maintenance mode' if h['maintenanceMode'] else ''))
+        for e in errors:
+            print('Incomplete: {} in {}: {}'.format(e['type'], e['root'], e['error']))
+    return 2 if errors else 0
+
+
+def cmd_describe_network(args: argparse.Namespace, started: float) -> int:
+    results, errors = snapshot('dfrhngow', args, started)
+    doc = build_document(results)
+    row = find_one(doc['networks'], args.network, 'network')
+    if row is None:
+        return 1
+    if args.cluster and not cluster_hosts(doc, row, args.cluster, {'available': False}):
+        return 1
+
+    if args.json:
+        print(json.dumps({'collected': now(), 'cluster': args.cluster, 'network': row, 'errors': errors}, indent=2))
+    else:
+        print('{}  ({}{})'.format(row['path'], NETWORK_KINDS.get(row['kind'], row['kind']),
+                                  ', uplink port group' if row['uplinkPortgroup'] else ''))
+        print('  VLAN:               {}'.format(vlan_text(row)))
+        if row['distributedSwitch']:
+            print('  Distributed switch: {} (uplinks: {})'.format(row['distributedSwitch'],
+                                                                  ', '.join(row['uplinks']) or '-'))
+        print('  NSX:                {}'.format('no' if not row['nsx'] else ' '.join(
+            filter(None, ('yes', row['opaqueNetworkType'], row['opaqueNetworkId'])))))
+        print('  Hosts{}:'.format(' in ' + args.cluster if args.cluster else ''))
+        for h in row['hosts']:
+            state = 'available' if h['available'] else 'not available'
+            if h.get('vswitch'):
+                state += ' on {}, VLAN {}'.format(h['vswitch'], h['vlanId'])
+            print('    {:<40} {}{}'.format(h['name'], state, ', in maintenance mode' if h['maintenanceMode'] else ''))
+        for e in errors:
+            print('Incomplete: {} in {}: {}'.format(e['type'], e['root'], e['error']))
+    return 2 if errors else 0
+
+
+def cmd_storage_policies(args: argparse.Namespace) -> int:
+    try:
+        policies = storage_policies(args.timeout, args.env)
+    except (RuntimeError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    policies = [p for p in policies if matches_name(p['name'], args.name_pattern)]
+    if args.json:
+        print(json.dumps({'collected': now(), 'storagePolicies': policies}, indent=2))
+    else:
+        print_table([('NAME', 40, 'name'), ('ID', 38, 'id'),
+                     ('DATASTORES', 0, lambda p: ', '.join(p['compatibleDatastores']) or '-')], policies)
+        print('\n{} storage policies'.format(len(policies)))
+    return 0
+
+
+def cmd_tag_categories(args: argparse.Namespace) -> int:
+    try:
+        categories, _ = tag_catalog(args.timeout, args.env)
+    except (RuntimeError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    categories = [c for c in categories if matches_name(c['name'], args.name_pattern)]
+    if args.json:
+        print(json.dumps({'collected': now(), 'tagCategories': categories}, indent=2))
+    else:
+        print_table([('NAME', 32, 'name'), ('CARDINALITY', 11, 'cardinality'), ('TAGS', 4, 'tags'),
+                     ('OBJECT TYPES', 0, lambda c: ', '.join(c['associableTypes']) or 'any')], categories)
+        print('\n{} tag categories'.format(len(categories)))
+    return 0
+
+
+def cmd_tags(args: argparse.Namespace) -> int:
+    try:
+        categories, tags = tag_catalog(args.timeout, args.env)
+    except (RuntimeError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    if args.category and args.category not in (c['name'] for c in categories):
+        print('Error: no tag category {}'.format(args.category), file=sys.stderr)
+        return 1
+    tags = [t for t in tags if (not args.category or t['category'] == args.category)
+            and matches_name(t['name'], args.name_pattern)]
+    if args.json:
+        print(json.dumps({'collected': now(), 'tags': tags}, indent=2))
+    else:
+        print_table([('CATEGORY', 24, 'category'), ('NAME', 32, 'name'), ('DESCRIPTION', 0, 'description')], tags)
+        print('\n{} tags'.format(len(tags)))
+    return 0
+
+
+def cmd_attached_tags(args: argparse.Namespace) -> int:
+    try:
+        _, tags = tag_catalog(args.timeout, args.env)
+        attached = attached_tags(args.object, tags, args.timeout, args.env)
+    except (RuntimeError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    if args.json:
+        print(json.dumps({'collected': now(), 'object': args.object, 'tags': attached}, indent=2))
+    else:
+        print_table([('CATEGORY', 24, 'category'), ('TAG', 0, 'name')], attached)
+        print('\n{} tags attached to {}'.format(len(attached), args.object))
+    return 0
+
+
+def cmd_logout(args: argparse.Namespace, envs: List[Optional[Dict[str, str]]]) -> int:
+    failed = False
+    for env in envs:
+        server = (env or {}).get('GOVC_URL') or os.environ.get('GOVC_URL') or 'vCenter'
+        try:
+            govc(['session.logout'], args.timeout, env)
+            print('Logged out of {}'.format(server))
+        except RuntimeError as e:
+            print('Error: {}: {}'.format(server, e), file=sys.stderr)
+            failed = True
+    return 1 if failed else 0
+
+
+def main() -> int:
+    connection = argparse.ArgumentParser(add_help=False)
+    sources = connection.add_argument_group(
+        'vCenter credentials', 'taken from --config, --credentials-file, or --from-cluster, one of them at most; '
+        'else from the file in $VSPHERE_CONFIG; else from GOVC_URL, GOVC_USERNAME, GOVC_PASSWORD, and GOVC_INSECURE')
+    sources.add_argument('--config', metavar='FILE', help='JSON or YAML file listing vCenters and their credentials')
+    sources.add_argument('--credentials-file', metavar='FILE',
+                         help='vSphere cloud provider config in INI format, with user and password')
+    sources.add_argument('--from-cluster', action='store_true',
+                         help='the kube-system/vsphere-creds secret of the cluster, read with oc')
+    sources.add_argument('--context', help='kubeconfig context for --from-cluster')
+    sources.add_argument('--vcenter', metavar='SERVER', help='the vCenter to use when there are several')
+    sources.add_argument('--no-session-cache', action='store_true',
+                            help='log in and out for each govc call instead of reusing the cached session')
+    common = argparse.ArgumentParser(add_help=False, parents=[connection])
+    common.add_argument('--datacenter', action='append', default=[], help='limit to a datacenter (repeatable)')
+    common.add_argument('--parallel', type=int, default=4, help='govc calls at once (default 4)')
+    common.add_argument('--timeout', type=int, default=300, help='seconds per govc call (default 300)')
+    common.add_argument('--max-objects', type=int, default=DEFAULT_MAX_OBJECTS,
+                        help='objects kept per type and root (default {})'.format(DEFAULT_MAX_OBJECTS))
+    common.add_argument('--progress', action='store_true', help='print NDJSON progress events on stderr')
+    common.add_argument('--json', action='store_true')
+    # for the commands that make one or two govc calls outside the property collector
+    single = argparse.ArgumentParser(add_help=False, parents=[connection])
+    single.add_argument('--timeout', type=int, default=300, help='seconds per govc call (default 300)')
+    single.add_argument('--json', action='store_true')
+    parser = argparse.ArgumentParser(description='Snapshot or list the vCenter inventory')
+    sub = parser.add_subparsers(dest='command')
+
+    p = sub.add_parser('dump', help='snapshot the inventory into one JSON document', parents=[common])
+    p.add_argument('--skip-vms', action='store_true', help='do not collect virtual machines and templates')
+    p.add_argument('--tags', action='store_true', help='add the tags attached to datacenters and clusters')
+    for name, (_, what, _, _) in LISTS.items():
+        p = sub.add_parser(name, help='list ' + what, parents=[common])
+        if name in ('list-vms', 'list-templates', 'list-resource-pools', 'list-datastores', 'list-networks'):
+            p.add_argument('--cluster', help='cluster name or inventory path')
+        if name in ('list-vms', 'list-templates', 'list-folders'):
+            p.add_argument('--folder', help='only below this inventory path, e.g. /DC1/vm/ocp')
+        p.add_argument('--name-pattern', help='case-insensitive glob on the name, e.g. "rhcos-*"')
+        if name == 'list-vms':
+            p.add_argument('--powered-on', action='store_true', help='only powered-on VMs')
+        if name == 'list-datastores':
+            p.add_argument('--detailed', action='store_true',
+                           help='add hosts, maintenance mode, datastore cluster, provisioning, and storage policies')
+    p = sub.add_parser('describe-datastore', help='one datastore in detail', parents=[common])
+    p.add_argument('datastore', help='datastore name or inventory path')
+    p.add_argument('--cluster', help='list every host of this cluster and whether it can access the datastore')
+    p = sub.add_parser('describe-network', help='one network in detail', parents=[common])
+    p.add_argument('network', help='network name or inventory path')
+    p.add_argument('--cluster', help='list every host of this cluster and whether the network is available on it')
+    p = sub.add_parser('list-storage-policies', help='list SPBM storage policies and their compatible datastores',
+                       parents=[single])
+    p.add_argument('--name-pattern', help='case-insensitive glob on the name')
+    p = sub.add_parser('list-tag-categories', help='list tag categories', parents=[single])
+    p.add_argument('--name-pattern', help='case-insensitive glob on the name')
+    p = sub.add_parser('list-tags', help='list tags', parents=[single])
+    p.add_argument('--category', help='only tags in this category')
+    p.add_argument('--name-pattern', help='case-insensitive glob on the name')
+    p = sub.add_parser('list-attached-tags', help='list the tags attached to one object', parents=[single])
+    p.add_argument('--object', required=True, metavar='PATH', help='inventory path, e.g. /DC1/host/Cluster1')
+    p = sub.add_parser('logout', help="end govc's cached vCenter session", parents=[connection])
+    p.add_argument('--timeout', type=int, default=300, help='seconds for the govc call (default 300)')
+
+    args = parser.parse_args()
+    if args.command is None:
+        parser.print_help(sys.stderr)
+        return 1
+    envs = [None]  # type: List[Optional[Dict[str, str]]]
+    try:
+        if sum(1 for given in (args.config, args.credentials_file, args.from_cluster) if given) > 1:
+            raise ValueError('--config, --credentials-file, and --from-cluster exclude each other')
+        if args.context and not args.from_cluster:
+            raise ValueError('--context needs --from-cluster')
+        vcenters, source = load_vcenters(args)
+        if vcenters:
+            vc = select_vcenter(vcenters, args.vcenter)
+            if vc is None and args.command not in ('dump', 'logout'):
+                raise ValueError('{} lists {} vCenters; choose one with --vcenter'.format(source, len(vcenters)))
+            envs = [vcenter_env(v) for v in ([vc] if vc else vcenters)]
+        elif args.vcenter:
+            raise ValueError('--vcenter needs --config, --credentials-file, --from-cluster, or VSPHERE_CONFIG')
+    except (OSError, RuntimeError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    if args.no_session_cache:
+        envs = [dict(env or {}, GOVC_PERSIST_SESSION='false') for env in envs]
+    if args.command == 'logout':
+        return cmd_logout(args, envs)
+    args.env = envs[0]
+    single_commands = {'list-storage-policies': cmd_storage_policies, 'list-tag-categories': cmd_tag_categories,
+                       'list-tags': cmd_tags, 'list-attached-tags': cmd_attached_tags}
+    if args.command in single_commands:
+        return single_commands[args.command](args)
+    if args.parallel < 1 or args.timeout < 1 or args.max_objects < 1:
+        print('Error: --parallel, --timeout, and --max-objects must be positive', file=sys.stderr)
+        return 1
+
+    started = time.time()
+    if len(envs) > 1:
+        return cmd_dump_all(args, envs, started)
+    try:
+        about = govc(['about', '-json'], args.timeout, args.env) or {}
+    except (RuntimeError, ValueError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+    if args.command == 'dump':
+        return cmd_dump(args, field(about, 'about') or {}, started)
+    if args.command == 'describe-datastore':
+        return cmd_describe_datastore(args, started)
+    if args.command == 'describe-network':
+        return cmd_describe_network(args, started)
+    return cmd_list(args, started)
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1 @@
+../../../../../lib/ai_helpers_steps.py
\ No newline at end of file
@@ -0,0 +1,425 @@
+#!/usr/bin/env python3
+"""
+report.py - Run the sections of a configured report and render them as one
+Markdown, HTML, or Slack document
+
+Usage:
+  report.py init NAME [--store DIR] [--force]
+  report.py list [--store DIR]
+  report.py validate NAME [--store DIR]
+  report.py run NAME --workdir DIR [--store DIR]
+  report.py render --workdir DIR [--format md,html,slack] [-o DIR]
+                   [--notify-webhook URL] [--notify-format json|slack]
+  report.py schedule NAME --cron EXPR [--repo DIR] [--store DIR]
+
+A report config lists sections. A "shell" section is a shell command that run
+executes itself; a "command" section is a slash command that the agent runs
+and whose result it writes to the section's file. run executes the shell
+sections, writes the config into the work directory, and prints the command
+sections that are still pending as JSON.
+
+Each section ends up as sections/NN.md (the content) and sections/NN.json
+({"title", "status", "summary", "exitCode", "durationSeconds"}) in the work
+directory. Status is one of ok, attention, error, skipped.
+
+render reads the work directory and writes report.md, report.html, and
+report.slack.txt as requested, into the config's output directory or -o.
+With --notify-webhook it then POSTs {"command", "report", "status",
+"exitCode", "finished", "result"} with the section statuses and file paths,
+or with --notify-format slack the Slack rendering as an incoming-webhook
+message. URL may be "env:VARIABLE". A failed POST is reported on stderr and
+does not change the exit code.
+
+Configs are stored as JSON in ~/.config/claude-code/reports unless --store is
+given.
+
+Exit codes:
+  0 - Success
+  1 - Invalid arguments, missing config, or unreadable input
+  2 - render: at least one section has status attention or error
+
+Requirements: Python 3.6+
+"""
+
+import argparse
+import datetime
+import html
+import json
+import os
+import re
+import shlex
+import sys
+from typing import Any, Dict, List, Match
+
+from ai_helpers_events import notify
+from ai_helpers_steps import check_name, run_shell, status_icon, store_entries, write_example
+
+DEFAULT_STORE = os.path.expanduser('~/.config/claude-code/reports')
+FORMATS = {'md': 'report.md', 'html': 'report.html', 'slack': 'report.slack.txt'}
+
+EXAMPLE = {
+    'title': 'Lab daily report',
+    'sections': [
+        {'title': 'Cluster health', 'command': '/openshift:cluster-health-check'},
+        {'title': 'Unstable tests', 'command': '/ci:list-unstable-tests 4.20 vsphere'},
+        {'title': 'Datastore capacity', 'shell': 'govc datastore.info', 'timeout': 120},
+    ],
+    'output': {'dir': '~/reports/lab-daily', 'formats': ['md', 'html']},
+}
+
+
+def config_path(store: str, name: str) -> str:
+    return os.path.join(store, check_name(name, 'report') + '.json')
+
+
+def load_config(store: str, name: str) -> Dict[str, Any]:
+    path = config_path(store, name)
+    if not os.path.exists(path):
+        raise RuntimeError('no report {} in {}'.format(name, store))
+    with open(path, encoding='utf-8') as f:
+        config = json.load(f)
+    problems = check_config(config)
+    if problems:
+        raise ValueError('{}: {}'.format(path, '; '.join(problems)))
+    return config
+
+
+def check_config(config: Any) -> List[str]:
+    if not isinstance(config, dict):
+        return ['config must be a JSON object']
+    problems = []
+    if not config.get('title'):
+        problems.append('missing title')
+    sections = config.get('sections')
+    if not isinstance(sections, list) or not sections:
+        problems.append('sections must be a non-empty list')
+        sections = []
+    for i, s in enumerate(sections):
+        where = 'section {}'.format(i + 1)
+        if not isinstance(s, dict) or not s.get('title'):
+            problems.append('{}: missing title'.format(where))
+            continue
+        kinds = [k for k in ('command', 'shell') if k in s]
+        if len(kinds) != 1:
+            problems.append('{}: needs exactly one of command or shell'.format(where))
+        elif 'command' in s and not str(s['command']).startswith('/'):
+            problems.append('{}: command must be a slash command'.format(where))
+        if 'timeout' in s and not isinstance(s['timeout'], int):
+            problems.append('{}: timeout must be an integer'.format(where))
+        if s.get('format', 'text') not in ('text', 'markdown'):
+            problems.append('{}: format must be text or markdown'.format(where))
+    formats = (config.get('output') or {}).get('formats', ['md'])
+    for fmt in formats:
+        if fmt not in FORMATS:
+            problems.append('unknown output format {}'.format(fmt))
+    return problems
+
+
+def section_files(workdir: str, index: int) -> Dict[str, str]:
+    base = os.path.join(workdir, 'sections', '{:02d}'.format(index + 1))
+    return {'content': base + '.md', 'meta': base + '.json'}
+
+
+def write_section(workdir: str, index: int, content: str, meta: Dict[str, Any]) -> None:
+    files = section_files(workdir, index)
+    with open(files['content'], 'w', encoding='utf-8') as f:
+        f.write(content)
+    with open(files['meta'], 'w', encoding='utf-8') as f:
+        json.dump(meta, f, indent=2)
+
+
+def run_section(section: Dict[str, Any]) -> Dict[str, Any]:
+    run = run_shell(section['shell'], section.get('timeout', 300), section.get('okExitCodes', [0]),
+                    merge_stderr=True)
+    output = run['stdout']
+    meta = {'title': section['title'], 'exitCode': run['exitCode'], 'summary': run['summary'],
+            'durationSeconds': run['durationSeconds']}
+    if run['exitCode'] is None:
+        meta['status'] = 'error'
+        # partial Markdown may end inside a table or code block, so always fence it
+        meta['content'] = '_{}; output until then:_\n\n```\n{}\n```\n'.format(
+            meta['summary'].capitalize(), output.rstrip('\n'))
+    else:
+        meta['status'] = 'ok' if run['ok'] else 'attention'
+        if section.get('format') == 'markdown':
+            meta['content'] = output
+        else:
+            meta['content'] = '```\n{}\n```\n'.format(output.rstrip('\n'))
+    return meta
+
+
+def cmd_init(args: argparse.Namespace) -> int:
+    print(write_example(args.store, check_name(args.name, 'report'), '.json',
+                        json.dumps(EXAMPLE, indent=2) + '\n', args.force))
+    return 0
+
+
+def cmd_list(args: argparse.Namespace) -> int:
+    for name, path in store_entries(args.store, ('.json',)):
+        with open(path, encoding='utf-8') as f:
+            config = json.load(f)
+        sections = config.get('sections') or []
+        print('{:<24} {:<36} {} sections'.format(name, config.get('title', '-'), len(sections)))
+    return 0
+
+
+def cmd_validate(args: argparse.Namespace) -> int:
+    config = load_config(args.store, args.name)
+    print('{}: {} sections ok'.format(args.name, len(config['sections'])))
+    return 0
+
+
+def cmd_run(args: argparse.Namespace) -> int:
+    config = load_config(args.store, args.name)
+    os.makedirs(os.path.join(args.workdir, 'sections'), exist_ok=True)
+    with open(os.path.join(args.workdir, 'config.json'), 'w', encoding='utf-8') as f:
+        json.dump(dict(config, name=args.name,
+                       started=datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ')),
+                  f, indent=2)
+
+    pending = []
+    for i, section in enumerate(config['sections']):
+        if 'shell' in section:
+            meta = run_section(section)
+            write_section(args.workdir, i, meta.pop('content'), meta)
+            print('{:02d} {} {}'.format(i + 1, meta['status'], section['title']), file=sys.stderr)
+        else:
+            files = section_files(args.workdir, i)
+            pending.append({'index': i + 1, 'title': section['title'], 'command': section['command'],
+                            'content': files['content'], 'meta': files['meta']})
+    print(json.dumps({'workdir': args.workdir, 'pending': pending}, indent=2))
+    return 0
+
+
+def collect(workdir: str) -> Dict[str, Any]:
+    with open(os.path.join(workdir, 'config.json'), encoding='utf-8') as f:
+        config = json.load(f)
+    sections = []
+    for i, section in enumerate(config['sections']):
+        files = section_files(workdir, i)
+        meta = {'title': section['title'], 'status': 'missing', 'summary': 'not run'}
+        content = ''
+        if os.path.exists(files['meta']):
+            with open(files['meta'], encoding='utf-8') as f:
+                meta.update(json.load(f))
+        if os.path.exists(files['content']):
+            with open(files['content'], encoding='utf-8') as f:
+                content = f.read()
+        meta['content'] = content
+        sections.append(meta)
+    return {'config': config, 'sections': sections}
+
+
+def render_markdown(report: Dict[str, Any]) -> str:
+    config = report['config']
+    lines = ['# {}'.format(config['title']), '',
+             'Generated {}'.format(config.get('started', '')), '',
+             '| Section | Status | Summary |', '|---------|--------|---------|']
+    for s in report['sections']:
+        lines.append('| {} | {} {} | {} |'.format(s['title'], status_icon(s['status']), s['status'],
+                                                 (s.get('summary') or '').replace('|', '\\|')))
+    for s in report['sections']:
+        lines.extend(['', '## {}'.format(s['title']), '', s['content'].rstrip('\n') or '_No output._'])
+    return '\n'.join(lines) + '\n'
+
+
+def link_html(match: Match) -> str:
+    label, url = match.group(1), match.group(2)
+    if re.match(r'[A-Za-z][A-Za-z0-9+.-]*:', url) and not re.match(r'https?://', url, re.IGNORECASE):
+        return label
+    return '<a href="{}">{}</a>'.format(url, label)
+
+
+def inline_html(text: str) -> str:
+    """Escape text and convert inline Markdown; only http(s) and relative links become anchors."""
+    text = html.escape(text)
+    text = re.sub(r'`([^`]+)`', r'<code>\1</code>', text)
+    text = re.sub(r'\*\*([^*]+)\*\*', r'<strong>\1</strong>', text)
+    return re.sub(r'\[([^\]]+)\]\(([^)\s]+)\)', link_html, text)
+
+
+def render_html(markdown: str, title: str) -> str:
+    """Convert the subset of Markdown that reports use: headings, paragraphs, lists, tables, code blocks."""
+    out = []
+    lines = markdown.split('\n')
+    i = 0
+    while i < len(lines):
+        line = lines[i]
+        if line.startswith('```'):
+            block = []
+            i += 1
+            while i < len(lines) and not lines[i].startswith('```'):
+                block.append(lines[i])
+                i += 1
+            out.append('<pre><code>{}</code></pre>'.format(html.escape('\n'.join(block), quote=False)))
+        elif re.match(r'#{1,6} ', line):
+            level = len(line) - len(line.lstrip('#'))
+            out.append('<h{0}>{1}</h{0}>'.format(level, inline_html(line[level + 1:])))
+        elif line.startswith('|'):
+            rows = []
+            while i < len(lines) and lines[i].startswith('|'):
+                if not re.fullmatch(r'\|[\s:|-]+\|', lines[i]):
+                    rows.append([c.strip() for c in re.split(r'(?<!\\)\|', lines[i].strip())[1:-1]])
+                i += 1
+            i -= 1
+            table = ['<table>']
+            for n, row in enumerate(rows):
+                tag = 'th' if n == 0 else 'td'
+                table.append('<tr>{}</tr>'.format(''.join(
+                    '<{0}>{1}</{0}>'.format(tag, inline_html(c.replace('\\|', '|'))) for c in row)))
+            table.append('</table>')
+            out.append('\n'.join(table))
+        elif re.match(r'\s*[-*] ', line):
+            items = []
+            while i < len(lines) and re.match(r'\s*[-*] ', lines[i]):
+                items.append('<li>{}</li>'.format(inline_html(re.sub(r'\s*[-*] ', '', lines[i], count=1))))
+                i += 1
+            i -= 1
+            out.append('<ul>\n{}\n</ul>'.format('\n'.join(items)))
+        elif line.strip():
+            para = []
+            while i < len(lines) and lines[i].strip() and not re.match(r'(#{1,6} |```|\||\s*[-*] )', lines[i]):
+                para.append(lines[i])
+                i += 1
+            i -= 1
+            out.append('<p>{}</p>'.format(inline_html(' '.join(para))))
+        i += 1
+    style = ('body{font-family:sans-serif;max-width:60em;margin:2em auto}'
+             'table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:.3em .6em;text-align:left}'
+             'pre{background:#f4f4f4;padding:.6em;overflow-x:auto}')
+    return ('<!DOCTYPE html>\n<html><head><meta charset="utf-8"><title>{}</title><style>{}</style></head>\n'
+            '<body>\n{}\n</body></html>\n').format(html.escape(title), style, '\n'.join(out))
+
+
+def render_slack(markdown: str) -> str:
+    """Slack mrkdwn has no headings or tables: make headings bold and put tables in code blocks."""
+    out = []
+    in_table = False
+    in_code = False
+    for line in markdown.split('\n'):
+        if line.startswith('```'):
+            in_code = not in_code
+            out.append('```')
+            continue
+        if in_code:
+            out.append(line)
+            continue
+        if line.startswith('|') and not in_table:
+            out.append('```')
+            in_table = True
+        elif not line.startswith('|') and in_table:
+            out.append('```')
+            in_table = False
+        if in_table:
+            if not re.fullmatch(r'\|[\s:|-]+\|', line):
+                out.append(line)
+            continue
+        line = re.sub(r'^#{1,6} (.*)', r'*\1*', line)
+        line = re.sub(r'\*\*([^*]+)\*\*', r'*\1*', line)
+        line = re.sub(r'\[([^\]]+)\]\(([^)\s]+)\)', r'<\2|\1>', line)
+        out.append(line)
+    if in_table:
+        out.append('```')
+    return '\n'.join(out)
+
+
+def cmd_render(args: argparse.Namespace) -> int:
+    report = collect(args.workdir)
+    config = report['config']
+    output = config.get('output') or {}
+    formats = args.format.split(',') if args.format else output.get('formats', ['md'])
+    unknown = [f for f in formats if f not in FORMATS]
+    if unknown:
+        raise ValueError('unknown format: {}'.format(', '.join(unknown)))
+    outdir = os.path.expanduser(args.output or output.get('dir') or args.workdir)
+    os.makedirs(outdir, exist_ok=True)
+
+    markdown = render_markdown(report)
+    rendered = {'md': markdown, 'html': render_html(markdown, config['title']), 'slack': render_slack(markdown)}
+    paths = []
+    for fmt in formats:
+        path = os.path.join(outdir, FORMATS[fmt])
+        with open(path, 'w', encoding='utf-8') as f:
+            f.write(rendered[fmt])
+        print(path)
+        paths.append(path)
+    code = 2 if any(s['status'] in ('attention', 'error') for s in report['sections']) else 0
+
+    if args.notify_webhook:
+        if args.notify_format == 'slack':
+            payload = {'text': rendered['slack']}
+        else:
+            payload = {
+                'command': 'utils:report',
+                'report': config.get('name'),
+                'status': 'ok' if code == 0 else 'attention',
+                'exitCode': code,
+                'finished': datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ'),
+                'result': {'sections': [{k: s.get(k) for k in ('title', 'status', 'summary')}
+                                        for s in report['sections']], 'files': paths},
+            }
+        notify(args.notify_webhook, payload)
+    return code
+
+
+def cron_quote(value: str) -> str:
+    """Shell-quote value for a crontab command, where an unescaped % ends the command."""
+    return shlex.quote(value).replace('%', '\\%')
+
+
+def cmd_schedule(args: argparse.Namespace) -> int:
+    if len(args.cron.split()) != 5:
+        raise ValueError('--cron needs five fields, e.g. "0 7 * * 1-5"')
+    load_config(args.store, args.name)
+    repo = os.path.abspath(args.repo)
+    prompt = '/utils:report {}'.format(args.name)
+    if os.path.abspath(args.store) != DEFAULT_STORE:
+        prompt += ' --store {}'.format(os.path.abspath(args.store))
+    logs = os.path.join(os.path.expanduser('~'), '.cache', 'claude-code-reports')
+    log = os.path.join(logs, args.name + '.log')
+    print('{} mkdir -p {} && cd {} && claude -p {} --allowedTools "Bash Read Write" >> {} 2>&1'.format(
+        args.cron, cron_quote(logs), cron_quote(repo), cron_quote(prompt), cron_quote(log)))
+    return 0
+
+
+def main() -> int:
+    common = argparse.ArgumentParser(add_help=False)
+    common.add_argument('--store', default=DEFAULT_STORE, help='config directory (default {})'.format(DEFAULT_STORE))
+    parser = argparse.ArgumentParser(description='Run configured report sections and render a combined report')
+    sub = parser.add_subparsers(dest='command')
+
+    p = sub.add_parser('init', help='write an example report config', parents=[common])
+    p.add_argument('name')
+    p.add_argument('--force', action='store_true')
+    sub.add_parser('list', help='list report configs', parents=[common])
+    p = sub.add_parser('validate', help='check a report config', parents=[common])
+    p.add_argument('name')
+    p = sub.add_parser('run', help='run the shell sections and list the pending command sections', parents=[common])
+    p.add_argument('name')
+    p.add_argument('--workdir', required=True)
+    p = sub.add_parser('render', help='render the sections of a work directory')
+    p.add_argument('--workdir', required=True)
+    p.add_argument('--format', help='comma-separated: {}'.format(','.join(FORMATS)))
+    p.add_argument('-o', '--output', help='output directory (default: the config\'s output.dir)')
+    p.add_argument('--notify-webhook', metavar='URL', help='POST the result here when done (or env:VARIABLE)')
+    p.add_argument('--notify-format', choices=['json', 'slack'], default='json')
+    p = sub.add_parser('schedule', help='print a crontab line that runs the report', parents=[common])
+    p.add_argument('name')
+    p.add_argument('--cron', required=True)
+    p.add_argument('--repo', default='.', help='directory to run claude in (default: current)')
+
+    args = parser.parse_args()
+    commands = {'init': cmd_init, 'list': cmd_list, 'validate': cmd_validate, 'run': cmd_run,
+                'render': cmd_render, 'schedule': cmd_schedule}
+    if args.command not in commands:
+        parser.print_help(sys.stderr)
+        return 1
+    try:
+        return commands[args.command](args)
+    except (RuntimeError, OSError, ValueError, KeyError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
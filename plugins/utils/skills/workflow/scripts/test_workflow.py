@@ -0,0 +1,70 @@
+#!/usr/bin/env python3
+"""Tests for the workflow runner."""
+
+import json
+import os
+import subprocess
+import sys
+import tempfile
+
+SCRIPT = os.path.join(os.path.dirname(os.path.abspath(__file__)), "workflow.py")
+
+
+def test(name, condition):
+    status = "PASS" if condition else "FAIL"
+    print(f"  {status}: {name}")
+    return condition
+
+
+def run(tmp, workflow, *args):
+    path = os.path.join(tmp, workflow["name"] + ".json")
+    with open(path, "w") as f:
+        json.dump(workflow, f)
+    workdir = os.path.join(tmp, "run-" + workflow["name"])
+    proc = subprocess.run([sys.executable, SCRIPT, "start", path, "--workdir", workdir] + list(args),
+                          stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+    state = None
+    if os.path.exists(os.path.join(workdir, "state.json")):
+        with open(os.path.join(workdir, "state.json")) as f:
+            state = json.load(f)
+    return proc, state, workdir
+
+
+if __name__ == "__main__":
+    results = []
+
+    with tempfile.TemporaryDirectory() as tmp:
+        proc, state, _ = run(tmp, {"name": "passing", "inputs": {"who": {"default": "lab"}}, "steps": [
+            {"id": "first", "shell": "echo '{\"name\": \"'${{ inputs.who }}'\"}'", "json": True,
+             "outputs": {"name": "result.name"}},
+            {"id": "second", "when": "steps.first.outputs.name == 'lab'", "shell": "echo ${{ steps.first.outputs.name }}"},
+            {"id": "third", "when": "steps.first.outputs.name == 'other'", "shell": "echo never"},
+        ]})
+        results.append(test("shell step runs and outputs pass on", proc.returncode == 0
+                            and state["results"]["first"]["outputs"] == {"name": "lab"}
+                            and state["results"]["second"]["status"] == "ok"))
+        results.append(test("false condition skips the step", state["results"]["third"]["status"] == "skipped"))
+
+        proc, state, _ = run(tmp, {"name": "failing", "steps": [
+            {"id": "fail", "shell": "exit 3"},
+            {"id": "after", "shell": "echo not run"},
+        ]})
+        results.append(test("failed step stops the workflow", state["results"]["fail"]["status"] == "error"
+                            and state["stopped"] == "fail" and "after" not in state["results"]))
+
+        proc, state, workdir = run(tmp, {"name": "slow", "steps": [
+            {"id": "slow", "shell": "echo partial; echo progress >&2; sleep 3", "json": True, "timeout": 1},
+            {"id": "after", "shell": "echo not run"},
+        ]})
+        results.append(test("timed-out step does not crash the runner", proc.returncode == 0
+                            and "Traceback" not in proc.stderr))
+        slow = (state or {}).get("results", {}).get("slow", {})
+        results.append(test("timed-out step is recorded as an error", slow.get("status") == "error"
+                            and "timed out" in slow.get("summary", "") and state["stopped"] == "slow"))
+        log = os.path.join(workdir, "steps", "slow.log")
+        results.append(test("partial output of a timed-out step is logged",
+                            os.path.exists(log) and "progress" in open(log).read()))
+
+    passed = sum(results)
+    print(f"\n{passed}/{len(results)} passed")
+    sys.exit(0 if passed == len(results) else 1)
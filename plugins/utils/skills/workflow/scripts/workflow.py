@@ -0,0 +1,538 @@
+#!/usr/bin/env python3
+"""
+workflow.py - Run a YAML-defined sequence of shell and slash-command steps
+with data passed between them
+
+Usage:
+  workflow.py init NAME [--store DIR] [--force]
+  workflow.py list [--store DIR]
+  workflow.py validate NAME|FILE [--store DIR]
+  workflow.py start NAME|FILE --workdir DIR [--set KEY=VALUE]... [--store DIR]
+  workflow.py next --workdir DIR
+  workflow.py record --workdir DIR --step ID --status STATUS [--summary TEXT]
+                     [--exit-code N]
+  workflow.py report --workdir DIR
+
+A workflow has inputs and an ordered list of steps. A "shell" step is a shell
+command that next runs itself; a "command" step is a slash command that the
+agent runs, writing the command's JSON result to steps/ID.json and a short
+Markdown summary to steps/ID.md, before calling record.
+
+Strings in steps may contain ${{ EXPR }}, and a step's "when" is an EXPR.
+EXPR reads inputs.NAME, steps.ID.status, steps.ID.exitCode,
+steps.ID.outputs.NAME, and steps.ID.resultFile, with ==, !=, <, <=, >, >=,
+in, not in, and, or, not, indexing, and string, number, and boolean
+literals. In shell steps, substituted values are shell-quoted. A step's
+"outputs" map names to EXPRs over "result", the step's parsed JSON result.
+
+next runs shell steps and skips steps whose "when" is false until it
+reaches a command step, which it prints as JSON with its rendered command
+and the files to write; it prints {"done": true} when no step is left. A
+step with status error stops the workflow unless it has
+"continueOnError: true".
+
+Workflows are stored in ~/.config/claude-code/workflows as NAME.yaml unless
+--store is given. YAML needs PyYAML; without it, workflows must be JSON.
+
+Exit codes:
+  0 - Success
+  1 - Invalid arguments, invalid workflow, or unreadable state
+  2 - report: at least one step has status attention or error, or the
+      workflow stopped early
+
+Requirements: Python 3.6+; PyYAML for YAML workflows
+"""
+
+import argparse
+import ast
+import datetime
+import json
+import os
+import re
+import shlex
+import sys
+from typing import Any, Dict, List, Optional
+
+try:
+    import yaml
+except ImportError:
+    yaml = None
+
+from ai_helpers_steps import check_name, run_shell, status_icon, store_entries, write_example
+
+DEFAULT_STORE = os.path.expanduser('~/.config/claude-code/workflows')
+STATUSES = ('ok', 'attention', 'error', 'skipped')
+TEMPLATE = re.compile(r'\$\{\{\s*(.+?)\s*\}\}')
+STEP_ID = re.compile(r'[a-z_][a-z0-9_]*')
+
+EXAMPLE = """\
+name: vsphere-install-preflight
+description: Pick a datastore, generate the vSphere install-config section, and check DNS
+inputs:
+  datacenter: {required: true}
+  cluster: {required: true}
+  cluster_name: {required: true}
+  base_domain: {required: true}
+  network: {required: true}
+  min_free_gib: {default: 1024}
+steps:
+  - id: inventory
+    shell: >-
+      ai-helper openshift/vsphere-inventory/vsphere_inventory.py dump
+      --datacenter ${{ inputs.datacenter }} --skip-vms --json
+    json: true
+    timeout: 600
+  - id: pick
+    shell: >-
+      jq --arg c /${{ inputs.datacenter }}/host/${{ inputs.cluster }} --argjson gib ${{ inputs.min_free_gib }}
+      '(.datastores | map({(.path): .}) | add) as $ds | .clusters[] | select(.path == $c)
+      | {datastore: ([.datastores[] | $ds[.] | select(.accessible and .freeBytes >= $gib * 1073741824)]
+      | max_by(.freeBytes) | .path)}' ${{ steps.inventory.resultFile }}
+    json: true
+    outputs:
+      datastore: result.datastore
+  - id: install_config
+    when: steps.pick.outputs.datastore != None
+    command: >-
+      /openshift:generate-install-config --datacenter ${{ inputs.datacenter }} --cluster ${{ inputs.cluster }}
+      --datastore ${{ steps.pick.outputs.datastore }} --network ${{ inputs.network }}
+  - id: dns
+    when: steps.install_config.status == 'ok'
+    shell: >-
+      for name in api api-int test.apps; do
+      host "$name".${{ inputs.cluster_name }}.${{ inputs.base_domain }} || exit 1; done
+    continueOnError: true
+"""
+
+
+class ExprError(ValueError):
+    pass
+
+
+def evaluate(expr: str, context: Dict[str, Any]) -> Any:
+    """Evaluate a workflow expression; only lookups, comparisons, and boolean operators are allowed."""
+    try:
+        tree = ast.parse(expr, mode='eval')
+    except SyntaxError as e:
+        raise ExprError('invalid expression {!r}: {}'.format(expr, e.msg))
+
+    def ev(node):
+        if isinstance(node, ast.Expression):
+            return ev(node.body)
+        if isinstance(node, ast.BoolOp):
+            values = [ev(v) for v in node.values]
+            return all(values) if isinstance(node.op, ast.And) else any(values)
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.Not):
+            return not ev(node.operand)
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.USub):
+            return -ev(node.operand)
+        if isinstance(node, ast.Compare):
+            left = ev(node.left)
+            for op, right_node in zip(node.ops, node.comparators):
+                right = ev(right_node)
+                if not compare(op, left, right):
+                    return False
+                left = right
+            return True
+        if isinstance(node, ast.Name):
+            if node.id in ('None', 'True', 'False'):
+                return {'None': None, 'True': True, 'False': False}[node.id]
+            if node.id not in context:
+                raise ExprError('unknown name {!r} in {!r}'.format(node.id, expr))
+            return context[node.id]
+        if isinstance(node, ast.Attribute):
+            return lookup(ev(node.value), node.attr)
+        if isinstance(node, ast.Subscript):
+            index = node.slice.value if isinstance(node.slice, getattr(ast, 'Index', ())) else node.slice
+            return lookup(ev(node.value), ev(index))
+        if isinstance(node, (ast.List, ast.Tuple)):
+            return [ev(e) for e in node.elts]
+        if isinstance(node, ast.Constant):
+            return node.value
+        if sys.version_info < (3, 8) and isinstance(node, (ast.Str, ast.Num, ast.NameConstant)):
+            return node.s if isinstance(node, ast.Str) else node.n if isinstance(node, ast.Num) else node.value
+        raise ExprError('unsupported syntax in {!r}'.format(expr))
+
+    return ev(tree)
+
+
+def lookup(value: Any, key: Any) -> Any:
+    """Missing keys, indexes past the end, and lookups on None give None, so `when` can test for them."""
+    if isinstance(value, dict):
+        return value.get(key)
+    if isinstance(value, list) and isinstance(key, int):
+        return value[key] if -len(value) <= key < len(value) else None
+    return None
+
+
+def compare(op: ast.cmpop, left: Any, right: Any) -> bool:
+    try:
+        if isinstance(op, ast.Eq):
+            return left == right
+        if isinstance(op, ast.NotEq):
+            return left != right
+        if isinstance(op, ast.In):
+            return left in right
+        if isinstance(op, ast.NotIn):
+            return left not in right
+        if isinstance(op, ast.Lt):
+            return left < right
+        if isinstance(op, ast.LtE):
+            return left <= right
+        if isinstance(op, ast.Gt):
+            return left > right
+        if isinstance(op, ast.GtE):
+            return left >= right
+    except TypeError:
+        return False
+    raise ExprError('unsupported comparison {}'.format(type(op).__name__))
+
+
+def render(text: str, context: Dict[str, Any], quote: bool) -> str:
+    def value(m):
+        v = evaluate(m.group(1), context)
+        s = '' if v is None else json.dumps(v) if isinstance(v, (dict, list, bool)) else str(v)
+        return shlex.quote(s) if quote else s
+    return TEMPLATE.sub(value, text)
+
+
+def workflow_path(store: str, ref: str) -> str:
+    if os.sep in ref or os.path.exists(ref):
+        return ref
+    check_name(ref, 'workflow')
+    for ext in ('.yaml', '.yml', '.json'):
+        if os.path.exists(os.path.join(store, ref + ext)):
+            return os.path.join(store, ref + ext)
+    raise RuntimeError('no workflow {} in {}'.format(ref, store))
+
+
+def parse(text: str, path: str) -> Any:
+    if yaml is not None:
+        try:
+            return yaml.safe_load(text)
+        except yaml.YAMLError as e:
+            raise ValueError('{}: {}'.format(path, e))
+    try:
+        return json.loads(text)
+    except ValueError:
+        raise ValueError('{}: not JSON, and PyYAML is not installed for YAML (pip install pyyaml)'.format(path))
+
+
+def load_workflow(store: str, ref: str) -> Dict[str, Any]:
+    path = workflow_path(store, ref)
+    with open(path, encoding='utf-8') as f:
+        workflow = parse(f.read(), path)
+    problems = check_workflow(workflow)
+    if problems:
+        raise ValueError('{}: {}'.format(path, '; '.join(problems)))
+    return workflow
+
+
+def expressions(text: Any) -> List[str]:
+    return TEMPLATE.findall(text) if isinstance(text, str) else []
+
+
+def check_workflow(workflow: Any) -> List[str]:
+    if not isinstance(workflow, dict):
+        return ['workflow must be a mapping']
+    problems = []
+    if not workflow.get('name'):
+        problems.append('missing name')
+    inputs = workflow.get('inputs') or {}
+    if not isinstance(inputs, dict):
+        problems.append('inputs must be a mapping')
+        inputs = {}
+    steps = workflow.get('steps')
+    if not isinstance(steps, list) or not steps:
+        return problems + ['steps must be a non-empty list']
+    seen = []
+    for i, s in enumerate(steps):
+        where = 'step {}'.format(i + 1)
+        if not isinstance(s, dict) or not STEP_ID.fullmatch(str(s.get('id', ''))):
+            problems.append('{}: id must match {}'.format(where, STEP_ID.pattern))
+            continue
+        where = 'step {}'.format(s['id'])
+        if s['id'] in seen:
+            problems.append('{}: duplicate id'.format(where))
+        kinds = [k for k in ('command', 'shell') if k in s]
+        if len(kinds) != 1:
+            problems.append('{}: needs exactly one of command or shell'.format(where))
+        elif 'command' in s and not str(s['command']).lstrip().startswith('/'):
+            problems.append('{}: command must be a slash command'.format(where))
+        if 'timeout' in s and not isinstance(s['timeout'], int):
+            problems.append('{}: timeout must be an integer'.format(where))
+        if not isinstance(s.get('outputs') or {}, dict):
+            problems.append('{}: outputs must be a mapping'.format(where))
+        exprs = expressions(s.get('command')) + expressions(s.get('shell'))
+        exprs += [s['when']] if s.get('when') else []
+        for expr in exprs:
+            try:
+                tree = ast.parse(expr, mode='eval')
+            except SyntaxError:
+                problems.append('{}: invalid expression {!r}'.format(where, expr))
+                continue
+            for node in ast.walk(tree):
+                # steps.ID must name an earlier step, inputs.NAME a declared input
+                if isinstance(node, ast.Attribute) and isinstance(node.value, ast.Name):
+                    if node.value.id == 'steps' and node.attr not in seen:
+                        problems.append('{}: {!r} refers to step {} before it runs'.format(where, expr, node.attr))
+                    if node.value.id == 'inputs' and node.attr not in inputs:
+                        problems.append('{}: {!r} refers to undeclared input {}'.format(where, expr, node.attr))
+        seen.append(s['id'])
+    return problems
+
+
+def resolve_inputs(workflow: Dict[str, Any], settings: List[str]) -> Dict[str, Any]:
+    given = {}
+    for setting in settings:
+        key, sep, value = setting.partition('=')
+        if not sep:
+            raise ValueError('--set needs KEY=VALUE, got {!r}'.format(setting))
+        given[key] = value
+    declared = workflow.get('inputs') or {}
+    unknown = sorted(set(given) - set(declared))
+    if unknown:
+        raise ValueError('unknown inputs: {}'.format(', '.join(unknown)))
+    inputs = {}
+    for name, spec in declared.items():
+        spec = spec if isinstance(spec, dict) else {'default': spec}
+        if name in given:
+            inputs[name] = given[name]
+        elif 'default' in spec:
+            inputs[name] = spec['default']
+        elif spec.get('required'):
+            raise ValueError('missing required input {} (--set {}=...)'.format(name, name))
+        else:
+            inputs[name] = None
+    return inputs
+
+
+def now() -> str:
+    return datetime.datetime.now(datetime.timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ')
+
+
+def state_path(workdir: str) -> str:
+    return os.path.join(workdir, 'state.json')
+
+
+def load_state(workdir: str) -> Dict[str, Any]:
+    path = state_path(workdir)
+    if not os.path.exists(path):
+        raise RuntimeError('no workflow started in {}'.format(workdir))
+    with open(path, encoding='utf-8') as f:
+        return json.load(f)
+
+
+def save_state(workdir: str, state: Dict[str, Any]) -> None:
+    tmp = state_path(workdir) + '.tmp'
+    with open(tmp, 'w', encoding='utf-8') as f:
+        json.dump(state, f, indent=2)
+    os.replace(tmp, state_path(workdir))
+
+
+def step_files(workdir: str, step_id: str) -> Dict[str, str]:
+    base = os.path.join(workdir, 'steps', step_id)
+    return {'result': base + '.json', 'notes': base + '.md', 'log': base + '.log'}
+
+
+def context(state: Dict[str, Any]) -> Dict[str, Any]:
+    return {'inputs': state['inputs'], 'steps': state['results']}
+
+
+def finish(state: Dict[str, Any], step: Dict[str, Any], status: str, summary: str,
+           exit_code: Optional[int], workdir: str) -> None:
+    """Record a step's result and extract its outputs from the result file."""
+    files = step_files(workdir, step['id'])
+    entry = {'status': status, 'summary': summary, 'exitCode': exit_code, 'outputs': {},
+             'resultFile': files['result'] if os.path.exists(files['result']) else None, 'finished': now()}
+    result = None
+    if entry['resultFile']:
+        try:
+            with open(files['result'], encoding='utf-8') as f:
+                result = json.load(f)
+        except ValueError as e:
+            if step.get('outputs'):
+                entry['summary'] = (summary + '; ' if summary else '') + 'result is not JSON: {}'.format(e)
+    for name, expr in (step.get('outputs') or {}).items():
+        entry['outputs'][name] = evaluate(str(expr), dict(context(state), result=result))
+    state['results'][step['id']] = entry
+    if status == 'error' and not step.get('continueOnError'):
+        state['stopped'] = step['id']
+
+
+def run_step(step: Dict[str, Any], state: Dict[str, Any], workdir: str) -> None:
+    files = step_files(workdir, step['id'])
+    command = render(step['shell'], context(state), quote=True)
+    run = run_shell(command, step.get('timeout', 300), step.get('okExitCodes', [0]))
+    status = 'ok' if run['ok'] else 'error'
+    with open(files['log'], 'w', encoding='utf-8') as f:
+        f.write('$ {}\n{}{}'.format(command, run['stderr'], '' if step.get('json') else run['stdout']))
+    if step.get('json'):
+        with open(files['result'], 'w', encoding='utf-8') as f:
+            f.write(run['stdout'])
+    if os.path.exists(files['notes']):
+        os.remove(files['notes'])
+    finish(state, step, status, run['summary'], run['exitCode'], workdir)
+    state['results'][step['id']]['durationSeconds'] = run['durationSeconds']
+    print('{} {} {}'.format(step['id'], status, run['summary']).rstrip(), file=sys.stderr)
+
+
+def cmd_init(args: argparse.Namespace) -> int:
+    check_name(args.name, 'workflow')
+    if yaml is None:
+        raise RuntimeError('the example is YAML, which needs PyYAML (pip install pyyaml)')
+    print(write_example(args.store, args.name, '.yaml', EXAMPLE, args.force))
+    return 0
+
+
+def cmd_list(args: argparse.Namespace) -> int:
+    for stem, path in store_entries(args.store, ('.yaml', '.yml', '.json')):
+        try:
+            with open(path, encoding='utf-8') as f:
+                workflow = parse(f.read(), path) or {}
+        except ValueError as e:
+            print('Warning: {}'.format(e), file=sys.stderr)
+            continue
+        print('{:<28} {:>3} steps  {}'.format(stem, len(workflow.get('steps') or []), workflow.get('description', '-')))
+    return 0
+
+
+def cmd_validate(args: argparse.Namespace) -> int:
+    workflow = load_workflow(args.store, args.workflow)
+    print('{}: {} steps ok'.format(workflow['name'], len(workflow['steps'])))
+    return 0
+
+
+def cmd_start(args: argparse.Namespace) -> int:
+    workflow = load_workflow(args.store, args.workflow)
+    inputs = resolve_inputs(workflow, args.set)
+    if os.path.exists(state_path(args.workdir)):
+        raise RuntimeError('{} already holds a workflow run'.format(args.workdir))
+    os.makedirs(os.path.join(args.workdir, 'steps'), exist_ok=True)
+    save_state(args.workdir, {'workflow': workflow, 'inputs': inputs, 'results': {}, 'started': now(),
+                              'stopped': None})
+    return cmd_next(args)
+
+
+def cmd_next(args: argparse.Namespace) -> int:
+    state = load_state(args.workdir)
+    for step in state['workflow']['steps']:
+        if step['id'] in state['results']:
+            continue
+        if state.get('stopped'):
+            break
+        if step.get('when') and not evaluate(step['when'], context(state)):
+            finish(state, step, 'skipped', 'condition false: {}'.format(step['when']), None, args.workdir)
+            print('{} skipped'.format(step['id']), file=sys.stderr)
+            continue
+        if 'shell' in step:
+            run_step(step, state, args.workdir)
+            save_state(args.workdir, state)
+            continue
+        files = step_files(args.workdir, step['id'])
+        save_state(args.workdir, state)
+        print(json.dumps({'done': False, 'step': step['id'],
+                          'command': ' '.join(render(step['command'], context(state), quote=False).split()),
+                          'outputs': sorted(step.get('outputs') or {}),
+                          'result': files['result'], 'notes': files['notes']}, indent=2))
+        return 0
+    save_state(args.workdir, state)
+    print(json.dumps({'done': True, 'stopped': state.get('stopped')}, indent=2))
+    return 0
+
+
+def cmd_record(args: argparse.Namespace) -> int:
+    state = load_state(args.workdir)
+    steps = {s['id']: s for s in state['workflow']['steps']}
+    if args.step not in steps or 'command' not in steps[args.step]:
+        raise ValueError('{} is not a command step of this workflow'.format(args.step))
+    if args.step in state['results']:
+        raise RuntimeError('step {} is already recorded'.format(args.step))
+    finish(state, steps[args.step], args.status, args.summary or '', args.exit_code, args.workdir)
+    save_state(args.workdir, state)
+    outputs = state['results'][args.step]['outputs']
+    missing = [k for k, v in outputs.items() if v is None]
+    if missing:
+        print('Warning: {}: outputs without a value: {}'.format(args.step, ', '.join(missing)), file=sys.stderr)
+    return 0
+
+
+def cmd_report(args: argparse.Namespace) -> int:
+    state = load_state(args.workdir)
+    workflow = state['workflow']
+    lines = ['# {}'.format(workflow['name']), '']
+    if workflow.get('description'):
+        lines.extend([workflow['description'], ''])
+    lines.append('Started {}{}'.format(state['started'], ', stopped at step {}'.format(state['stopped'])
+                                       if state.get('stopped') else ''))
+    if state['inputs']:
+        lines.extend(['', 'Inputs: ' + ', '.join('`{}={}`'.format(k, v) for k, v in state['inputs'].items())])
+    lines.extend(['', '| Step | Status | Summary |', '|------|--------|---------|'])
+    for step in workflow['steps']:
+        r = state['results'].get(step['id'], {'status': 'not run', 'summary': ''})
+        lines.append('| {} | {} {} | {} |'.format(step['id'], status_icon(r['status']), r['status'],
+                                                  (r.get('summary') or '').replace('|', '\\|')))
+    for step in workflow['steps']:
+        r = state['results'].get(step['id'])
+        if not r or r['status'] == 'skipped':
+            continue
+        files = step_files(args.workdir, step['id'])
+        lines.extend(['', '## {}'.format(step['id']), ''])
+        if r['outputs']:
+            lines.extend('- {}: `{}`'.format(k, v) for k, v in r['outputs'].items())
+            lines.append('')
+        if os.path.exists(files['notes']):
+            with open(files['notes'], encoding='utf-8') as f:
+                lines.append(f.read().rstrip('\n'))
+        elif os.path.exists(files['log']):
+            lines.append('Log: `{}`'.format(files['log']))
+    path = os.path.join(args.workdir, 'report.md')
+    with open(path, 'w', encoding='utf-8') as f:
+        f.write('\n'.join(lines) + '\n')
+    print(path)
+    failed = any(r['status'] in ('attention', 'error') for r in state['results'].values())
+    return 2 if failed or state.get('stopped') else 0
+
+
+def main() -> int:
+    common = argparse.ArgumentParser(add_help=False)
+    common.add_argument('--store', default=DEFAULT_STORE, help='workflow directory (default {})'.format(DEFAULT_STORE))
+    parser = argparse.ArgumentParser(description='Run a workflow of shell and slash-command steps')
+    sub = parser.add_subparsers(dest='command')
+
+    p = sub.add_parser('init', help='write an example workflow', parents=[common])
+    p.add_argument('name')
+    p.add_argument('--force', action='store_true')
+    sub.add_parser('list', help='list workflows', parents=[common])
+    p = sub.add_parser('validate', help='check a workflow', parents=[common])
+    p.add_argument('workflow', help='name in the store, or a file path')
+    p = sub.add_parser('start', help='start a run and advance to the first command step', parents=[common])
+    p.add_argument('workflow', help='name in the store, or a file path')
+    p.add_argument('--workdir', required=True)
+    p.add_argument('--set', action='append', default=[], metavar='KEY=VALUE', help='input value (repeatable)')
+    p = sub.add_parser('next', help='run shell steps up to the next command step')
+    p.add_argument('--workdir', required=True)
+    p = sub.add_parser('record', help='record the result of a command step')
+    p.add_argument('--workdir', required=True)
+    p.add_argument('--step', required=True)
+    p.add_argument('--status', required=True, choices=STATUSES)
+    p.add_argument('--summary')
+    p.add_argument('--exit-code', type=int)
+    p = sub.add_parser('report', help='write report.md for a run')
+    p.add_argument('--workdir', required=True)
+
+    args = parser.parse_args()
+    commands = {'init': cmd_init, 'list': cmd_list, 'validate': cmd_validate, 'start': cmd_start,
+                'next': cmd_next, 'record': cmd_record, 'report': cmd_report}
+    if args.command not in commands:
+        parser.print_help(sys.stderr)
+        return 1
+    try:
+        return commands[args.command](args)
+    except (RuntimeError, OSError, ValueError, KeyError) as e:
+        print('Error: {}'.format(e), file=sys.stderr)
+        return 1
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -0,0 +1,172 @@
+#!/usr/bin/env python3
+"""
+Check plugins against the features supported by a range of Claude Code versions.
+
+This script collects the features each plugin uses (components, plugin.json
+keys, command/skill/agent frontmatter keys, hook events and handler fields)
+and compares them with scripts/claude_code_features.json. It reports features
+that the oldest target version does not support yet, features that were
+removed before the newest target version, and features the table does not
+know, which Claude Code most likely ignores.
+
+Usage:
+    check_plugin_compat.py [--min VERSION] [--max VERSION] [--plugin NAME]...
+                           [--strict] [--json]
+
+Exit codes:
+    0 - No plugin uses an unsupported feature
+    1 - At least one plugin uses an unsupported or removed feature
+        (or an unknown one, with --strict)
+"""
+
+import argparse
+import json
+import re
+import sys
+from pathlib import Path
+from typing import Dict, List, Optional, Tuple
+
+FRONTMATTER_RE = re.compile(r'\A---\n(.*?)\n---', re.DOTALL)
+KEY_RE = re.compile(r'^([A-Za-z][A-Za-z0-9_-]*):')
+
+
+def parse_version(version: str) -> Tuple[int, ...]:
+    """Parse "2.0.12" into (2, 0, 12)."""
+    if not re.fullmatch(r'\d+(\.\d+)*', version):
+        raise ValueError(f"Invalid version: {version}")
+    return tuple(int(part) for part in version.split('.'))
+
+
+def frontmatter_keys(path: Path) -> List[str]:
+    """Return the top-level frontmatter keys of a markdown file."""
+    match = FRONTMATTER_RE.match(path.read_text(encoding='utf-8'))
+    if not match:
+        return []
+    return [m.group(1) for m in map(KEY_RE.match, match.group(1).splitlines()) if m]
+
+
+def hook_features(hooks: Dict) -> List[str]:
+    """Return hook-event and hook-handler features of a hooks configuration."""
+    features = []
+    for event, matchers in hooks.items():
+        features.append(f"hook-event:{event}")
+        for matcher in matchers or []:
+            for handler in matcher.get('hooks', []):
+                features.extend(f"hook-handler:{key}" for key in handler)
+    return features
+
+
+def collect_features(plugin_dir: Path) -> Dict[str, List[str]]:
+    """Return {feature: [files using it]} for one plugin."""
+    used: Dict[str, List[str]] = {}
+
+    def use(feature: str, path: Path) -> None:
+        used.setdefault(feature, [])
+        rel = str(path.relative_to(plugin_dir.parent))
+        if rel not in used[feature]:
+            used[feature].append(rel)
+
+    manifest_path = plugin_dir / '.claude-plugin' / 'plugin.json'
+    use('component:plugin', manifest_path)
+    manifest = json.loads(manifest_path.read_text(encoding='utf-8'))
+    for key in manifest:
+        use(f"plugin-manifest:{key}", manifest_path)
+    if isinstance(manifest.get('hooks'), dict):
+        for feature in hook_features(manifest['hooks'].get('hooks', manifest['hooks'])):
+            use(feature, manifest_path)
+
+    for kind, pattern in (('command', 'commands/*.md'), ('skill', 'skills/*/SKILL.md'),
+                          ('agent', 'agents/*.md')):
+        for path in sorted(plugin_dir.glob(pattern)):
+            use(f"component:{kind}s", path)
+            for key in frontmatter_keys(path):
+                use(f"frontmatter:{kind}:{key}", path)
+
+    hooks_path = plugin_dir / 'hooks' / 'hooks.json'
+    if hooks_path.exists():
+        use('component:hooks', hooks_path)
+        for feature in hook_features(json.loads(hooks_path.read_text(encoding='utf-8')).get('hooks', {})):
+            use(feature, hooks_path)
+
+    mcp_path = plugin_dir / '.mcp.json'
+    if mcp_path.exists():
+        use('component:mcp', mcp_path)
+
+    return used
+
+
+def check_plugin(used: Dict[str, List[str]], table: Dict[str, Dict],
+                 min_version: Optional[Tuple[int, ...]],
+                 max_version: Optional[Tuple[int, ...]]) -> Dict[str, List[Dict]]:
+    """Classify the features of one plugin as unsupported, removed, or unknown."""
+    result: Dict[str, List[Dict]] = {'unsupported': [], 'removed': [], 'unknown': []}
+    for feature in sorted(used):
+        entry = {'feature': feature, 'files': used[feature]}
+        spec = table.get(feature)
+        if spec is None:
+            result['unknown'].append(entry)
+            continue
+        since, until = spec.get('since'), spec.get('until')
+        if since and min_version and parse_version(since) > min_version:
+            result['unsupported'].append(dict(entry, since=since))
+        if until and (max_version is None or parse_version(until) <= max_version):
+            result['removed'].append(dict(entry, until=until))
+    return result
+
+
+def print_report(results: Dict[str, Dict[str, List[Dict]]], strict: bool) -> None:
+    for plugin, result in sorted(results.items()):
+        if not (result['unsupported'] or result['removed'] or result['unknown']):
+            continue
+        print(f"{plugin}:")
+        for entry in result['unsupported']:
+            print(f"  ✗ {entry['feature']} requires {entry['since']} ({entry['files'][0]})")
+        for entry in result['removed']:
+            print(f"  ✗ {entry['feature']} removed in {entry['until']} ({entry['files'][0]})")
+        for entry in result['unknown']:
+            more = f" and {len(entry['files']) - 1} more" if len(entry['files']) > 1 else ''
+            print(f"  ? {entry['feature']} is not a known feature ({entry['files'][0]}{more})")
+
+    failing = sorted(p for p, r in results.items()
+                     if r['unsupported'] or r['removed'] or (strict and r['unknown']))
+    print(f"\n{len(results)} plugins checked, {len(failing)} incompatible"
+          + (f": {', '.join(failing)}" if failing else ''))
+
+
+def main():
+    """Main entry point."""
+    parser = argparse.ArgumentParser(description='Check plugins against Claude Code feature support')
+    parser.add_argument('--min', help='oldest Claude Code version the plugins must work with')
+    parser.add_argument('--max', help='newest Claude Code version the plugins must work with')
+    parser.add_argument('--plugin', action='append', default=[], help='only check this plugin (repeatable)')
+    parser.add_argument('--strict', action='store_true', help='treat unknown features as incompatible')
+    parser.add_argument('--json', action='store_true', help='print results as JSON')
+    args = parser.parse_args()
+
+    repo_root = Path(__file__).parent.parent
+    table = json.loads((Path(__file__).parent / 'claude_code_features.json').read_text(encoding='utf-8'))['features']
+    try:
+        min_version = parse_version(args.min) if args.min else None
+        max_version = parse_version(args.max) if args.max else None
+    except ValueError as e:
+        print(f"Error: {e}", file=sys.stderr)
+        sys.exit(1)
+
+    results = {}
+    for manifest in sorted((repo_root / 'plugins').glob('*/.claude-plugin/plugin.json')):
+        plugin_dir = manifest.parent.parent
+        if args.plugin and plugin_dir.name not in args.plugin:
+            continue
+        results[plugin_dir.name] = check_plugin(collect_features(plugin_dir), table, min_version, max_version)
+
+    if args.json:
+        print(json.dumps(results, indent=2))
+    else:
+        print_report(results, args.strict)
+
+    failing = any(r['unsupported'] or r['removed'] or (args.strict and r['unknown']) for r in results.values())
+    sys.exit(1 if failing else 0)
+
+
+if __name__ == '__main__':
+    main()
@@ -32,3 +32,12 @@ def owners_rule():
 def opencode_color_rule():
     mod = _load_rule_module("opencode_color_rule.py")
     return mod.OpencodeAgentColorRule
+
+
+@pytest.fixture
+def plugin_compat():
+    script_path = Path(__file__).parent.parent / "scripts" / "check_plugin_compat.py"
+    spec = importlib.util.spec_from_file_location("check_plugin_compat", script_path)
+    mod = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(mod)
+    return mod
@@ -0,0 +1,85 @@
+import importlib.util
+import subprocess
+import sys
+from pathlib import Path
+
+import pytest
+
+ROOT = Path(__file__).parent.parent
+LOCK = ROOT / "lib" / "ai_helpers_lock.py"
+TARGET = "vsphere://vcenter.example.com/DC1/vm/ci-ln-x7k2p"
+
+
+def _load():
+    spec = importlib.util.spec_from_file_location(LOCK.stem, LOCK)
+    mod = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(mod)
+    return mod
+
+
+@pytest.fixture
+def lock(tmp_path, monkeypatch):
+    monkeypatch.setenv("AI_HELPERS_LOCK_DIR", str(tmp_path))
+    return _load()
+
+
+def _cli(tmp_path, *args):
+    env = {"AI_HELPERS_LOCK_DIR": str(tmp_path), "HOME": str(tmp_path), "PATH": "/usr/bin:/bin"}
+    return subprocess.run([sys.executable, str(LOCK)] + list(args), stdout=subprocess.PIPE,
+                          stderr=subprocess.PIPE, universal_newlines=True, env=env)
+
+
+def test_second_acquire_is_refused(lock):
+    lock.acquire(TARGET, "openshift:destroy-cluster")
+    with pytest.raises(lock.LockHeld) as held:
+        lock.acquire(TARGET, "openshift:destroy-cluster")
+    assert held.value.holder["command"] == "openshift:destroy-cluster"
+
+
+def test_other_targets_are_independent(lock):
+    lock.acquire(TARGET)
+    lock.acquire("cluster://ci-ln-x7k2p")
+
+
+def test_release_needs_the_token(lock):
+    token = lock.acquire(TARGET)
+    with pytest.raises(ValueError):
+        lock.release(TARGET, "not-the-token")
+    lock.release(TARGET, token)
+    lock.acquire(TARGET)
+
+
+def test_expired_lock_is_taken_over(lock, capsys):
+    lock.acquire(TARGET, ttl=-1)
+    lock.acquire(TARGET)
+    assert "expired" in capsys.readouterr().err
+
+
+def test_steal(lock, capsys):
+    first = lock.acquire(TARGET)
+    lock.acquire(TARGET, steal=True)
+    assert "stealing" in capsys.readouterr().err
+    with pytest.raises(ValueError):
+        lock.release(TARGET, first)
+
+
+def test_context_manager_releases(lock):
+    with lock.target_lock(TARGET):
+        assert lock.locks(TARGET)
+    assert lock.locks(TARGET) == []
+
+
+def test_status_hides_the_token(lock):
+    lock.acquire(TARGET, "openshift:destroy-cluster")
+    [holder] = lock.locks()
+    assert holder["target"] == TARGET and "token" not in holder and holder["expired"] is False
+
+
+def test_cli_exit_codes(tmp_path):
+    acquired = _cli(tmp_path, "acquire", TARGET, "--command", "openshift:destroy-cluster")
+    assert acquired.returncode == 0
+    held = _cli(tmp_path, "acquire", TARGET, "--wait", "1")
+    assert held.returncode == 2 and "openshift:destroy-cluster" in held.stderr
+    assert _cli(tmp_path, "release", TARGET, "--token", "wrong").returncode == 1
+    assert _cli(tmp_path, "release", TARGET, "--token", acquired.stdout.strip()).returncode == 0
+    assert _cli(tmp_path, "status").stdout.strip() == "0 locks"
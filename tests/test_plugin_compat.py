@@ -0,0 +1,102 @@
+import json
+
+
+def _make_plugin(temp_dir, name, manifest_extra=None):
+    plugin_dir = temp_dir / "plugins" / name
+    (plugin_dir / ".claude-plugin").mkdir(parents=True)
+    manifest = {"name": name, "version": "0.0.1", "description": "test", "author": "test"}
+    manifest.update(manifest_extra or {})
+    (plugin_dir / ".claude-plugin" / "plugin.json").write_text(json.dumps(manifest))
+    return plugin_dir
+
+
+def _add_skill(plugin_dir, name, frontmatter):
+    skill_dir = plugin_dir / "skills" / name
+    skill_dir.mkdir(parents=True)
+    (skill_dir / "SKILL.md").write_text(f"---\n{frontmatter}\n---\n\n# Skill\n")
+
+
+TABLE = {
+    "component:plugin": {"since": "2.0.12"},
+    "component:skills": {"since": "2.0.20"},
+    "component:hooks": {},
+    "plugin-manifest:name": {},
+    "plugin-manifest:version": {},
+    "plugin-manifest:description": {},
+    "plugin-manifest:author": {},
+    "frontmatter:skill:name": {},
+    "frontmatter:skill:description": {},
+    "frontmatter:skill:context": {"since": "2.1.0"},
+    "hook-event:Stop": {},
+    "hook-event:LegacyEvent": {"until": "2.1.0"},
+    "hook-handler:type": {},
+    "hook-handler:command": {},
+}
+
+
+def _check(mod, plugin_dir, min_version=None, max_version=None):
+    return mod.check_plugin(
+        mod.collect_features(plugin_dir),
+        TABLE,
+        mod.parse_version(min_version) if min_version else None,
+        mod.parse_version(max_version) if max_version else None,
+    )
+
+
+class TestPluginCompat:
+    def test_compatible_plugin(self, temp_dir, plugin_compat):
+        plugin = _make_plugin(temp_dir, "test-plugin")
+        _add_skill(plugin, "my-skill", "name: my-skill\ndescription: test")
+
+        result = _check(plugin_compat, plugin, min_version="2.0.20")
+        assert result == {"unsupported": [], "removed": [], "unknown": []}
+
+    def test_feature_newer_than_min_version(self, temp_dir, plugin_compat):
+        plugin = _make_plugin(temp_dir, "test-plugin")
+        _add_skill(plugin, "my-skill", "name: my-skill\ndescription: test\ncontext: fork")
+
+        result = _check(plugin_compat, plugin, min_version="2.0.20")
+        assert [e["feature"] for e in result["unsupported"]] == ["frontmatter:skill:context"]
+        assert result["unsupported"][0]["since"] == "2.1.0"
+        assert result["unsupported"][0]["files"] == ["test-plugin/skills/my-skill/SKILL.md"]
+
+    def test_no_min_version_skips_since(self, temp_dir, plugin_compat):
+        plugin = _make_plugin(temp_dir, "test-plugin")
+        _add_skill(plugin, "my-skill", "name: my-skill\ndescription: test\ncontext: fork")
+
+        result = _check(plugin_compat, plugin)
+        assert result["unsupported"] == []
+
+    def test_removed_feature(self, temp_dir, plugin_compat):
+        plugin = _make_plugin(temp_dir, "test-plugin")
+        (plugin / "hooks").mkdir()
+        (plugin / "hooks" / "hooks.json").write_text(json.dumps({
+            "hooks": {"LegacyEvent": [{"hooks": [{"type": "command", "command": "true"}]}]}
+        }))
+
+        assert _check(plugin_compat, plugin, max_version="2.0.30")["removed"] == []
+        result = _check(plugin_compat, plugin, max_version="2.1.0")
+        assert [e["feature"] for e in result["removed"]] == ["hook-event:LegacyEvent"]
+
+    def test_unknown_frontmatter_and_manifest_keys(self, temp_dir, plugin_compat):
+        plugin = _make_plugin(temp_dir, "test-plugin", {"engines": {"claude-code": ">=2"}})
+        _add_skill(plugin, "my-skill", "name: my-skill\ndescription: test\ntools: [Bash]")
+
+        result = _check(plugin_compat, plugin)
+        assert [e["feature"] for e in result["unknown"]] == [
+            "frontmatter:skill:tools",
+            "plugin-manifest:engines",
+        ]
+
+    def test_inline_manifest_hooks(self, temp_dir, plugin_compat):
+        plugin = _make_plugin(temp_dir, "test-plugin", {
+            "hooks": {"Stop": [{"hooks": [{"type": "command", "command": "true", "async": True}]}]}
+        })
+
+        features = plugin_compat.collect_features(plugin)
+        assert "hook-event:Stop" in features
+        assert "hook-handler:async" in features
+
+    def test_parse_version(self, plugin_compat):
+        assert plugin_compat.parse_version("2.0.12") < plugin_compat.parse_version("2.0.20")
+        assert plugin_compat.parse_version("2.1") < plugin_compat.parse_version("2.1.0")
@@ -0,0 +1,96 @@
+import http.server
+import importlib.util
+import json
+import subprocess
+import sys
+import threading
+import time
+import urllib.parse
+from pathlib import Path
+
+import pytest
+
+ROOT = Path(__file__).parent.parent
+PLUGINS = ROOT / "plugins"
+EVENTS = ROOT / "lib" / "ai_helpers_events.py"
+PROM_DUMP = PLUGINS / "openshift/skills/metrics-snapshot/scripts/prom_dump.py"
+
+
+def _load(path):
+    spec = importlib.util.spec_from_file_location(path.stem, path)
+    mod = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(mod)
+    return mod
+
+
+class _PrometheusHandler(http.server.BaseHTTPRequestHandler):
+    def do_POST(self):
+        params = urllib.parse.parse_qs(self.rfile.read(int(self.headers["Content-Length"])).decode())
+        start = float(params["start"][0])
+        body = json.dumps({"status": "success", "data": {"resultType": "matrix", "result": [
+            {"metric": {"__name__": params["query"][0], "instance": "master-0"}, "values": [[start, "1"]]}]}})
+        self.send_response(200)
+        self.send_header("Content-Type", "application/json")
+        self.end_headers()
+        self.wfile.write(body.encode())
+
+    def log_message(self, *args):
+        pass
+
+
+@pytest.fixture
+def prometheus():
+    server = http.server.HTTPServer(("127.0.0.1", 0), _PrometheusHandler)
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    yield "http://127.0.0.1:{}".format(server.server_address[1])
+    server.shutdown()
+    thread.join()
+
+
+def test_script_prints_progress_events(prometheus, tmp_path):
+    # prom_dump.py reaches lib/ai_helpers_events.py through the symlink next to it
+    proc = subprocess.run([sys.executable, str(PROM_DUMP), "--url", prometheus, "--start", "1h", "--step", "5m",
+                           "--query", "up=up", "--query", "load=node_load1", "--output", str(tmp_path),
+                           "--format", "openmetrics", "--progress"], stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+                          universal_newlines=True, timeout=60)
+    assert proc.returncode == 0, proc.stderr
+    events = [json.loads(line) for line in proc.stderr.splitlines()]
+    assert [e["type"] for e in events] == ["progress", "progress"]
+    assert [(e["phase"], e["done"], e["total"], e["item"]) for e in events] == [
+        ("export", 1, 2, "up"), ("export", 2, 2, "load")]
+    assert events[-1]["percent"] == 100.0
+    assert events[-1]["etaSeconds"] == 0
+
+
+def _events(capsys):
+    return [json.loads(line) for line in capsys.readouterr().err.splitlines()]
+
+
+def test_progress_event_shape(capsys):
+    progress = _load(EVENTS).progress
+    progress("sweep", 1, 4, time.time() - 3, "dev-01")
+    events = _events(capsys)
+    assert len(events) == 1
+    assert list(events[0]) == ["type", "phase", "done", "total", "percent", "etaSeconds", "item"]
+    assert events[0]["type"] == "progress"
+    assert events[0]["phase"] == "sweep"
+    assert (events[0]["done"], events[0]["total"], events[0]["percent"]) == (1, 4, 25.0)
+    assert events[0]["etaSeconds"] == 9
+    assert events[0]["item"] == "dev-01"
+
+
+def test_progress_unknown_total(capsys):
+    progress = _load(EVENTS).progress
+    progress("list", 500, None, time.time(), "all namespaces")
+    event = _events(capsys)[0]
+    assert event["total"] is None
+    assert event["percent"] is None
+    assert event["etaSeconds"] is None
+
+
+def test_notify_unset_variable_warns(capsys, monkeypatch):
+    monkeypatch.delenv("AI_HELPERS_TEST_WEBHOOK", raising=False)
+    notify = _load(EVENTS).notify
+    notify("env:AI_HELPERS_TEST_WEBHOOK", {"command": "test"})
+    assert "variable is not set" in capsys.readouterr().err
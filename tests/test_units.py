@@ -0,0 +1,60 @@
+import importlib.util
+from pathlib import Path
+
+import pytest
+
+ROOT = Path(__file__).parent.parent
+UNITS = ROOT / "lib" / "ai_helpers_units.py"
+SCRIPTS = [
+    ROOT / "plugins/ci/skills/prow-job-analysis/ai_helpers_units.py",
+    ROOT / "plugins/must-gather/skills/must-gather-analyzer/scripts/ai_helpers_units.py",
+    ROOT / "plugins/openshift/skills/metrics-snapshot/scripts/ai_helpers_units.py",
+    ROOT / "plugins/openshift/skills/event-aggregation/scripts/ai_helpers_units.py",
+]
+
+
+def _load():
+    spec = importlib.util.spec_from_file_location(UNITS.stem, UNITS)
+    mod = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(mod)
+    return mod
+
+
+@pytest.mark.parametrize("value,expected", [
+    ("1024", 1024), ("512K", 512 * 1024), ("50M", 50 * 1024 ** 2), ("50MB", 50 * 1024 ** 2),
+    ("50mib", 50 * 1024 ** 2), ("1.5TiB", int(1.5 * 1024 ** 4)), (" 2G ", 2 * 1024 ** 3), ("0", 0), ("10B", 10),
+])
+def test_parse_size(value, expected):
+    assert _load().parse_size(value) == expected
+
+
+@pytest.mark.parametrize("value", ["", "M", "5X", "5MiBs", "-1K", "1 0M"])
+def test_parse_size_invalid(value):
+    with pytest.raises(ValueError):
+        _load().parse_size(value)
+
+
+@pytest.mark.parametrize("value,expected", [
+    ("30s", 30), ("5m", 300), ("6h", 21600), ("2d", 172800), ("2w", 1209600), ("1h30m", 5400),
+])
+def test_parse_duration(value, expected):
+    assert _load().parse_duration(value) == expected
+
+
+@pytest.mark.parametrize("value", ["", "30", "5y", "1.5h", "h", "1h 30m", "now"])
+def test_parse_duration_invalid(value):
+    with pytest.raises(ValueError):
+        _load().parse_duration(value)
+
+
+@pytest.mark.parametrize("size,expected", [
+    (0, "0B"), (1023, "1023B"), (1536, "1.5KiB"), (50 * 1024 ** 2, "50.0MiB"), (3 * 1024 ** 4, "3.0TiB"),
+    (2 * 1024 ** 5, "2.0PiB"),
+])
+def test_format_size(size, expected):
+    assert _load().format_size(size) == expected
+
+
+@pytest.mark.parametrize("link", SCRIPTS, ids=lambda p: p.parent.name)
+def test_scripts_link_the_shared_module(link):
+    assert link.is_symlink() and link.resolve() == UNITS.resolve()